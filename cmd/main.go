@@ -1,37 +1,274 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"go.maqui.dev/pkg"
 	"os"
+	"strings"
 )
 
+var dumpSymbols = flag.Bool("dump-symbols", false, "print the global and per-function symbol tables after analysis")
+var tokenCache = flag.String("token-cache", "", "directory where the lexed tokens are cached between compilations")
+var shared = flag.Bool("shared", false, "build a shared library exporting all top-level functions instead of an executable")
+var suppress = flag.String("suppress", "", "comma separated kinds of warnings that are not reported, like shadow")
+var warningsAsErrors = flag.Bool("warnings-as-errors", false, "fail the compilation on warnings, as if they were errors")
+var keepIR = flag.String("keep-ir", "", "directory where the generated LLVM IR is written and kept, for debugging")
+var optLevel = flag.String("opt", "", "optimization level of the generated code: O0, O1, O2, O3 or Os")
+var jsonOutput = flag.Bool("json", false, "print the errors and warnings as a JSON array, for CI systems and editors")
+
+// warnings holds the warnings found when printing JSON, so they are printed along the errors
+var warnings []maqui.CompileError
+
 func main() {
-	if len(os.Args) != 2 {
+	flag.Parse()
+	args := flag.Args()
+
+	if len(args) == 2 && args[0] == "fmt" {
+		format(args[1])
+		return
+	}
+
+	if len(args) == 2 && args[0] == "check" {
+		check(args[1])
+		return
+	}
+
+	if len(args) == 2 && args[0] == "run" {
+		run(args[1])
+		return
+	}
+
+	if len(args) == 2 && args[0] == "eval" {
+		eval(args[1])
+		return
+	}
+
+	if len(args) != 1 {
 		fmt.Println("Expected one argument: source location")
 		return
 	}
 
-	source := os.Args[1]
+	source := args[0]
+
+	c := newCompiler(source)
+
+	if *tokenCache != "" {
+		cache, err := maqui.NewTokenCache(*tokenCache)
+		if err != nil {
+			fatal(err)
+		}
+
+		c.SetTokenCache(cache)
+	}
+
+	if *shared {
+		c.SetOutputMode(maqui.SharedLibrary)
+	}
+
+	if *keepIR != "" {
+		c.KeepIR(*keepIR)
+	}
+
+	if *optLevel != "" {
+		if err := c.SetOptLevel(maqui.OptLevel(*optLevel)); err != nil {
+			fatal(err)
+		}
+	}
 
+	// A directory is compiled as a package, made of all its source files
+	analyze, compile := c.Analyze, c.Compile
+	if info, err := os.Stat(source); err == nil && info.IsDir() {
+		analyze, compile = c.AnalyzePackage, c.CompilePackage
+	}
+
+	if *dumpSymbols {
+		// The compilation that follows reports the warnings, so the dump doesn't report them as well
+		c.SetWarningHandler(nil)
+		dump(analyze, source)
+		c.SetWarningHandler(warningHandler(c, source))
+	}
+
+	compileErr, err := compile(source)
+	if err != nil {
+		fatal(err)
+	}
+
+	if *jsonOutput {
+		printJSON(compileErr)
+		return
+	}
+
+	if len(compileErr) != 0 {
+		printErrors(c, source, compileErr)
+		return
+	}
+
+	fmt.Println("Ok")
+}
+
+// newCompiler creates the compiler for the source file, with the handler of the warnings set.
+func newCompiler(source string) *maqui.Compiler {
 	c := maqui.NewCompiler(maqui.Target{
 		Arch:   maqui.X86_64,
 		Vendor: maqui.Unknown,
 		OS:     maqui.Linux,
 	})
 
-	compileErr, err := c.Compile(source)
+	for _, kind := range strings.Split(*suppress, ",") {
+		if kind != "" {
+			c.SuppressWarning(strings.TrimSpace(kind))
+		}
+	}
+
+	c.SetWarningsAsErrors(*warningsAsErrors)
+	c.SetWarningHandler(warningHandler(c, source))
+
+	return c
+}
+
+// warningHandler returns the handler that prints the warnings of the source file as they are reported. When printing
+// JSON, the warnings are kept instead.
+func warningHandler(c *maqui.Compiler, source string) func(maqui.Warning) {
+	return func(w maqui.Warning) {
+		if *jsonOutput {
+			warnings = append(warnings, w)
+			return
+		}
+
+		printErrors(c, source, []maqui.CompileError{w})
+	}
+}
+
+// format prints the canonical formatting of the source file to the standard output
+func format(source string) {
+	if err := maqui.FormatFile(source, os.Stdout); err != nil {
+		fatal(err)
+	}
+}
+
+// check prints the compile errors of the source file without building it
+func check(source string) {
+	c := newCompiler(source)
+
+	compileErr, err := c.Check(source)
 	if err != nil {
-		panic(err.Error())
+		fatal(err)
 	}
 
-	if len(compileErr) != 0 {
-		for _, err := range compileErr {
-			fmt.Println(err)
+	if *jsonOutput {
+		printJSON(compileErr)
+		if len(compileErr) != 0 {
+			os.Exit(1)
 		}
 
 		return
 	}
 
+	if len(compileErr) != 0 {
+		printErrors(c, source, compileErr)
+		os.Exit(1)
+	}
+
 	fmt.Println("Ok")
 }
+
+// eval prints the value and type of a constant expression, like 14:int
+func eval(expr string) {
+	res, err := maqui.EvalSource(expr)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println(res)
+}
+
+// run compiles and runs the source file, printing its output and exiting with its exit code
+func run(source string) {
+	c := newCompiler(source)
+
+	if *optLevel != "" {
+		if err := c.SetOptLevel(maqui.OptLevel(*optLevel)); err != nil {
+			fatal(err)
+		}
+	}
+
+	exitCode, output, err := c.Run(source)
+
+	var compileErr maqui.CompileErrors
+	if errors.As(err, &compileErr) {
+		if *jsonOutput {
+			printJSON(compileErr)
+		} else {
+			printErrors(c, source, compileErr)
+		}
+
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Print(output)
+	os.Exit(exitCode)
+}
+
+// dump prints the global symbol table of the source file or package, analysed with the provided function, followed by the
+// symbol table of each function
+func dump(analyze func(string) (*maqui.AST, error), source string) {
+	ast, err := analyze(source)
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println("global:")
+	fmt.Println(ast.Global.Dump())
+
+	for _, stmt := range ast.Statements {
+		if f, ok := stmt.Expr.(*maqui.FuncDecl); ok {
+			fmt.Printf("func %s:\n", f.Name)
+			fmt.Println(stmt.Stab.Dump())
+		}
+	}
+}
+
+// printErrors prints the compile errors with the formatter of the compiler, each followed by the line of the source file
+// where it was found, with the offending code underlined. The errors without a file, or located by a line directive,
+// are underlined in the source file.
+func printErrors(c *maqui.Compiler, source string, compileErr []maqui.CompileError) {
+	sources := make(map[string][]byte)
+
+	for _, err := range compileErr {
+		fmt.Println(c.FormatDiagnostic(err))
+
+		file := source
+		if loc := err.GetLocation(); loc != nil && loc.File != "" && loc.Line == 0 {
+			file = loc.File
+		}
+
+		if _, read := sources[file]; !read {
+			// Unreadable files are kept as nil, so they are not underlined
+			sources[file], _ = os.ReadFile(file)
+		}
+
+		fmt.Print(maqui.Underline(sources[file], err.GetLocation()))
+	}
+}
+
+// fatal prints the error to the standard error, like a source file that can't be read, and exits with a failure
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// printJSON prints the warnings found followed by the compile errors as a JSON array
+func printJSON(compileErr []maqui.CompileError) {
+	out, err := maqui.MarshalDiagnostics(append(warnings, compileErr...))
+	if err != nil {
+		fatal(err)
+	}
+
+	fmt.Println(string(out))
+}
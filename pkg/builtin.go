@@ -1,40 +1,327 @@
 package maqui
 
 import (
+	"sort"
+	"strings"
+
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
+	"github.com/llir/llvm/ir/enum"
 	"github.com/llir/llvm/ir/types"
 )
 
-func defineBuiltins(b *LLVMIRBuilder) {
-	defineBuiltinFunc(b, "print", builtinPrint)
+type funcDefinition = func(b *LLVMIRBuilder) *ir.Func
+
+// builtin is a function provided by the compiler. It holds both the type of the function, used by the semantic
+// analysis, and its definition, used to generate the IR, so the two can't drift apart.
+type builtin struct {
+	// typ is the signature of the function
+	typ *FuncType
+	// definition generates the IR of the function
+	definition funcDefinition
+	// overloads holds alternative definitions of the function, mapped by the LLVM type of the argument they take. An
+	// overload is called instead of the definition when the only argument of the call has its type.
+	overloads map[string]funcDefinition
+}
+
+// builtins is the registry of the builtin functions, mapped by name. It's consumed by both the [NewGlobalSymbolTable]
+// and the [NewLLVMIRBuilder].
+var builtins = map[string]*builtin{}
+
+func init() {
+	anyArg := []*ArgumentType{
+		{
+			Name: "v",
+			Type: &AnyType{},
+		},
+	}
+
+	registerBuiltin("print", &FuncType{Args: anyArg}, builtinPrint)
+	registerOverload("print", types.I1, builtinPrintBool)
+	registerOverload("print", types.Double, builtinPrintFloat)
+	registerOverload("print", types.I8Ptr, builtinPrintString)
+
+	registerBuiltin("println", &FuncType{Args: anyArg}, builtinPrintln)
+	registerOverload("println", types.I1, builtinPrintlnBool)
+	registerOverload("println", types.Double, builtinPrintlnFloat)
+	registerOverload("println", types.I8Ptr, builtinPrintlnString)
+
+	registerBuiltin("abort", &FuncType{}, builtinAbort)
+
+	registerBuiltin("panic", &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "msg",
+				Type: &BasicType{"string"},
+			},
+		},
+	}, builtinPanic)
+
+	registerBuiltin("assert", &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "cond",
+				Type: &BasicType{"bool"},
+			},
+		},
+	}, builtinAssert)
+
+	// The arguments after the format are not part of the type, as they are passed as is to printf
+	registerBuiltin("format", &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "fmt",
+				Type: &BasicType{"string"},
+			},
+		},
+	}, builtinFormat)
+}
+
+// builtinPrefix is prepended to the symbol names of the builtins. It differs from the [manglePrefix], so a user function
+// with the name of a builtin doesn't clash with it.
+const builtinPrefix = "maqui."
+
+// registerBuiltin adds a function to the builtin registry. If a builtin with the same name already exists, it will be
+// replaced.
+func registerBuiltin(name string, typ *FuncType, definition funcDefinition) {
+	builtins[name] = &builtin{
+		typ:        typ,
+		definition: definition,
+	}
+}
+
+// registerOverload adds an alternative definition to a registered builtin, used when it's called with a single argument
+// of the provided type.
+func registerOverload(name string, argType types.Type, definition funcDefinition) {
+	b := builtins[name]
+	if b.overloads == nil {
+		b.overloads = make(map[string]funcDefinition)
+	}
+
+	b.overloads[argType.String()] = definition
+}
+
+// overloadName returns the name under which the overload of a function for an argument type is kept in the values
+func overloadName(name, argType string) string {
+	return name + "(" + argType + ")"
+}
+
+// builtinNames returns the names of all registered builtins, sorted
+func builtinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
 }
 
-type funcDefinition = func(mod *ir.Module) *ir.Func
+// defineBuiltins defines all registered builtins inside the module of the builder. They are defined in name order, so
+// the generated IR is deterministic.
+func defineBuiltins(b *LLVMIRBuilder) {
+	for _, name := range builtinNames() {
+		defineBuiltinFunc(b, name, builtins[name].definition)
+
+		argTypes := make([]string, 0, len(builtins[name].overloads))
+		for argType := range builtins[name].overloads {
+			argTypes = append(argTypes, argType)
+		}
+
+		sort.Strings(argTypes)
+		for _, argType := range argTypes {
+			f := builtins[name].overloads[argType](b)
+			f.SetName(builtinPrefix + name + "_" + strings.ReplaceAll(argType, "*", "ptr"))
+			b.values.Set(overloadName(name, argType), f)
+		}
+	}
+}
 
 func defineBuiltinFunc(b *LLVMIRBuilder, name string, definition funcDefinition) {
-	f := definition(b.mod)
-	f.SetName(name)
+	f := definition(b)
+	if len(f.Blocks) != 0 {
+		// The builtins that are declarations of C functions keep the C name
+		f.SetName(builtinPrefix + name)
+	}
+
 	b.values.Set(name, f)
 }
 
-func builtinPrint(mod *ir.Module) *ir.Func {
-	f := mod.NewFunc("", types.Void, ir.NewParam("v", types.I32))
-	b := f.NewBlock("")
+// externFunc returns the module's declaration of an external C function. If the function is not yet declared, it's
+// declared with the provided signature.
+func externFunc(b *LLVMIRBuilder, name string, ret types.Type, params ...*ir.Param) *ir.Func {
+	for _, f := range b.mod.Funcs {
+		if f.Name() == name {
+			return f
+		}
+	}
+
+	return b.mod.NewFunc(name, ret, params...)
+}
+
+// globalString returns a pointer to the first character of a NUL-terminated global string constant. If the module
+// already has a global with the same name, it's reused.
+func globalString(b *LLVMIRBuilder, name, s string) constant.Constant {
+	zero := constant.NewInt(b.wordType(), 0)
+
+	for _, glob := range b.mod.Globals {
+		if glob.Name() == name {
+			return constant.NewGetElementPtr(glob.ContentType, glob, zero, zero)
+		}
+	}
 
-	printf := mod.NewFunc("printf", types.I32, ir.NewParam("format", types.I8Ptr))
+	str := constant.NewCharArrayFromString(s + "\x00")
+	glob := b.mod.NewGlobalDef(name, str)
+	glob.Immutable = true
+
+	return constant.NewGetElementPtr(str.Typ, glob, zero, zero)
+}
+
+// printfFunc returns the declaration of the C printf function
+func printfFunc(b *LLVMIRBuilder) *ir.Func {
+	printf := externFunc(b, "printf", types.I32, ir.NewParam("format", types.I8Ptr))
 	printf.Sig.Variadic = true
 
-	zero := constant.NewInt(types.I32, 0)
+	return printf
+}
+
+// definePrintf defines a builtin that prints its only argument, of the provided type, with printf using the provided
+// format
+func definePrintf(b *LLVMIRBuilder, fmtName, format string, typ types.Type) *ir.Func {
+	f := b.mod.NewFunc("", types.Void, ir.NewParam("v", typ))
+	block := f.NewBlock("entry")
+
+	zero := constant.NewInt(b.wordType(), 0)
+
+	formatStr := constant.NewCharArrayFromString(format + "\x00")
+	formatGlob := b.mod.NewGlobalDef(fmtName, formatStr)
+
+	fmtAddr := constant.NewGetElementPtr(formatStr.Typ, formatGlob, zero, zero)
+
+	block.NewCall(printfFunc(b), fmtAddr, f.Params[0])
+
+	block.NewRet(nil)
+
+	return f
+}
+
+// builtinPrint prints its argument without a trailing new-line
+func builtinPrint(b *LLVMIRBuilder) *ir.Func {
+	// Narrower integers get extended at the call site
+	return definePrintf(b, "._print_fmt", "%lld", types.I64)
+}
+
+// builtinPrintln prints its argument followed by a new-line
+func builtinPrintln(b *LLVMIRBuilder) *ir.Func {
+	return definePrintf(b, "._println_fmt", "%lld\n", types.I64)
+}
+
+// builtinPrintFloat prints its floating point argument without a trailing new-line
+func builtinPrintFloat(b *LLVMIRBuilder) *ir.Func {
+	return definePrintf(b, "._print_float_fmt", "%g", types.Double)
+}
+
+// builtinPrintlnFloat prints its floating point argument followed by a new-line
+func builtinPrintlnFloat(b *LLVMIRBuilder) *ir.Func {
+	return definePrintf(b, "._println_float_fmt", "%g\n", types.Double)
+}
+
+// builtinPrintString prints its string argument without a trailing new-line
+func builtinPrintString(b *LLVMIRBuilder) *ir.Func {
+	return definePrintf(b, "._print_str_fmt", "%s", types.I8Ptr)
+}
+
+// builtinPrintlnString prints its string argument followed by a new-line
+func builtinPrintlnString(b *LLVMIRBuilder) *ir.Func {
+	return definePrintf(b, "._println_str_fmt", "%s\n", types.I8Ptr)
+}
+
+// builtinFormat prints its arguments following a printf-style format. It's the C printf function itself, so the calls
+// map directly to it.
+func builtinFormat(b *LLVMIRBuilder) *ir.Func {
+	return printfFunc(b)
+}
+
+// definePrintfBool defines a builtin that prints its boolean argument as "true" or "false" with printf, using the
+// provided format
+func definePrintfBool(b *LLVMIRBuilder, fmtName, format string) *ir.Func {
+	f := b.mod.NewFunc("", types.Void, ir.NewParam("v", types.I1))
+	block := f.NewBlock("entry")
+
+	str := block.NewSelect(f.Params[0], globalString(b, "._true_str", "true"), globalString(b, "._false_str", "false"))
+	block.NewCall(printfFunc(b), globalString(b, fmtName, format), str)
+
+	block.NewRet(nil)
+
+	return f
+}
+
+// builtinPrintBool prints its boolean argument without a trailing new-line
+func builtinPrintBool(b *LLVMIRBuilder) *ir.Func {
+	return definePrintfBool(b, "._print_bool_fmt", "%s")
+}
+
+// builtinPrintlnBool prints its boolean argument followed by a new-line
+func builtinPrintlnBool(b *LLVMIRBuilder) *ir.Func {
+	return definePrintfBool(b, "._println_bool_fmt", "%s\n")
+}
+
+// abortFunc returns the declaration of the C abort function, which never returns
+func abortFunc(b *LLVMIRBuilder) *ir.Func {
+	abort := externFunc(b, "abort", types.Void)
+	if len(abort.FuncAttrs) == 0 {
+		abort.FuncAttrs = append(abort.FuncAttrs, enum.FuncAttrNoReturn)
+	}
+
+	return abort
+}
+
+// builtinAbort terminates the program abnormally, through the C abort function
+func builtinAbort(b *LLVMIRBuilder) *ir.Func {
+	f := b.mod.NewFunc("", types.Void)
+	block := f.NewBlock("entry")
+
+	block.NewCall(abortFunc(b))
+	block.NewUnreachable()
+
+	return f
+}
+
+// builtinPanic terminates the program abnormally after printing "panic: " followed by its message. The output streams
+// are flushed before aborting, so the message and anything printed before it are never lost. Deferred calls don't run.
+func builtinPanic(b *LLVMIRBuilder) *ir.Func {
+	f := b.mod.NewFunc("", types.Void, ir.NewParam("msg", types.I8Ptr))
+	f.FuncAttrs = append(f.FuncAttrs, enum.FuncAttrNoReturn)
+	block := f.NewBlock("entry")
+
+	block.NewCall(printfFunc(b), globalString(b, "._panic_fmt", "panic: %s\n"), f.Params[0])
+
+	// A null stream flushes all of them
+	fflush := externFunc(b, "fflush", types.I32, ir.NewParam("stream", types.I8Ptr))
+	block.NewCall(fflush, constant.NewNull(types.I8Ptr))
+
+	block.NewCall(abortFunc(b))
+	block.NewUnreachable()
+
+	return f
+}
 
-	format := constant.NewCharArrayFromString("%d\n")
-	formatGlob := mod.NewGlobalDef("._printf_fmt", format)
+// builtinAssert terminates the program abnormally, through the C abort function, if its condition is false. As with
+// panic, the output streams are flushed before aborting.
+func builtinAssert(b *LLVMIRBuilder) *ir.Func {
+	f := b.mod.NewFunc("", types.Void, ir.NewParam("cond", types.I1))
+	entry := f.NewBlock("entry")
+	ok := f.NewBlock("assert.ok")
+	fail := f.NewBlock("assert.fail")
 
-	fmtAddr := constant.NewGetElementPtr(types.NewArray(3, types.I8), formatGlob, zero, zero)
+	entry.NewCondBr(f.Params[0], ok, fail)
 
-	b.NewCall(printf, fmtAddr, f.Params[0])
+	ok.NewRet(nil)
 
-	b.NewRet(nil)
+	fflush := externFunc(b, "fflush", types.I32, ir.NewParam("stream", types.I8Ptr))
+	fail.NewCall(fflush, constant.NewNull(types.I8Ptr))
+	fail.NewCall(abortFunc(b))
+	fail.NewUnreachable()
 
 	return f
 }
@@ -0,0 +1,40 @@
+package maqui
+
+import (
+	"testing"
+
+	"github.com/llir/llvm/ir"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinsInSync(t *testing.T) {
+	global := NewGlobalSymbolTable()
+	b := NewLLVMIRBuilder(linuxTarget)
+
+	for _, name := range []string{"print", "println", "abort", "panic", "assert"} {
+		t.Run(name, func(t *testing.T) {
+			typ, isFunc := global.Get(name).(*FuncType)
+			if !assert.True(t, isFunc, "%s must be a function in the global symbol table", name) {
+				return
+			}
+
+			f, isIRFunc := b.values[name].(*ir.Func)
+			if !assert.True(t, isIRFunc, "%s must be defined in the IR", name) {
+				return
+			}
+
+			assert.Equal(t, builtinPrefix+name, f.Name())
+			assert.Len(t, f.Params, len(typ.Args))
+			assert.NotEmpty(t, f.Blocks, "%s must have a body", name)
+
+			for argType := range builtins[name].overloads {
+				overload, isIRFunc := b.values[overloadName(name, argType)].(*ir.Func)
+				if assert.True(t, isIRFunc, "%s overload for %s must be defined in the IR", name, argType) {
+					assert.Len(t, overload.Params, len(typ.Args))
+				}
+			}
+		})
+	}
+
+	assert.Len(t, global.Entries, len(builtins))
+}
@@ -0,0 +1,154 @@
+package maqui
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// TokenCache keeps the tokens of lexed files in disk, so unchanged files don't need to be lexed again on subsequent
+// compilations. Entries are keyed by the path of the file and the version of the cache format, and are only reused while
+// the hash of the file contents matches the hash of the cached source.
+type TokenCache struct {
+	// dir is the directory where the cache entries are stored
+	dir string
+	// lexed counts the files lexed because their tokens were not cached, or were outdated
+	lexed int
+}
+
+// tokenCacheVersion is the version of the format of the cache entries, which is part of their key. It must be increased
+// whenever the tokens produced by the lexer or their encoding change, like when a field is added to [Location], so the
+// entries written by older versions are not replayed.
+const tokenCacheVersion = 3
+
+// tokenCacheEntry is the serialized content of a cache entry.
+type tokenCacheEntry struct {
+	// Hash is the SHA-256 of the source the tokens were lexed from
+	Hash [sha256.Size]byte
+	// Tokens is the full stream of tokens of the source, including the final [TokenEOF]
+	Tokens []Token
+}
+
+// NewTokenCache creates a token cache that stores its entries inside dir. The directory is created if it doesn't exist.
+func NewTokenCache(dir string) (*TokenCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &TokenCache{
+		dir: dir,
+	}, nil
+}
+
+// Tokenizer returns a tokenizer for the file. If the cache holds the tokens of the unchanged file, they are replayed.
+// Otherwise, the file is lexed and its tokens are stored in the cache.
+func (c *TokenCache) Tokenizer(filename string) (Tokenizer, error) {
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, &SourceError{Path: filename, Err: err}
+	}
+
+	hash := sha256.Sum256(src)
+	if entry, ok := c.load(filename); ok && entry.Hash == hash {
+		return NewTokenStream(filename, entry.Tokens), nil
+	}
+
+	c.lexed++
+
+	l := NewLexerFromReader(bytes.NewReader(src))
+	l.filename = filename
+	go l.Do()
+
+	var toks []Token
+	for tok := range l.Chan() {
+		toks = append(toks, tok)
+	}
+
+	// A failure to store the entry only means the file will be lexed again next time
+	_ = c.store(filename, &tokenCacheEntry{
+		Hash:   hash,
+		Tokens: toks,
+	})
+
+	return NewTokenStream(filename, toks), nil
+}
+
+// path returns the location of the cache entry for the file
+func (c *TokenCache) path(filename string) string {
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+
+	key := sha256.Sum256([]byte(fmt.Sprintf("v%d:%s", tokenCacheVersion, filename)))
+	return filepath.Join(c.dir, hex.EncodeToString(key[:])+".gob")
+}
+
+// load reads the cache entry of the file. If the entry doesn't exist or can't be decoded, false is returned.
+func (c *TokenCache) load(filename string) (*tokenCacheEntry, bool) {
+	f, err := os.Open(c.path(filename))
+	if err != nil {
+		return nil, false
+	}
+
+	defer f.Close()
+
+	entry := &tokenCacheEntry{}
+	if err := gob.NewDecoder(f).Decode(entry); err != nil {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// store writes the cache entry of the file, replacing any previous entry
+func (c *TokenCache) store(filename string, entry *tokenCacheEntry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.path(filename), buf.Bytes(), 0o644)
+}
+
+// TokenStream is a Tokenizer that replays an already lexed slice of tokens. Once the slice is exhausted, it keeps
+// returning [TokenEOF] tokens.
+type TokenStream struct {
+	// filename is the name of the file the tokens were lexed from
+	filename string
+	// tokens holds the tokens to replay
+	tokens []Token
+	// pos is the index of the next token to replay
+	pos int
+}
+
+// NewTokenStream creates a TokenStream that replays the provided tokens of the file.
+func NewTokenStream(filename string, tokens []Token) *TokenStream {
+	return &TokenStream{
+		filename: filename,
+		tokens:   tokens,
+	}
+}
+
+// Do does nothing, since the tokens are already available
+func (s *TokenStream) Do() {}
+
+// Get returns the next token of the stream
+func (s *TokenStream) Get() Token {
+	if s.pos >= len(s.tokens) {
+		return Token{Typ: TokenEOF}
+	}
+
+	tok := s.tokens[s.pos]
+	s.pos++
+
+	return tok
+}
+
+// GetFilename returns the name of the file the tokens were lexed from
+func (s *TokenStream) GetFilename() string {
+	return s.filename
+}
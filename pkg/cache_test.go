@@ -0,0 +1,147 @@
+package maqui
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// drainTokenizer returns all tokens of the tokenizer up to the end of the stream, without the locations
+func drainTokenizer(tokenizer Tokenizer) []Token {
+	go tokenizer.Do()
+
+	var toks []Token
+	for tok := tokenizer.Get(); tok.Typ != TokenEOF; tok = tokenizer.Get() {
+		tok.Loc = nil // ignore meta
+		toks = append(toks, tok)
+	}
+
+	return toks
+}
+
+func TestTokenCache(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "main.mq")
+
+	if err := os.WriteFile(filename, []byte("x := 1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewTokenCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Token{
+		{TokenIdentifier, "x", nil},
+		{TokenDeclaration, ":=", nil},
+		{TokenNumber, "1", nil},
+	}
+
+	tokenizer, err := cache.Tokenizer(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expect, drainTokenizer(tokenizer))
+		assert.Equal(t, 1, cache.lexed)
+	}
+
+	// An unchanged file is not lexed again, even by a new cache over the same directory
+	cache, err = NewTokenCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokenizer, err = cache.Tokenizer(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, expect, drainTokenizer(tokenizer))
+		assert.Equal(t, 0, cache.lexed, "a cache hit must skip lexing")
+	}
+
+	// A modification invalidates the cached tokens
+	if err := os.WriteFile(filename, []byte("y := 2"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenizer, err = cache.Tokenizer(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Token{
+			{TokenIdentifier, "y", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "2", nil},
+		}, drainTokenizer(tokenizer))
+		assert.Equal(t, 1, cache.lexed)
+	}
+}
+
+func TestTokenCacheCompile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "main.mq")
+
+	if err := os.WriteFile(filename, []byte("func main() {\nx := y\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewTokenCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCompiler(linuxTarget)
+	c.SetTokenCache(cache)
+
+	for i := 0; i < 2; i++ {
+		ast, err := c.Analyze(filename)
+		if assert.NoError(t, err) {
+			assert.Len(t, ast.Errors, 1)
+		}
+	}
+
+	assert.Equal(t, 1, cache.lexed)
+}
+
+func TestTokenCacheVersion(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "main.mq")
+
+	src := []byte("x := 1")
+	if err := os.WriteFile(filename, src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cache, err := NewTokenCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An entry of the unchanged file written without a version, as older builds did, must not be replayed
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	stale := &tokenCacheEntry{Hash: sha256.Sum256(src), Tokens: []Token{{TokenIdentifier, "stale", nil}}}
+	if err := gob.NewEncoder(&buf).Encode(stale); err != nil {
+		t.Fatal(err)
+	}
+
+	key := sha256.Sum256([]byte(abs))
+	if err := os.WriteFile(filepath.Join(cache.dir, hex.EncodeToString(key[:])+".gob"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tokenizer, err := cache.Tokenizer(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+		}, drainTokenizer(tokenizer))
+		assert.Equal(t, 1, cache.lexed)
+	}
+}
@@ -4,9 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	"golang.org/x/sync/errgroup"
 )
@@ -16,7 +17,9 @@ type Vendor string
 type OS string
 
 const (
-	X86_64 Arch = "x86_64"
+	X86_64  Arch = "x86_64"
+	X86     Arch = "i386"
+	AArch64 Arch = "aarch64"
 
 	Unknown Vendor = "unknown"
 
@@ -35,55 +38,525 @@ func (t Target) String() string {
 	return fmt.Sprintf("%s-%s-%s", t.Arch, t.Vendor, t.OS)
 }
 
+// WordSize returns the size in bits of the native word of the target architecture, that is, the size of pointers and
+// indices.
+func (t Target) WordSize() int {
+	if t.Arch == X86 {
+		return 32
+	}
+
+	return 64
+}
+
+// DataLayout returns the LLVM data layout string of the target, describing its endianness, mangling and the sizes and
+// alignments of the types. An empty string is returned for targets without a known layout, letting LLVM pick its
+// default.
+func (t Target) DataLayout() string {
+	switch {
+	case t.Arch == X86_64 && t.OS == Linux:
+		return "e-m:e-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128"
+	case t.Arch == X86_64 && t.OS == Darwin:
+		return "e-m:o-i64:64-f80:128-n8:16:32:64-S128"
+	case t.Arch == X86_64 && t.OS == Windows:
+		return "e-m:w-p270:32:32-p271:32:32-p272:64:64-i64:64-f80:128-n8:16:32:64-S128"
+	case t.Arch == X86 && t.OS == Linux:
+		return "e-m:e-p:32:32-p270:32:32-p271:32:32-p272:64:64-f64:32:64-f80:32-n8:16:32-S128"
+	case t.Arch == AArch64 && t.OS == Linux:
+		return "e-m:e-i8:8:32-i16:16:32-i64:64-i128:128-n32:64-S128"
+	case t.Arch == AArch64 && t.OS == Darwin:
+		return "e-m:o-i64:64-i128:128-n32:64-S128"
+	default:
+		return ""
+	}
+}
+
+// OutputMode defines the kind of binary produced by the Compiler.
+type OutputMode int
+
+const (
+	// Executable produces a program that runs from its main function
+	Executable OutputMode = iota
+	// SharedLibrary produces a dynamic library that exports all top-level functions. No main function is required.
+	SharedLibrary
+)
+
+// OptLevel is the optimization level the generated code is built with.
+type OptLevel string
+
+const (
+	// O0 disables the optimizations
+	O0 OptLevel = "O0"
+	// O1 enables the basic optimizations
+	O1 OptLevel = "O1"
+	// O2 enables most of the optimizations
+	O2 OptLevel = "O2"
+	// O3 enables all the optimizations, including the ones that trade size for speed
+	O3 OptLevel = "O3"
+	// Os optimizes for the size of the binary
+	Os OptLevel = "Os"
+)
+
+// isValid returns true if the level is one of the known optimization levels
+func (l OptLevel) isValid() bool {
+	switch l {
+	case O0, O1, O2, O3, Os:
+		return true
+	default:
+		return false
+	}
+}
+
+// sourceExt is the extension of the Maqui source files, looked for when compiling a directory
+const sourceExt = ".mq"
+
 type Compiler struct {
 	target Target
+	// mode is the kind of binary produced
+	mode OutputMode
+	// clang is the name or path of the clang executable used to build the IR
+	clang string
+	// cache is an optional token cache used instead of lexing unchanged files again
+	cache *TokenCache
+	// linter looks for likely mistakes in the analyzed files
+	linter *Linter
+	// warn is an optional handler called with each warning found
+	warn func(Warning)
+	// warningsAsErrors makes the warnings fail the compilation as if they were compile errors
+	warningsAsErrors bool
+	// irDir is the directory where the generated IR is written and kept. If empty, the IR is piped to clang instead.
+	irDir string
+	// optLevel is the optimization level passed to clang. If empty, clang's default is used.
+	optLevel OptLevel
+	// formatter renders the diagnostics for FormatDiagnostic
+	formatter DiagnosticFormatter
 }
 
 func NewCompiler(target Target) *Compiler {
 	return &Compiler{
-		target: target,
+		target:    target,
+		mode:      Executable,
+		clang:     "clang",
+		linter:    NewLinter(),
+		formatter: DefaultDiagnosticFormatter{},
+	}
+}
+
+// SetOutputMode sets the kind of binary produced by the compiler. By default, an [Executable] is produced.
+func (c *Compiler) SetOutputMode(mode OutputMode) {
+	c.mode = mode
+}
+
+// SetTokenCache sets a cache for the tokens of the compiled files. If set, the cached tokens of unchanged files are used
+// instead of lexing them again. By default, no cache is used.
+func (c *Compiler) SetTokenCache(cache *TokenCache) {
+	c.cache = cache
+}
+
+// SuppressWarning stops the compiler from reporting the warnings of the given kind, like "shadow". By default, all
+// warnings are reported.
+func (c *Compiler) SuppressWarning(kind string) {
+	c.linter.Suppress(kind)
+}
+
+// SetWarningHandler sets a function called with each warning found while analysing a file, including its imported
+// modules. Warnings don't stop the compilation. By default, warnings are only held inside the AST.
+func (c *Compiler) SetWarningHandler(handler func(Warning)) {
+	c.warn = handler
+}
+
+// SetWarningsAsErrors sets whether warnings are promoted to compile errors. If set, the warnings found are returned along
+// the compile errors, no code is generated if there's any, and the warning handler is not called. By default, warnings
+// don't stop the compilation.
+func (c *Compiler) SetWarningsAsErrors(enabled bool) {
+	c.warningsAsErrors = enabled
+}
+
+// SetDiagnosticFormatter sets how FormatDiagnostic renders the compile errors and warnings, so each consumer can get its
+// own layout. By default, the [DefaultDiagnosticFormatter] is used.
+func (c *Compiler) SetDiagnosticFormatter(formatter DiagnosticFormatter) {
+	c.formatter = formatter
+}
+
+// FormatDiagnostic renders a compile error or warning with the formatter of the compiler
+func (c *Compiler) FormatDiagnostic(err CompileError) string {
+	return c.formatter.Format(err)
+}
+
+// SetOptLevel sets the optimization level clang builds the generated code with. An error is returned if the level is
+// unknown. By default, no level is passed and clang's default is used, which doesn't optimize.
+func (c *Compiler) SetOptLevel(level OptLevel) error {
+	if !level.isValid() {
+		return fmt.Errorf("unknown optimization level %q, expected one of O0, O1, O2, O3 or Os", level)
 	}
+
+	c.optLevel = level
+	return nil
+}
+
+// KeepIR sets a directory where the generated LLVM IR is written before building it, and kept afterwards for debugging.
+// The directory is created if it doesn't exist, and the file is named after the output, like main.ll. By default, the IR
+// is piped to clang and no intermediate file is written.
+func (c *Compiler) KeepIR(dir string) {
+	c.irDir = dir
+}
+
+// OutputName returns the name of the file produced by the compiler, based on the output mode and the target OS.
+func (c *Compiler) OutputName() string {
+	if c.mode == SharedLibrary {
+		switch c.target.OS {
+		case Windows:
+			return "main.dll"
+		case Darwin:
+			return "libmain.dylib"
+		default:
+			return "libmain.so"
+		}
+	}
+
+	if c.target.OS == Windows {
+		return "main.exe"
+	}
+
+	return "main"
 }
 
 func (c *Compiler) Compile(filename string) ([]CompileError, error) {
-	lexer, err := NewLexer(filename)
+	return c.compile(c.analyze, filename, c.OutputName(), nil)
+}
+
+// CompilePackage compiles all the source files (.mq) of a directory as a single program, like Compile does with a
+// single file. The files share their globals, so any of them can use the functions declared by the others. They are
+// analysed in name order, and the subdirectories are not included. An error is returned if the directory can't be read
+// or has no source files.
+func (c *Compiler) CompilePackage(dir string) ([]CompileError, error) {
+	return c.compile(c.analyzePackage, dir, c.OutputName(), nil)
+}
+
+// Run compiles the file into a temporary executable and runs it, returning its exit code and everything it wrote to the
+// standard output. The standard error of the program is passed through. The executable is removed once it exits. If the
+// file has compile errors, nothing is run and they are returned as a [CompileErrors] error. A program terminated by a
+// signal, like after a panic, has an exit code of -1.
+func (c *Compiler) Run(filename string) (exitCode int, output string, err error) {
+	if c.mode != Executable {
+		return 0, "", errors.New("only executables can be run")
+	}
+
+	dir, err := os.MkdirTemp("", "maqui-run-")
 	if err != nil {
-		return nil, err
+		return 0, "", err
 	}
 
-	parser := NewParser(lexer)
-	analyzer := NewContextAnalyser(parser)
+	defer os.RemoveAll(dir)
 
-	global := NewGlobalSymbolTable()
-	analyzer.DefineInto(global)
+	out := filepath.Join(dir, c.OutputName())
+
+	errs, err := c.compile(c.analyze, filename, out, nil)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if len(errs) != 0 {
+		return 0, "", CompileErrors(errs)
+	}
+
+	var stdout strings.Builder
+
+	cmd := exec.Command(out)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), stdout.String(), nil
+	}
+
+	if err != nil {
+		return 0, "", err
+	}
+
+	return 0, stdout.String(), nil
+}
+
+// CompileErrors is the error returned when a file can't be built because of its compile errors.
+type CompileErrors []CompileError
+
+func (e CompileErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// CompileStream compiles the file like Compile, but instead of returning the compile errors once the analysis is over,
+// it sends each one through diag as soon as it's found. The channel is closed once the compilation finishes. If any
+// compile error is found no code is generated.
+func (c *Compiler) CompileStream(filename string, diag chan<- CompileError) error {
+	defer close(diag)
+
+	_, err := c.compile(c.analyze, filename, c.OutputName(), diag)
+	return err
+}
+
+// analysis analyses the source code at the path into an AST, sending the compile errors through diag if it's not nil
+type analysis func(path string, diag chan<- CompileError) (*AST, error)
+
+// compile is the pipeline shared by the compile methods. It analyses the path with the given analysis function, and
+// unless compile errors are found, generates its code and builds it into the binary at the out path. The compile errors
+// are returned instead, and if diag is not nil, the ones found while generating the code are also sent through it, as
+// the analysis already sends its own.
+func (c *Compiler) compile(analyze analysis, path, out string, diag chan<- CompileError) ([]CompileError, error) {
+	ast, err := analyze(path, diag)
+	if err != nil {
+		return nil, err
+	}
 
-	ast := analyzer.Do(global)
 	if len(ast.Errors) != 0 {
 		return ast.Errors, nil
 	}
 
-	gen := NewLLVMGenerator(ast)
+	gen := NewLLVMGenerator(ast, c.target)
 	ir := gen.Do()
 
-	return nil, c.build(ir)
+	if errs := gen.Errors(); len(errs) != 0 {
+		if diag != nil {
+			for _, err := range errs {
+				diag <- err
+			}
+		}
+
+		return errs, nil
+	}
+
+	return nil, c.build(ir, out)
 }
 
-func (c *Compiler) build(ir IR) error {
-	// TODO: DEVELOPMENT ONLY
-	saveIR(ir)
+// Check lexes, parses and semantically analyses the file like Analyze, but returns only the compile errors found instead
+// of the AST. No code is generated and clang isn't invoked, so it can be used to quickly validate a file. If the file is
+// valid, an empty slice is returned. The error is only set if the file couldn't be read.
+func (c *Compiler) Check(filename string) ([]CompileError, error) {
+	ast, err := c.Analyze(filename)
+	if err != nil {
+		return nil, err
+	}
 
-	outName := "main"
-	if c.target.OS == Windows {
-		outName += ".exe"
+	if ast.Errors == nil {
+		return []CompileError{}, nil
 	}
 
-	cmd := exec.Command("clang",
+	return ast.Errors, nil
+}
+
+// Analyze lexes, parses and semantically analyses the file, and returns the annotated AST. No code is generated. The
+// compile errors found are held inside the AST.
+func (c *Compiler) Analyze(filename string) (*AST, error) {
+	return c.analyze(filename, nil)
+}
+
+// analyze works as Analyze, and if diag is not nil also sends the compile errors through it as they are found. The
+// compile errors and warnings of the imported modules are added to the ones of the AST, and the warnings are passed to
+// the warning handler if one is set.
+func (c *Compiler) analyze(filename string, diag chan<- CompileError) (*AST, error) {
+	loader := newModuleLoader(c, filename, diag)
+
+	ast, err := c.analyzeFile(filename, diag, loader)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.collect(ast, loader, diag), nil
+}
+
+// AnalyzePackage works as Analyze, but over all the source files of a directory, which are analysed as a single
+// program like CompilePackage does.
+func (c *Compiler) AnalyzePackage(dir string) (*AST, error) {
+	return c.analyzePackage(dir, nil)
+}
+
+// analyzePackage works as analyze, but over all the source files of a directory. Each file is lexed and parsed on its
+// own, and their statements are merged into a single AST before the semantic analysis.
+func (c *Compiler) analyzePackage(dir string, diag chan<- CompileError) (*AST, error) {
+	files, err := packageFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	merged := &AST{
+		Filename: files[0],
+	}
+
+	for _, filename := range files {
+		tokenizer, err := c.tokenizer(filename)
+		if err != nil {
+			return nil, err
+		}
+
+		ast := NewParser(tokenizer).Run()
+		merged.Statements = append(merged.Statements, ast.Statements...)
+		merged.Ignores = append(merged.Ignores, ast.Ignores...)
+	}
+
+	// The files of the package can't import each other, as their declarations are already shared
+	loader := newModuleLoader(c, files[0], diag)
+	for _, filename := range files[1:] {
+		loader.loading[filepath.Clean(filename)] = true
+	}
+
+	ast := c.analyzeStatements(&astStream{ast: merged}, diag, loader)
+	return c.collect(ast, loader, diag), nil
+}
+
+// astStream is a SyntacticAnalyzer that replays the statements of an already parsed AST, along with its ignore
+// directives.
+type astStream struct {
+	// ast holds the statements to replay
+	ast *AST
+	// pos is the index of the next statement to replay
+	pos int
+}
+
+// Do does nothing, since the statements are already parsed
+func (s *astStream) Do() {}
+
+// Get returns the next statement of the AST, or an [EOS] once they are exhausted
+func (s *astStream) Get() Expr {
+	if s.pos >= len(s.ast.Statements) {
+		return &EOS{}
+	}
+
+	expr := s.ast.Statements[s.pos].Expr
+	s.pos++
+
+	return expr
+}
+
+// GetFilename returns the name of the file of the AST
+func (s *astStream) GetFilename() string {
+	return s.ast.Filename
+}
+
+// Ignores returns the ignore directives of the AST
+func (s *astStream) Ignores() []*IgnoreDirective {
+	return s.ast.Ignores
+}
+
+// packageFiles returns the paths of the source files of a directory, sorted by name
+func packageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, &SourceError{Path: dir, Err: err}
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == sourceExt {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no %s source files in %s", sourceExt, dir)
+	}
+
+	return files, nil
+}
+
+// collect adds the compile errors and warnings of the modules imported through the loader to the ones of the AST, and
+// passes the warnings to the warning handler if one is set. The warnings are added as errors instead if the compiler
+// treats them as such.
+func (c *Compiler) collect(ast *AST, loader *moduleLoader, diag chan<- CompileError) *AST {
+	if len(loader.errors) != 0 {
+		ast.Errors = append(ast.Errors, loader.errors...)
+		sortErrors(ast.Errors)
+	}
+
+	ast.Warnings = append(ast.Warnings, loader.warnings...)
+
+	if c.warningsAsErrors && len(ast.Warnings) != 0 {
+		for _, w := range ast.Warnings {
+			ast.Errors = append(ast.Errors, w)
+			if diag != nil {
+				diag <- w
+			}
+		}
+
+		ast.Warnings = nil
+		sortErrors(ast.Errors)
+	}
+
+	if c.warn != nil {
+		for _, w := range ast.Warnings {
+			c.warn(w)
+		}
+	}
+
+	return ast
+}
+
+// analyzeFile analyses a single file, resolving its imports through the loader
+func (c *Compiler) analyzeFile(filename string, diag chan<- CompileError, loader ModuleLoader) (*AST, error) {
+	tokenizer, err := c.tokenizer(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.analyzeStatements(NewParser(tokenizer), diag, loader), nil
+}
+
+// analyzeStatements analyses the statements of the parser, resolving its imports through the loader
+func (c *Compiler) analyzeStatements(parser SyntacticAnalyzer, diag chan<- CompileError, loader ModuleLoader) *AST {
+	analyzer := NewContextAnalyser(parser)
+	analyzer.ReportTo(diag)
+	analyzer.SetModuleLoader(loader)
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+
+	ast := analyzer.Do(global)
+	ast.Warnings = c.linter.Do(ast)
+
+	return ast
+}
+
+// tokenizer returns the tokenizer of the file, taken from the token cache if one is set
+func (c *Compiler) tokenizer(filename string) (Tokenizer, error) {
+	if c.cache != nil {
+		return c.cache.Tokenizer(filename)
+	}
+
+	lexer, err := NewLexer(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return lexer, nil
+}
+
+// build runs clang over the IR, producing the binary at the out path
+func (c *Compiler) build(ir IR, out string) error {
+	args := []string{
 		"-x",
 		"ir",
-		"--target="+c.target.String(),
-		"-o", outName,
-		"-",
-	)
+		"--target=" + c.target.String(),
+		"-o", out,
+	}
+
+	if c.optLevel != "" {
+		args = append(args, "-"+string(c.optLevel))
+	}
+
+	if c.mode == SharedLibrary {
+		args = append(args, "-shared", "-fPIC")
+	}
+
+	if c.irDir != "" {
+		return c.buildFile(ir, out, args)
+	}
+
+	cmd := exec.Command(c.clang, append(args, "-")...)
 
 	r, w := io.Pipe()
 	cmd.Stdin = r
@@ -100,7 +573,11 @@ func (c *Compiler) build(ir IR) error {
 
 	errs.Go(func() error {
 		if cmdOut, err := cmd.CombinedOutput(); err != nil {
-			return errors.New(fmt.Sprintf("%v: %s", err, cmdOut))
+			err = errors.New(fmt.Sprintf("%v: %s", err, cmdOut))
+
+			// Unblock the writer in case clang failed before reading the whole IR
+			_ = r.CloseWithError(err)
+			return err
 		}
 
 		return nil
@@ -109,10 +586,21 @@ func (c *Compiler) build(ir IR) error {
 	return errs.Wait()
 }
 
-// TODO: DEVELOPMENT ONLY
-func saveIR(ir IR) {
-	err := os.WriteFile("main.ll", []byte(ir.String()), fs.ModePerm)
-	if err != nil {
-		panic(err.Error())
+// buildFile writes the IR into the IR directory, named after the out path, and runs clang over the written file
+func (c *Compiler) buildFile(ir IR, out string, args []string) error {
+	if err := os.MkdirAll(c.irDir, 0o755); err != nil {
+		return err
+	}
+
+	base := filepath.Base(out)
+	path := filepath.Join(c.irDir, strings.TrimSuffix(base, filepath.Ext(base))+".ll")
+	if err := os.WriteFile(path, []byte(ir.String()), 0o644); err != nil {
+		return err
 	}
+
+	if cmdOut, err := exec.Command(c.clang, append(args, path)...).CombinedOutput(); err != nil {
+		return errors.New(fmt.Sprintf("%v: %s", err, cmdOut))
+	}
+
+	return nil
 }
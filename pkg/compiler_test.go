@@ -0,0 +1,564 @@
+package maqui
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompileStream(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.mq")
+	err := os.WriteFile(filename, []byte("func main() {\na := b\nc := d\n}\nfunc foo() {\ne := f\n}"), 0o644)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The channel is unbuffered, so the compiler can't finish before all diagnostics are received
+	diag := make(chan CompileError)
+	done := make(chan error, 1)
+
+	c := NewCompiler(linuxTarget)
+	go func() {
+		done <- c.CompileStream(filename, diag)
+	}()
+
+	first, ok := <-diag
+	if !assert.True(t, ok, "expected a diagnostic") {
+		return
+	}
+
+	assert.Equal(t, &UndefinedError{Name: "b"}, stripErrorLocation(first))
+
+	select {
+	case <-done:
+		assert.Fail(t, "compilation finished before the remaining diagnostics were received")
+	default:
+	}
+
+	var rest []CompileError
+	for err := range diag {
+		rest = append(rest, stripErrorLocation(err))
+	}
+
+	assert.Equal(t, []CompileError{
+		&UndefinedError{Name: "d"},
+		&UndefinedError{Name: "f"},
+	}, rest)
+	assert.NoError(t, <-done)
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	bad := filepath.Join(dir, "bad.mq")
+	if !assert.NoError(t, os.WriteFile(bad, []byte("func main() {\na := b\n}"), 0o644)) {
+		return
+	}
+
+	good := filepath.Join(dir, "good.mq")
+	if !assert.NoError(t, os.WriteFile(good, []byte("func main() {\na := 1\n}"), 0o644)) {
+		return
+	}
+
+	// The clang executable doesn't exist, so the check would fail if it tried to build the file
+	c := NewCompiler(linuxTarget)
+	c.clang = filepath.Join(dir, "clang")
+
+	errs, err := c.Check(bad)
+	if assert.NoError(t, err) && assert.Len(t, errs, 1) {
+		assert.Equal(t, &UndefinedError{Name: "b"}, stripErrorLocation(errs[0]))
+	}
+
+	errs, err = c.Check(good)
+	if assert.NoError(t, err) {
+		assert.NotNil(t, errs)
+		assert.Empty(t, errs)
+	}
+
+	_, err = c.Check(filepath.Join(dir, "missing.mq"))
+	assert.Error(t, err)
+}
+
+// gccFormatter renders the diagnostics in a GCC-like layout, as file: error: message
+type gccFormatter struct{}
+
+func (gccFormatter) Format(err CompileError) string {
+	loc := err.GetLocation()
+	return fmt.Sprintf("%s: %s: %s", filepath.Base(loc.File), SeverityOf(err), strings.TrimPrefix(err.String(), loc.String()+" "))
+}
+
+func TestDiagnosticFormatter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.mq")
+	if !assert.NoError(t, os.WriteFile(filename, []byte("func main() {\na := b\n}"), 0o644)) {
+		return
+	}
+
+	c := NewCompiler(linuxTarget)
+
+	errs, err := c.Check(filename)
+	if !assert.NoError(t, err) || !assert.Len(t, errs, 1) {
+		return
+	}
+
+	// By default, the diagnostics are rendered as their String
+	assert.Equal(t, errs[0].String(), c.FormatDiagnostic(errs[0]))
+
+	c.SetDiagnosticFormatter(gccFormatter{})
+	assert.Equal(t, "main.mq: error: undefined: b", c.FormatDiagnostic(errs[0]))
+}
+
+func TestCompileMissingSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing.mq")
+
+	_, err := NewCompiler(linuxTarget).Compile(path)
+
+	var sourceErr *SourceError
+	if assert.ErrorAs(t, err, &sourceErr) {
+		assert.Equal(t, path, sourceErr.Path)
+	}
+
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.EqualError(t, err, "source not found: "+path)
+
+	// Files that can't be read are told apart from the missing ones
+	err = &SourceError{Path: path, Err: &fs.PathError{Op: "open", Path: path, Err: fs.ErrPermission}}
+	assert.EqualError(t, err, "permission denied reading the source "+path)
+	assert.NotErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCompileImport(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.mq": "import \"lib/util.mq\"\nfunc main() {\nutil.foo()\nbar()\n}\nfunc bar() {}",
+		// The module has its own bar, and imports another module through a path relative to itself
+		"lib/util.mq": "import \"math.mq\"\nexport func foo() {\nbar()\nmath.bar()\n}\nfunc bar() {}",
+		"lib/math.mq": "export func bar() {}",
+	}
+
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755)) || !assert.NoError(t, os.WriteFile(path, []byte(src), 0o644)) {
+			return
+		}
+	}
+
+	ast, err := NewCompiler(linuxTarget).Analyze(filepath.Join(dir, "main.mq"))
+	if !assert.NoError(t, err) || !assert.Empty(t, ast.Errors) {
+		return
+	}
+
+	gen := NewLLVMGenerator(ast, linuxTarget)
+	mod := gen.Do().String()
+	if !assert.Empty(t, gen.Errors()) {
+		return
+	}
+
+	// The functions of each module get their own symbols
+	assert.Contains(t, mod, "define void @maqui_bar()")
+	assert.Contains(t, mod, "define void @maqui_util.bar()")
+	assert.Contains(t, mod, "define void @maqui_math.bar()")
+	assert.Contains(t, mod, "call void @maqui_util.foo()")
+	assert.Contains(t, mod, "call void @maqui_util.bar()")
+	assert.Contains(t, mod, "call void @maqui_math.bar()")
+}
+
+func TestCompilePackage(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	pkg := filepath.Join(dir, "pkg")
+	files := map[string]string{
+		"main.mq":       "func main() {\nprint(answer())\n}",
+		"answer.mq":     "func answer() (r int) {\nr := 42\n}",
+		"notes.txt":     "not a source file",
+		"sub/nested.mq": "func answer() {}",
+	}
+
+	for name, src := range files {
+		path := filepath.Join(pkg, name)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755)) || !assert.NoError(t, os.WriteFile(path, []byte(src), 0o644)) {
+			return
+		}
+	}
+
+	irDir := filepath.Join(dir, "ir")
+
+	comp := NewCompiler(linuxTarget)
+	comp.clang = stubClang(t, dir)
+	comp.KeepIR(irDir)
+
+	compileErrs, err := comp.CompilePackage(pkg)
+	assert.NoError(t, err)
+	assert.Empty(t, compileErrs)
+
+	// Both files are built into a single program
+	ir, err := os.ReadFile(filepath.Join(irDir, "main.ll"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(ir), "define void @main()")
+		assert.Contains(t, string(ir), "define i32 @maqui_answer()")
+		assert.Contains(t, string(ir), "call i32 @maqui_answer()")
+	}
+
+	// The errors point to the file they are found in
+	if !assert.NoError(t, os.WriteFile(filepath.Join(pkg, "answer.mq"), []byte("func answer() (r int) {\nr := x\n}"), 0o644)) {
+		return
+	}
+
+	compileErrs, err = comp.CompilePackage(pkg)
+	if assert.NoError(t, err) && assert.Len(t, compileErrs, 1) {
+		assert.Equal(t, filepath.Join(pkg, "answer.mq"), compileErrs[0].GetLocation().File)
+	}
+
+	// Each file is parsed on its own, so a statement can't continue into the next file
+	if !assert.NoError(t, os.WriteFile(filepath.Join(pkg, "answer.mq"), []byte("func answer() (r int) {\nr := 42\n}\nx := 1 +"), 0o644)) ||
+		!assert.NoError(t, os.WriteFile(filepath.Join(pkg, "main.mq"), []byte("2\nfunc main() {\nprint(answer())\n}"), 0o644)) {
+		return
+	}
+
+	ast, err := comp.AnalyzePackage(pkg)
+	if assert.NoError(t, err) && assert.Len(t, ast.Errors, 2) {
+		assert.IsType(t, &BadExprError{}, ast.Errors[0])
+		assert.Equal(t, filepath.Join(pkg, "answer.mq"), ast.Errors[0].GetLocation().File)
+		assert.IsType(t, &TopLevelExpressionError{}, ast.Errors[1])
+		assert.Equal(t, filepath.Join(pkg, "main.mq"), ast.Errors[1].GetLocation().File)
+	}
+
+	_, err = comp.CompilePackage(filepath.Join(pkg, "sub", "missing"))
+	assert.Error(t, err)
+
+	_, err = comp.CompilePackage(irDir)
+	assert.EqualError(t, err, "no .mq source files in "+irDir)
+}
+
+func TestCompileImportErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.mq": "import \"a.mq\"\nimport \"missing.mq\"\nfunc main() {\na.foo()\n}",
+		"a.mq":    "import \"main.mq\"\nexport func foo() {\nx := y\n}",
+	}
+
+	for name, src := range files {
+		if !assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644)) {
+			return
+		}
+	}
+
+	errs, err := NewCompiler(linuxTarget).Check(filepath.Join(dir, "main.mq"))
+	if !assert.NoError(t, err) || !assert.Len(t, errs, 3) {
+		return
+	}
+
+	// The errors of the imported modules are reported along with the ones of the importer
+	assert.Equal(t, "a.mq", filepath.Base(errs[0].GetLocation().File))
+	assert.Contains(t, errs[0].String(), ErrImportCycle.Error())
+	assert.Equal(t, &UndefinedError{Name: "y"}, stripErrorLocation(errs[1]))
+	assert.Contains(t, errs[2].String(), `can't import "missing.mq"`)
+}
+
+func TestCompileImportSameName(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"main.mq":   "import \"a/util.mq\"\nimport \"b/util.mq\"\nfunc main() {\nutil.foo()\n}",
+		"a/util.mq": "export func foo() {}",
+		"b/util.mq": "export func foo() {}",
+	}
+
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if !assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755)) || !assert.NoError(t, os.WriteFile(path, []byte(src), 0o644)) {
+			return
+		}
+	}
+
+	// Modules of the same name would get the same symbols, so only the first one is loaded
+	errs, err := NewCompiler(linuxTarget).Check(filepath.Join(dir, "main.mq"))
+	if assert.NoError(t, err) && assert.Len(t, errs, 1) {
+		assert.Contains(t, errs[0].String(), "module name 'util' is already used by "+filepath.Join(dir, "a", "util.mq"))
+	}
+}
+
+// stripErrorLocation removes the location of an *UndefinedError so it can be compared
+func stripErrorLocation(err CompileError) CompileError {
+	if e, ok := err.(*UndefinedError); ok {
+		e.Loc = nil
+	}
+
+	return err
+}
+
+// stubClang writes a fake clang executable into dir that records its arguments into the "args" file of the working
+// directory, and returns its path.
+func stubClang(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "clang")
+	err := os.WriteFile(path, []byte("#!/bin/sh\necho \"$@\" > args\ncat > /dev/null\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCompileSharedLibrary(t *testing.T) {
+	cases := []struct {
+		name   string
+		mode   OutputMode
+		os     OS
+		expect string
+	}{
+		{"ExecutableLinux", Executable, Linux, "-x ir --target=x86_64-unknown-linux -o main -"},
+		{"ExecutableWindows", Executable, Windows, "-x ir --target=x86_64-unknown-windows64 -o main.exe -"},
+		{"SharedLinux", SharedLibrary, Linux, "-x ir --target=x86_64-unknown-linux -o libmain.so -shared -fPIC -"},
+		{"SharedDarwin", SharedLibrary, Darwin, "-x ir --target=x86_64-unknown-darwin -o libmain.dylib -shared -fPIC -"},
+		{"SharedWindows", SharedLibrary, Windows, "-x ir --target=x86_64-unknown-windows64 -o main.dll -shared -fPIC -"},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// The compiler writes its output to the working directory
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			filename := filepath.Join(dir, "lib.mq")
+			if err := os.WriteFile(filename, []byte("func foo() {\nprint(1)\n}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			comp := NewCompiler(Target{Arch: X86_64, Vendor: Unknown, OS: c.os})
+			comp.SetOutputMode(c.mode)
+			comp.clang = stubClang(t, dir)
+
+			compileErrs, err := comp.Compile(filename)
+			assert.NoError(t, err)
+			assert.Empty(t, compileErrs)
+
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			if assert.NoError(t, err) {
+				assert.Equal(t, c.expect+"\n", string(args))
+			}
+		})
+	}
+}
+
+func TestOptLevel(t *testing.T) {
+	cases := []struct {
+		name   string
+		level  OptLevel
+		expect string
+	}{
+		{"Default", "", "-x ir --target=x86_64-unknown-linux -o main -"},
+		{"O0", O0, "-x ir --target=x86_64-unknown-linux -o main -O0 -"},
+		{"O2", O2, "-x ir --target=x86_64-unknown-linux -o main -O2 -"},
+		{"O3", O3, "-x ir --target=x86_64-unknown-linux -o main -O3 -"},
+		{"Os", Os, "-x ir --target=x86_64-unknown-linux -o main -Os -"},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			filename := filepath.Join(dir, "main.mq")
+			if err := os.WriteFile(filename, []byte("func main() {\nprint(1)\n}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			comp := NewCompiler(linuxTarget)
+			comp.clang = stubClang(t, dir)
+			if c.level != "" {
+				assert.NoError(t, comp.SetOptLevel(c.level))
+			}
+
+			compileErrs, err := comp.Compile(filename)
+			assert.NoError(t, err)
+			assert.Empty(t, compileErrs)
+
+			args, err := os.ReadFile(filepath.Join(dir, "args"))
+			if assert.NoError(t, err) {
+				assert.Equal(t, c.expect+"\n", string(args))
+			}
+		})
+	}
+
+	// Unknown levels are rejected, keeping the previous one
+	comp := NewCompiler(linuxTarget)
+	assert.NoError(t, comp.SetOptLevel(O1))
+	assert.EqualError(t, comp.SetOptLevel("O4"), `unknown optimization level "O4", expected one of O0, O1, O2, O3 or Os`)
+	assert.EqualError(t, comp.SetOptLevel(""), `unknown optimization level "", expected one of O0, O1, O2, O3 or Os`)
+	assert.Equal(t, O1, comp.optLevel)
+}
+
+func TestKeepIR(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	filename := filepath.Join(dir, "main.mq")
+	if err := os.WriteFile(filename, []byte("func main() {\nprint(1)\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	irDir := filepath.Join(dir, "build", "ir")
+
+	comp := NewCompiler(linuxTarget)
+	comp.clang = stubClang(t, dir)
+	comp.KeepIR(irDir)
+
+	compileErrs, err := comp.Compile(filename)
+	assert.NoError(t, err)
+	assert.Empty(t, compileErrs)
+
+	// clang builds the kept file instead of reading from the pipe
+	path := filepath.Join(irDir, "main.ll")
+	args, err := os.ReadFile(filepath.Join(dir, "args"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "-x ir --target=x86_64-unknown-linux -o main "+path+"\n", string(args))
+	}
+
+	ir, err := os.ReadFile(path)
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(ir), "define void @main()")
+		assert.Contains(t, string(ir), "call void @maqui.print(i64 1)")
+	}
+
+	// Without the option no intermediate file is written
+	comp.KeepIR("")
+	if err := os.RemoveAll(irDir); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = comp.Compile(filename)
+	assert.NoError(t, err)
+	assert.NoDirExists(t, irDir)
+	assert.NoFileExists(t, filepath.Join(dir, "main.ll"))
+}
+
+func TestCompileClangFailure(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	filename := filepath.Join(dir, "main.mq")
+	if err := os.WriteFile(filename, []byte("func main() {\nprint(1)\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// clang exits without reading its input, which must not block the compiler
+	comp := NewCompiler(linuxTarget)
+	comp.clang = "false"
+
+	_, err = comp.Compile(filename)
+	assert.Error(t, err)
+}
+
+func TestRun(t *testing.T) {
+	if _, err := exec.LookPath("clang"); err != nil {
+		t.Skip("clang is not installed")
+	}
+
+	filename := filepath.Join(t.TempDir(), "main.mq")
+	if err := os.WriteFile(filename, []byte("func main() {\nprint(1)\nprintln(2)\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// main doesn't return a value, so its exit code is not checked
+	_, output, err := NewCompiler(linuxTarget).Run(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "12\n", output)
+}
+
+func TestRunExitCode(t *testing.T) {
+	dir := t.TempDir()
+
+	filename := filepath.Join(dir, "main.mq")
+	if err := os.WriteFile(filename, []byte("func main() {\nprint(1)\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake clang builds a program that prints and fails, and records where it was built
+	clang := filepath.Join(dir, "clang")
+	script := "#!/bin/sh\nwhile [ \"$1\" != \"-o\" ]; do shift; done\necho \"$2\" > " + filepath.Join(dir, "out") + "\n" +
+		"printf '#!/bin/sh\\necho out\\nexit 3\\n' > \"$2\"\nchmod +x \"$2\"\ncat > /dev/null\n"
+	if err := os.WriteFile(clang, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	comp := NewCompiler(linuxTarget)
+	comp.clang = clang
+
+	exitCode, output, err := comp.Run(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, exitCode)
+	assert.Equal(t, "out\n", output)
+
+	// The executable is removed once it exits
+	out, err := os.ReadFile(filepath.Join(dir, "out"))
+	if assert.NoError(t, err) {
+		assert.NoFileExists(t, strings.TrimSpace(string(out)))
+	}
+}
+
+func TestRunCompileErrors(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.mq")
+	if err := os.WriteFile(filename, []byte("func main() {\na := b\n}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	comp := NewCompiler(linuxTarget)
+	comp.clang = "false"
+
+	_, _, err := comp.Run(filename)
+
+	var compileErrs CompileErrors
+	if assert.ErrorAs(t, err, &compileErrs) {
+		assert.Len(t, compileErrs, 1)
+		assert.Contains(t, err.Error(), "undefined: b")
+	}
+}
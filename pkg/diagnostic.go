@@ -0,0 +1,151 @@
+package maqui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// Underline renders the line of the source code where the location starts, followed by a line with a caret (^~~~)
+// underlining the span of the location. Spans longer than the line are underlined up to its end. Tabs are kept in the
+// padding, so the caret stays aligned no matter the tab width. If the location is nil or out of the source, an empty
+// string is returned.
+func Underline(src []byte, loc *Location) string {
+	if loc == nil || loc.Start > uint64(len(src)) {
+		return ""
+	}
+
+	lineStart := bytes.LastIndexByte(src[:loc.Start], '\n') + 1
+
+	lineEnd := len(src)
+	if i := bytes.IndexByte(src[loc.Start:], '\n'); i != -1 {
+		lineEnd = int(loc.Start) + i
+	}
+
+	line := strings.TrimSuffix(string(src[lineStart:lineEnd]), "\r")
+
+	var padding strings.Builder
+	for _, r := range string(src[lineStart:loc.Start]) {
+		if r == '\t' {
+			padding.WriteRune('\t')
+			continue
+		}
+
+		padding.WriteRune(' ')
+	}
+
+	end := int(loc.End)
+	if end > lineEnd {
+		end = lineEnd
+	}
+
+	width := 1
+	if end > int(loc.Start) {
+		width = utf8.RuneCount(src[loc.Start:end])
+	}
+
+	return line + "\n" + padding.String() + "^" + strings.Repeat("~", width-1) + "\n"
+}
+
+// DiagnosticFormatter renders compile errors and warnings as text, like in a GCC-style layout or with colors for a
+// terminal. It's set on a [Compiler] with SetDiagnosticFormatter.
+type DiagnosticFormatter interface {
+	// Format returns the text of the diagnostic
+	Format(err CompileError) string
+}
+
+// DefaultDiagnosticFormatter renders the diagnostics as their String method does, prefixed by their location.
+type DefaultDiagnosticFormatter struct{}
+
+// Format returns the String of the diagnostic
+func (DefaultDiagnosticFormatter) Format(err CompileError) string {
+	return err.String()
+}
+
+// Diagnostic is the structured form of a CompileError, meant to be serialized as JSON for CI systems and editors.
+type Diagnostic struct {
+	// Code is the name of the kind of diagnostic, like "UndefinedError"
+	Code string `json:"code"`
+	// Severity is either "error" or "warning"
+	Severity string `json:"severity"`
+	// Message describes the diagnostic, without its location
+	Message string `json:"message"`
+	// File is the path of the source file the diagnostic was found in. It's empty if the location is unknown.
+	File string `json:"file"`
+	// Line is the line where the diagnostic starts, starting from 1. It's 0 if the location is unknown.
+	Line int `json:"line"`
+	// Column is the column where the diagnostic starts, in characters and starting from 1. It's 0 if the location is
+	// unknown.
+	Column int `json:"column"`
+	// Span holds the byte offsets of the start and end of the diagnostic. It's nil if the location is unknown.
+	Span *Span `json:"span,omitempty"`
+}
+
+// Span is a range of bytes of a source file.
+type Span struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// NewDiagnostic creates the structured form of a compile error. The source of the file the error was found in is used to
+// find its line and column. If src is nil, they are left as 0. Locations set by a line directive keep their line, and
+// their column is left as 0, since their offsets point to another file.
+func NewDiagnostic(err CompileError, src []byte) Diagnostic {
+	d := Diagnostic{
+		Code:     reflect.Indirect(reflect.ValueOf(err)).Type().Name(),
+		Severity: SeverityOf(err).String(),
+	}
+
+	// The messages are prefixed by their location, which is printed as <nil> if unknown
+	loc := err.GetLocation()
+	d.Message = strings.TrimPrefix(err.String(), fmt.Sprintf("%s ", loc))
+
+	if loc == nil {
+		return d
+	}
+
+	d.File = loc.File
+	d.Span = &Span{Start: loc.Start, End: loc.End}
+
+	if loc.Line != 0 {
+		d.Line = int(loc.Line)
+		return d
+	}
+
+	if src != nil && loc.Start <= uint64(len(src)) {
+		lineStart := bytes.LastIndexByte(src[:loc.Start], '\n') + 1
+
+		d.Line = bytes.Count(src[:lineStart], []byte{'\n'}) + 1
+		d.Column = utf8.RuneCount(src[lineStart:loc.Start]) + 1
+	}
+
+	return d
+}
+
+// MarshalDiagnostics serializes the compile errors as a JSON array of [Diagnostic]. The source files of the errors are
+// read to find their lines and columns. The ones that can't be read get a line and column of 0. An empty array is
+// returned if there are no errors.
+func MarshalDiagnostics(errs []CompileError) ([]byte, error) {
+	sources := make(map[string][]byte)
+
+	diagnostics := make([]Diagnostic, 0, len(errs))
+	for _, err := range errs {
+		var src []byte
+		if loc := err.GetLocation(); loc != nil {
+			if _, read := sources[loc.File]; !read {
+				// Unreadable files are kept as nil so they aren't read again
+				sources[loc.File], _ = os.ReadFile(loc.File)
+			}
+
+			src = sources[loc.File]
+		}
+
+		diagnostics = append(diagnostics, NewDiagnostic(err, src))
+	}
+
+	return json.MarshalIndent(diagnostics, "", "  ")
+}
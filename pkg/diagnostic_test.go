@@ -0,0 +1,83 @@
+package maqui
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnderline(t *testing.T) {
+	src := []byte("func main() {\n\tx := 1\n    prnt(x)\n}\n")
+
+	cases := []struct {
+		name   string
+		loc    *Location
+		expect string
+	}{
+		{"Span", &Location{Start: 26, End: 30}, "    prnt(x)\n    ^~~~\n"},
+		{"Tabs", &Location{Start: 15, End: 16}, "\tx := 1\n\t^\n"},
+		{"FirstLine", &Location{Start: 0, End: 4}, "func main() {\n^~~~\n"},
+		{"Empty", &Location{Start: 5, End: 5}, "func main() {\n     ^\n"},
+		{"MultiLine", &Location{Start: 12, End: 20}, "func main() {\n            ^\n"},
+		{"Nil", nil, ""},
+		{"OutOfSource", &Location{Start: 100, End: 101}, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, Underline(src, c.loc))
+		})
+	}
+}
+
+func TestUnderlineCompileError(t *testing.T) {
+	src := "func main() {\n    x := 1\n    prnt(x)\n    y := x + zz\n}"
+
+	ast, _ := analyze(src)
+	if !assert.Len(t, ast.Errors, 2) {
+		return
+	}
+
+	assert.Equal(t, "    prnt(x)\n    ^~~~\n", Underline([]byte(src), ast.Errors[0].GetLocation()))
+	assert.Equal(t, "    y := x + zz\n             ^~\n", Underline([]byte(src), ast.Errors[1].GetLocation()))
+}
+
+func TestMarshalDiagnostics(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "main.mq")
+	if err := os.WriteFile(filename, []byte("func main() {\n\tx := y\n\tprnt(x)\n}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	compileErrs, err := NewCompiler(linuxTarget).Check(filename)
+	if !assert.NoError(t, err) || !assert.Len(t, compileErrs, 2) {
+		return
+	}
+
+	out, err := MarshalDiagnostics(compileErrs)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	file, _ := json.Marshal(filename)
+	expect := `[
+		{"code": "UndefinedError", "severity": "error", "message": "undefined: y", "file": ` + string(file) + `, "line": 2, "column": 7, "span": {"start": 20, "end": 21}},
+		{"code": "UndefinedError", "severity": "error", "message": "undefined: prnt (did you mean 'print'?)", "file": ` + string(file) + `, "line": 3, "column": 2, "span": {"start": 23, "end": 27}}
+	]`
+	assert.JSONEq(t, expect, string(out))
+
+	// Errors without a location have no position
+	out, err = MarshalDiagnostics([]CompileError{&TopLevelExpressionError{}})
+	if assert.NoError(t, err) {
+		expect := `[{"code": "TopLevelExpressionError", "severity": "error", "message": "top-level expression: only declarations are allowed outside of a function", "file": "", "line": 0, "column": 0}]`
+		assert.JSONEq(t, expect, string(out))
+	}
+
+	// No errors serialize as an empty array
+	out, err = MarshalDiagnostics(nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[]", string(out))
+	}
+}
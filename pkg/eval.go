@@ -0,0 +1,387 @@
+package maqui
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrDivisionByZero is returned by [Eval] when a constant integer is divided by zero
+var ErrDivisionByZero = errors.New("division by zero")
+
+// ErrOverflow is returned by [Eval] when the result of a constant integer operation doesn't fit in its type
+var ErrOverflow = errors.New("integer overflow")
+
+// Eval computes the value of a constant expression. The expression must be made only of literals and the operations
+// over them, so *LiteralExpr, *BinaryExpr, *BooleanExpr and *UnaryExpr. Any other expression, like an *Identifier, is
+// not constant and an error is returned.
+//
+// Integers evaluate to an int64, floating point numbers to a float64, strings to a string and booleans to a bool. An
+// integer operated with a float is converted to a float, as the generated code does. Integers are operated in the width
+// of their type, as the generated code does too: an int is 32 bits wide, unless operated with an int64. Integer
+// operations report an [ErrOverflow] if the result doesn't fit in its type, and an [ErrDivisionByZero] if divided by
+// zero.
+func Eval(expr Expr) (any, error) {
+	v, err := evalExpr(expr)
+	if n, isInt := v.(int32); isInt {
+		return int64(n), err
+	}
+
+	return v, err
+}
+
+// evalExpr computes the value of a constant expression as described by [Eval], but the values of type int are kept as
+// an int32, so they are operated in their width
+func evalExpr(expr Expr) (any, error) {
+	switch e := expr.(type) {
+	case *LiteralExpr:
+		return evalLiteral(e)
+	case *BinaryExpr:
+		v1, err := evalExpr(e.Op1)
+		if err != nil {
+			return nil, err
+		}
+
+		v2, err := evalExpr(e.Op2)
+		if err != nil {
+			return nil, err
+		}
+
+		return evalBinary(e.Operation, v1, v2)
+	case *BooleanExpr:
+		v1, err := evalExpr(e.Op1)
+		if err != nil {
+			return nil, err
+		}
+
+		v2, err := evalExpr(e.Op2)
+		if err != nil {
+			return nil, err
+		}
+
+		return evalBoolean(e.Operation, v1, v2)
+	case *UnaryExpr:
+		v, err := evalExpr(e.Operand)
+		if err != nil {
+			return nil, err
+		}
+
+		return evalUnary(e.Operation, v)
+	default:
+		return nil, fmt.Errorf("not a constant expression: %T", expr)
+	}
+}
+
+// EvalResult is the value of a constant expression along with its type.
+type EvalResult struct {
+	// Value is the value computed by [Eval]
+	Value any
+	// Type is the type the semantic analysis resolved for the expression
+	Type Type
+}
+
+// String formats the result as value:type, like 14:int. Strings are quoted, as in "ab":string.
+func (r EvalResult) String() string {
+	if s, isString := r.Value.(string); isString {
+		return strconv.Quote(s) + ":" + r.Type.String()
+	}
+
+	return fmt.Sprintf("%v:%s", r.Value, r.Type)
+}
+
+// EvalSource computes the value of the source code of a single constant expression, like 2 + 3 * 4, for calculator-like
+// uses. The source goes through the lexer, the parser and the semantic analysis, so its compile errors are returned as
+// [CompileErrors], and then through [Eval]. Expressions with identifiers are rejected, since they are not constant.
+func EvalSource(src string) (*EvalResult, error) {
+	analyzer := NewContextAnalyser(NewParser(NewLexerFromReader(strings.NewReader(src))))
+	analyzer.AllowTopLevelExpressions(true)
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+
+	ast := analyzer.Do(global)
+	if len(ast.Errors) != 0 {
+		return nil, CompileErrors(ast.Errors)
+	}
+
+	if len(ast.Statements) != 1 || isDeclaration(ast.Statements[0].Expr) {
+		return nil, errors.New("expected a single expression")
+	}
+
+	expr := ast.Statements[0].Expr
+
+	var free *Identifier
+	Inspect(expr, func(e Expr) bool {
+		if id, isIdentifier := e.(*Identifier); isIdentifier && free == nil {
+			free = id
+		}
+
+		return free == nil
+	})
+
+	if free != nil {
+		return nil, fmt.Errorf("not a constant expression: '%s' is an identifier", free.Name)
+	}
+
+	v, err := Eval(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EvalResult{
+		Value: v,
+		Type:  ast.TypeOf(expr),
+	}, nil
+}
+
+// evalLiteral returns the value of a literal
+func evalLiteral(expr *LiteralExpr) (any, error) {
+	switch expr.Typ {
+	case LiteralString:
+		return expr.Value, nil
+	case LiteralBool:
+		return expr.Value == "true", nil
+	case LiteralNumber:
+		v, err := expr.number()
+		if errors.Is(err, strconv.ErrRange) && !isFloatLiteral(expr.Value) {
+			return nil, ErrOverflow
+		}
+
+		// Integers that fit are an int, as the semantic analysis types them
+		if n, isInt := v.(int64); isInt && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int32(n), err
+		}
+
+		return v, err
+	default:
+		return nil, fmt.Errorf("unknown literal type: %d", expr.Typ)
+	}
+}
+
+// evalBinary applies a binary operation over two constant values
+func evalBinary(op BinaryOp, v1, v2 any) (any, error) {
+	v1, v2 = promote(v1, v2)
+
+	switch a := v1.(type) {
+	case int32:
+		b, ok := v2.(int32)
+		if !ok {
+			break
+		}
+
+		r, err := evalInt(op, int64(a), int64(b))
+		if err != nil {
+			return nil, err
+		}
+
+		return narrow(r.(int64))
+	case int64:
+		b, ok := v2.(int64)
+		if !ok {
+			break
+		}
+
+		return evalInt(op, a, b)
+	case float64:
+		b, ok := v2.(float64)
+		if !ok {
+			break
+		}
+
+		switch op {
+		case BinaryAddition:
+			return a + b, nil
+		case BinarySubtraction:
+			return a - b, nil
+		case BinaryMultiplication:
+			return a * b, nil
+		case BinaryDivision:
+			return a / b, nil
+		}
+	case string:
+		b, ok := v2.(string)
+		if ok && op == BinaryAddition {
+			return a + b, nil
+		}
+	}
+
+	return nil, fmt.Errorf("undefined operation: %s %s %s", constType(v1), string(op), constType(v2))
+}
+
+// evalInt applies a binary operation over two integers, checking the result for overflows
+func evalInt(op BinaryOp, a, b int64) (any, error) {
+	switch op {
+	case BinaryAddition:
+		r := a + b
+		if (a > 0 && b > 0 && r < 0) || (a < 0 && b < 0 && r >= 0) {
+			return nil, ErrOverflow
+		}
+
+		return r, nil
+	case BinarySubtraction:
+		r := a - b
+		if (a >= 0 && b < 0 && r < 0) || (a < 0 && b > 0 && r >= 0) {
+			return nil, ErrOverflow
+		}
+
+		return r, nil
+	case BinaryMultiplication:
+		if a == 0 || b == 0 {
+			return int64(0), nil
+		}
+
+		r := a * b
+		if r/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+			return nil, ErrOverflow
+		}
+
+		return r, nil
+	case BinaryDivision:
+		if b == 0 {
+			return nil, ErrDivisionByZero
+		}
+
+		if a == math.MinInt64 && b == -1 {
+			return nil, ErrOverflow
+		}
+
+		return a / b, nil
+	case BinaryAnd:
+		return a & b, nil
+	case BinaryOr:
+		return a | b, nil
+	case BinaryXor:
+		return a ^ b, nil
+	case BinaryShiftLeft, BinaryShiftRight:
+		if b < 0 {
+			return nil, fmt.Errorf("negative shift count: %d", b)
+		}
+
+		if op == BinaryShiftLeft {
+			if b >= 64 || (a<<b)>>b != a {
+				return nil, ErrOverflow
+			}
+
+			return a << b, nil
+		}
+
+		if b >= 64 {
+			b = 63
+		}
+
+		return a >> b, nil
+	default:
+		return nil, fmt.Errorf("undefined operation: int64 %s int64", string(op))
+	}
+}
+
+// evalBoolean applies a boolean operation over two constant values
+func evalBoolean(op BooleanOp, v1, v2 any) (any, error) {
+	v1, v2 = promote(v1, v2)
+
+	switch op {
+	case BooleanEquals:
+		if fmt.Sprintf("%T", v1) != fmt.Sprintf("%T", v2) {
+			return nil, fmt.Errorf("incompatible types: %s and %s", constType(v1), constType(v2))
+		}
+
+		return v1 == v2, nil
+	default:
+		return nil, fmt.Errorf("undefined operation: %s %s %s", constType(v1), op, constType(v2))
+	}
+}
+
+// evalUnary applies a unary operation over a constant value
+func evalUnary(op UnaryOp, v any) (any, error) {
+	if op == UnaryBitwiseNot {
+		switch n := v.(type) {
+		case int32:
+			return ^n, nil
+		case int64:
+			return ^n, nil
+		}
+
+		return nil, fmt.Errorf("undefined operation: %s%s", string(op), constType(v))
+	}
+
+	if op != UnaryNegative {
+		return nil, fmt.Errorf("undefined operation: %s%s", string(op), constType(v))
+	}
+
+	switch n := v.(type) {
+	case int32:
+		if n == math.MinInt32 {
+			return nil, ErrOverflow
+		}
+
+		return -n, nil
+	case int64:
+		if n == math.MinInt64 {
+			return nil, ErrOverflow
+		}
+
+		return -n, nil
+	case float64:
+		return -n, nil
+	default:
+		return nil, fmt.Errorf("undefined operation: %s%s", string(op), constType(v))
+	}
+}
+
+// constType returns the name of the Maqui type of a constant value
+func constType(v any) string {
+	switch v.(type) {
+	case int32:
+		return "int"
+	case int64:
+		return "int64"
+	case float64:
+		return "float"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// narrow returns the result of an operation between two values of type int as an int32, or an [ErrOverflow] if it
+// doesn't fit
+func narrow(n int64) (any, error) {
+	if n < math.MinInt32 || n > math.MaxInt32 {
+		return nil, ErrOverflow
+	}
+
+	return int32(n), nil
+}
+
+// promote converts an integer operand to a float if the other operand is a float, and an int to an int64 if the other
+// operand is an int64
+func promote(v1, v2 any) (any, any) {
+	if i, isInt := v1.(int32); isInt {
+		switch v2.(type) {
+		case int64, float64:
+			v1 = int64(i)
+		}
+	}
+
+	if i, isInt := v2.(int32); isInt {
+		switch v1.(type) {
+		case int64, float64:
+			v2 = int64(i)
+		}
+	}
+
+	if i, isInt := v1.(int64); isInt {
+		if _, isFloat := v2.(float64); isFloat {
+			return float64(i), v2
+		}
+	}
+
+	if i, isInt := v2.(int64); isInt {
+		if _, isFloat := v1.(float64); isFloat {
+			return v1, float64(i)
+		}
+	}
+
+	return v1, v2
+}
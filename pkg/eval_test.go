@@ -0,0 +1,150 @@
+package maqui
+
+import (
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func numLit(v string) *LiteralExpr {
+	return &LiteralExpr{Typ: LiteralNumber, Value: v}
+}
+
+func TestEval(t *testing.T) {
+	cases := []struct {
+		name   string
+		expr   Expr
+		expect any
+	}{
+		{"Integer", numLit("42"), int64(42)},
+		{"Float", numLit("2.5"), 2.5},
+		{"String", &LiteralExpr{Typ: LiteralString, Value: "foo"}, "foo"},
+		{"Bool", &LiteralExpr{Typ: LiteralBool, Value: "false"}, false},
+		{
+			"Nested",
+			// (1 - 2) * -(3 + 4) / 2
+			&BinaryExpr{
+				Operation: BinaryDivision,
+				Op1: &BinaryExpr{
+					Operation: BinaryMultiplication,
+					Op1:       &BinaryExpr{Operation: BinarySubtraction, Op1: numLit("1"), Op2: numLit("2")},
+					Op2: &UnaryExpr{
+						Operation: UnaryNegative,
+						Operand:   &BinaryExpr{Operation: BinaryAddition, Op1: numLit("3"), Op2: numLit("4")},
+					},
+				},
+				Op2: numLit("2"),
+			},
+			int64(3),
+		},
+		{"Bitwise", &BinaryExpr{Operation: BinaryOr, Op1: &BinaryExpr{Operation: BinaryAnd, Op1: numLit("6"), Op2: numLit("3")}, Op2: numLit("8")}, int64(10)},
+		{"Shift", &BinaryExpr{Operation: BinaryShiftRight, Op1: &BinaryExpr{Operation: BinaryShiftLeft, Op1: numLit("1"), Op2: numLit("4")}, Op2: numLit("2")}, int64(4)},
+		{"BitwiseNot", &UnaryExpr{Operation: UnaryBitwiseNot, Operand: numLit("5")}, int64(-6)},
+		{"IntegerDivision", &BinaryExpr{Operation: BinaryDivision, Op1: numLit("7"), Op2: numLit("2")}, int64(3)},
+		{"MixedDivision", &BinaryExpr{Operation: BinaryDivision, Op1: numLit("7"), Op2: numLit("2.0")}, 3.5},
+		{"FloatDivisionByZero", &BinaryExpr{Operation: BinaryDivision, Op1: numLit("1.0"), Op2: numLit("0")}, math.Inf(1)},
+		{
+			"Concatenation",
+			&BinaryExpr{
+				Operation: BinaryAddition,
+				Op1:       &LiteralExpr{Typ: LiteralString, Value: "foo"},
+				Op2:       &LiteralExpr{Typ: LiteralString, Value: "bar"},
+			},
+			"foobar",
+		},
+		{
+			"Equals",
+			&BooleanExpr{
+				Operation: BooleanEquals,
+				Op1:       &BinaryExpr{Operation: BinaryAddition, Op1: numLit("1"), Op2: numLit("1")},
+				Op2:       numLit("2.0"),
+			},
+			true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := Eval(c.expr)
+			if assert.NoError(t, err) {
+				assert.Equal(t, c.expect, v)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	maxInt := strconv.FormatInt(math.MaxInt64, 10)
+
+	cases := []struct {
+		name   string
+		expr   Expr
+		expect string
+	}{
+		{"Identifier", &BinaryExpr{Operation: BinaryAddition, Op1: numLit("1"), Op2: &Identifier{Name: "x"}}, "not a constant expression: *maqui.Identifier"},
+		{"FuncCall", &FuncCall{Callee: &Identifier{Name: "foo"}}, "not a constant expression: *maqui.FuncCall"},
+		{"DivisionByZero", &BinaryExpr{Operation: BinaryDivision, Op1: numLit("1"), Op2: numLit("0")}, ErrDivisionByZero.Error()},
+		{"AdditionOverflow", &BinaryExpr{Operation: BinaryAddition, Op1: numLit(maxInt), Op2: numLit("1")}, ErrOverflow.Error()},
+		{"SubtractionOverflow", &BinaryExpr{Operation: BinarySubtraction, Op1: &UnaryExpr{Operation: UnaryNegative, Operand: numLit(maxInt)}, Op2: numLit("2")}, ErrOverflow.Error()},
+		{"MultiplicationOverflow", &BinaryExpr{Operation: BinaryMultiplication, Op1: numLit(maxInt), Op2: numLit("2")}, ErrOverflow.Error()},
+		{"LiteralOverflow", numLit("9223372036854775808"), ErrOverflow.Error()},
+		{"IntAdditionOverflow", &BinaryExpr{Operation: BinaryAddition, Op1: numLit("2147483647"), Op2: numLit("1")}, ErrOverflow.Error()},
+		{"IntShiftOverflow", &BinaryExpr{Operation: BinaryShiftLeft, Op1: numLit("1"), Op2: numLit("40")}, ErrOverflow.Error()},
+		{"IntNegationOverflow", &UnaryExpr{Operation: UnaryNegative, Operand: numLit("-2147483648")}, ErrOverflow.Error()},
+		{"StringSubtraction", &BinaryExpr{Operation: BinarySubtraction, Op1: &LiteralExpr{Typ: LiteralString, Value: "a"}, Op2: &LiteralExpr{Typ: LiteralString, Value: "b"}}, "undefined operation: string - string"},
+		{"NegativeShift", &BinaryExpr{Operation: BinaryShiftLeft, Op1: numLit("1"), Op2: &UnaryExpr{Operation: UnaryNegative, Operand: numLit("1")}}, "negative shift count: -1"},
+		{"FloatAnd", &BinaryExpr{Operation: BinaryAnd, Op1: numLit("1.0"), Op2: numLit("1")}, "undefined operation: float & float"},
+		{"FloatBitwiseNot", &UnaryExpr{Operation: UnaryBitwiseNot, Operand: numLit("5.0")}, "undefined operation: ~float"},
+		{"BoolNegation", &UnaryExpr{Operation: UnaryNegative, Operand: &LiteralExpr{Typ: LiteralBool, Value: "true"}}, "undefined operation: -bool"},
+		{"IncompatibleEquals", &BooleanExpr{Operation: BooleanEquals, Op1: numLit("1"), Op2: &LiteralExpr{Typ: LiteralString, Value: "1"}}, "incompatible types: int and string"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Eval(c.expr)
+			assert.EqualError(t, err, c.expect)
+		})
+	}
+}
+
+func TestEvalSource(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+		err    string
+	}{
+		{"Arithmetic", "2 + 3 * 4", "14:int", ""},
+		{"Concatenation", `"a" + "b"`, `"ab":string`, ""},
+		{"Float", "1 + 0.5", "1.5:float", ""},
+		{"Comparison", "1 == 1", "true:bool", ""},
+		{"Widened", "5000000000 * 2", "10000000000:int64", ""},
+		{"FreeIdentifier", "1 + x", "", "undefined: x"},
+		{"Builtin", "print", "", "not a constant expression: 'print' is an identifier"},
+		{"Declaration", "x := 1", "", "expected a single expression"},
+		{"Several", "1\n2", "", "expected a single expression"},
+		{"Overflow", "9223372036854775807 + 1", "", ErrOverflow.Error()},
+		{"IntOverflow", "2147483647 + 1", "", ErrOverflow.Error()},
+		{"IntShiftOverflow", "1 << 40", "", ErrOverflow.Error()},
+		{"MixedWidths", "2147483647 + 5000000000", "7147483647:int64", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := EvalSource(c.src)
+			if c.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), c.err)
+				}
+
+				return
+			}
+
+			if assert.NoError(t, err) {
+				assert.Equal(t, c.expect, res.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package maqui
+
+import (
+	"errors"
+	"io"
+	"strings"
+)
+
+// formatIndent is the indentation used for each nesting level of a block.
+const formatIndent = "    "
+
+// Format parses the source code provided by src and writes it to out in its canonical form. Blocks are indented one
+// level per nesting, operators are surrounded by single spaces, and parenthesis are only kept where they change the
+// parsing of an expression. If the source contains syntax errors nothing is written, and the first error is returned.
+//
+// Comments are kept, each on its own line before the statement that follows it in the source.
+func Format(src io.Reader, out io.Writer) error {
+	return format(NewParser(NewLexerFromReader(src)), out)
+}
+
+// FormatFile works as Format over the source file at the path, so the syntax errors are located in the file. If the
+// file can't be read, a *SourceError is returned.
+func FormatFile(filename string, out io.Writer) error {
+	f, err := OpenSource(filename)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	l := NewLexerFromReader(f)
+	l.filename = filename
+
+	return format(NewParser(l), out)
+}
+
+// format writes the canonical form of the source code read by the parser to out
+func format(parser *Parser, out io.Writer) error {
+	parser.PreserveComments(true)
+
+	ast := parser.Run()
+
+	for _, stmt := range ast.Statements {
+		var bad *BadExpr
+		Inspect(stmt, func(expr Expr) bool {
+			if e, ok := expr.(*BadExpr); ok && bad == nil {
+				bad = e
+			}
+
+			return bad == nil
+		})
+
+		if bad != nil {
+			return errors.New(BadExprError{Loc: bad.GetLocation(), Expr: bad}.String())
+		}
+	}
+
+	f := &formatter{}
+	for i, stmt := range ast.Statements {
+		if i != 0 && ((isFuncDecl(stmt.Expr) && !isComment(ast.Statements[i-1].Expr)) || isFuncDecl(ast.Statements[i-1].Expr)) {
+			// Separate top-level functions from their surroundings by an empty line, keeping the comments just above a
+			// function attached to it
+			f.src.WriteRune('\n')
+		}
+
+		f.statement(stmt.Expr)
+	}
+
+	_, err := io.WriteString(out, f.src.String())
+	return err
+}
+
+// isFuncDecl returns true if the expression is a function declaration
+func isFuncDecl(expr Expr) bool {
+	_, ok := expr.(*FuncDecl)
+	return ok
+}
+
+// isComment returns true if the expression is a comment
+func isComment(expr Expr) bool {
+	_, ok := expr.(*CommentExpr)
+	return ok
+}
+
+// Expression precedences, from the loosest to the tightest binding. They mirror the recursive decent of the [Parser],
+// and are used to decide when an operand needs to be parenthesised.
+const (
+	precStatement = iota
+	precConditional
+	precAdditive
+	precMultiplicative
+	precBoolean
+	precUnary
+	precPrimary
+)
+
+// formatter holds the state of the source code being formatted.
+type formatter struct {
+	// src holds the formatted source code
+	src strings.Builder
+	// depth is the current nesting level of the blocks
+	depth int
+}
+
+// line writes a full line at the current indentation level
+func (f *formatter) line(s string) {
+	f.src.WriteString(strings.Repeat(formatIndent, f.depth))
+	f.src.WriteString(s)
+	f.src.WriteRune('\n')
+}
+
+// statement formats a statement and writes it to the source
+func (f *formatter) statement(expr Expr) {
+	switch e := expr.(type) {
+	case *FuncDecl:
+		decl := "func " + e.Name + "()" + formatResults(e.Results)
+
+		if e.Exported {
+			decl = "export " + decl
+		}
+
+		if len(e.Body) == 0 {
+			f.line(decl + " {}")
+			return
+		}
+
+		f.line(decl + " {")
+		f.block(e.Body)
+		f.line("}")
+	case *IfExpr:
+		f.line("if " + f.expr(e.Condition, precStatement) + " {")
+		f.block(e.Consequent)
+
+		// An else holding only an if is printed as an else if
+		for len(e.Else) == 1 {
+			elseIf, isIf := e.Else[0].(*IfExpr)
+			if !isIf {
+				break
+			}
+
+			e = elseIf
+			f.line("} else if " + f.expr(e.Condition, precStatement) + " {")
+			f.block(e.Consequent)
+		}
+
+		if e.Else == nil {
+			f.line("}")
+			return
+		}
+
+		f.line("} else {")
+		f.block(e.Else)
+		f.line("}")
+	case *BlockExpr:
+		if len(e.Body) == 0 {
+			f.line("{}")
+			return
+		}
+
+		f.line("{")
+		f.block(e.Body)
+		f.line("}")
+	case *ExternDecl:
+		params := make([]string, len(e.Params))
+		for i, param := range e.Params {
+			params[i] = param.Name + " " + param.Type
+		}
+
+		decl := "extern func " + e.Name + "(" + strings.Join(params, ", ") + ")"
+		if len(e.Returns) != 0 {
+			decl += " " + strings.Join(e.Returns, ", ")
+		}
+
+		f.line(decl)
+	case *ImportDecl:
+		f.line("import " + quoteString(e.Path))
+	case *ReturnExpr:
+		if e.Value == nil {
+			f.line("return")
+			break
+		}
+
+		f.line("return " + f.expr(e.Value, precStatement))
+	case *DeferExpr:
+		f.line("defer " + f.expr(e.Call, precStatement))
+	case *CommentExpr:
+		f.line("//" + e.Text)
+	default:
+		f.line(f.expr(e, precStatement))
+	}
+}
+
+// formatResults formats the named results of a function, preceded by a space, or returns an empty string if it has none
+func formatResults(results []*Param) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	params := make([]string, len(results))
+	for i, result := range results {
+		params[i] = result.Name + " " + result.Type
+	}
+
+	return " (" + strings.Join(params, ", ") + ")"
+}
+
+// block formats the statements nested one level deeper than the current one
+func (f *formatter) block(exprs []Expr) {
+	f.depth++
+	for _, expr := range exprs {
+		f.statement(expr)
+	}
+	f.depth--
+}
+
+// expr formats an expression. If the expression binds looser than the minimum precedence required by its context, it
+// gets parenthesised.
+func (f *formatter) expr(expr Expr, minPrec int) string {
+	var s string
+	var prec int
+
+	switch e := expr.(type) {
+	case *VariableDecl:
+		s, prec = e.Name+" := "+f.expr(e.Value, precStatement), precStatement
+	case *MultiVariableDecl:
+		values := make([]string, len(e.Values))
+		for i, value := range e.Values {
+			values[i] = f.expr(value, precStatement)
+		}
+
+		s, prec = strings.Join(e.Names, ", ")+" := "+strings.Join(values, ", "), precStatement
+	case *FuncCall:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = f.expr(arg, precStatement)
+		}
+
+		s, prec = f.expr(e.Callee, precPrimary)+"("+strings.Join(args, ", ")+")", precPrimary
+	case *BinaryExpr:
+		prec = precAdditive
+		switch e.Operation {
+		case BinaryMultiplication, BinaryDivision, BinaryAnd, BinaryShiftLeft, BinaryShiftRight:
+			prec = precMultiplicative
+		}
+
+		// Binary operations nest to the left, so only a right operand of the same precedence needs parenthesis
+		s = f.expr(e.Op1, prec) + " " + string(e.Operation) + " " + f.expr(e.Op2, prec+1)
+	case *BooleanExpr:
+		// Comparisons nest to the left as well
+		prec = precBoolean
+		s = f.expr(e.Op1, prec) + " " + string(e.Operation) + " " + f.expr(e.Op2, prec+1)
+	case *InterpolatedString:
+		var str strings.Builder
+		for _, part := range e.Parts {
+			if lit, isLiteral := part.(*LiteralExpr); isLiteral && lit.Typ == LiteralString {
+				str.WriteString(escapeString(lit.Value))
+				continue
+			}
+
+			str.WriteString("${" + f.expr(part, precStatement) + "}")
+		}
+
+		s, prec = `"`+str.String()+`"`, precPrimary
+	case *ConditionalExpr:
+		prec = precConditional
+		s = f.expr(e.Condition, prec+1) + " ? " + f.expr(e.Consequent, prec) + " : " + f.expr(e.Alternative, prec)
+	case *UnaryExpr:
+		s, prec = string(e.Operation)+f.expr(e.Operand, precPrimary), precUnary
+	case *FuncLit:
+		s, prec = "func()"+formatResults(e.Results)+" {}", precPrimary
+		if len(e.Body) != 0 {
+			// The body is formatted at the indentation of the line holding the literal
+			body := &formatter{depth: f.depth}
+			body.block(e.Body)
+
+			s = "func()" + formatResults(e.Results) + " {\n" + body.src.String() + strings.Repeat(formatIndent, f.depth) + "}"
+		}
+	case *Identifier:
+		s, prec = e.Name, precPrimary
+	case *LiteralExpr:
+		s, prec = e.Value, precPrimary
+		if e.Typ == LiteralString {
+			s = quoteString(e.Value)
+		}
+
+		if strings.HasPrefix(s, "-") {
+			// Negative numbers bind like a negation, so -(-1) keeps its parentheses
+			prec = precUnary
+		}
+	}
+
+	if prec < minPrec {
+		return "(" + s + ")"
+	}
+
+	return s
+}
@@ -0,0 +1,275 @@
+package maqui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		fail   bool
+		expect string
+	}{
+		{
+			"EmptyMain",
+			"func main(){}",
+			false,
+			"func main() {}\n",
+		},
+		{
+			"MultiVariableDecl",
+			"func main(){\na,b:=1,(2+3)*4\n}",
+			false,
+			"func main() {\n    a, b := 1, (2 + 3) * 4\n}\n",
+		},
+		{
+			"FuncLiteral",
+			"func main(){\nf:=func()(r int){\nif true{\nr:=1\n}\n}\ng:=func(){}\n}",
+			false,
+			"func main() {\n    f := func() (r int) {\n        if true {\n            r := 1\n        }\n    }\n    g := func() {}\n}\n",
+		},
+		{
+			"NestedIf",
+			"func main() {\nx:=1*2\nif x==3 {\nif x==2 {\nprint(1)\n} else {\nprint(2)\n}\n}\nprint(3)\n}",
+			false,
+			"func main() {\n" +
+				"    x := 1 * 2\n" +
+				"    if x == 3 {\n" +
+				"        if x == 2 {\n" +
+				"            print(1)\n" +
+				"        } else {\n" +
+				"            print(2)\n" +
+				"        }\n" +
+				"    }\n" +
+				"    print(3)\n" +
+				"}\n",
+		},
+		{
+			"ElseIf",
+			"func main() {\nif 1==2 {\nprint(1)\n} else if 2==2 {\nprint(2)\n} else {\nif true {\nprint(3)\n}\n}\n}",
+			false,
+			"func main() {\n" +
+				"    if 1 == 2 {\n" +
+				"        print(1)\n" +
+				"    } else if 2 == 2 {\n" +
+				"        print(2)\n" +
+				"    } else if true {\n" +
+				"        print(3)\n" +
+				"    }\n" +
+				"}\n",
+		},
+		{
+			"Operators",
+			"x   :=   1+2*3\ny:=(1+2)*3\nz:=-(1+x)\nprint( \"foo\" ,y)",
+			false,
+			"x := 1 + 2 * 3\ny := (1 + 2) * 3\nz := -(1 + x)\nprint(\"foo\", y)\n",
+		},
+		{
+			"SeparatedFunctions",
+			"x := 1\nfunc foo() {\nprint(x)\n}\nfunc main() {\nfoo()\n}",
+			false,
+			"x := 1\n\nfunc foo() {\n    print(x)\n}\n\nfunc main() {\n    foo()\n}\n",
+		},
+		{
+			"ExportedFunction",
+			"export   func foo(){}",
+			false,
+			"export func foo() {}\n",
+		},
+		{
+			"Extern",
+			"extern func puts(s string,n int)int\nextern func abort()",
+			false,
+			"extern func puts(s string, n int) int\nextern func abort()\n",
+		},
+		{
+			"OperandOrder",
+			"x:=1-2-3\ny:=1-(2-3)\nz:=8/(4*2)\nw:=(8/4)*2",
+			false,
+			"x := 1 - 2 - 3\ny := 1 - (2 - 3)\nz := 8 / (4 * 2)\nw := 8 / 4 * 2\n",
+		},
+		{
+			"Bitwise",
+			"x:=a&b|c\ny:=a&(b|c)\nz:=(1<<4)>>2",
+			false,
+			"x := a & b | c\ny := a & (b | c)\nz := 1 << 4 >> 2\n",
+		},
+		{
+			"Conditional",
+			"x:=(a==1?1:2)+1\ny:=a?b?1:2:(b?3:4)",
+			false,
+			"x := (a == 1 ? 1 : 2) + 1\ny := a ? b ? 1 : 2 : b ? 3 : 4\n",
+		},
+		{
+			"Interpolation",
+			"s:=\"x is ${x+1} (${a?1:2})\"",
+			false,
+			"s := \"x is ${x + 1} (${a ? 1 : 2})\"\n",
+		},
+		{
+			"EscapedStrings",
+			"s:=`say \"hi\" \\ ${x}`\nt:=\"\\\"${x}\\\" \\${y}\"",
+			false,
+			"s := \"say \\\"hi\\\" \\\\ \\${x}\"\nt := \"\\\"${x}\\\" \\${y}\"\n",
+		},
+		{
+			"BareBlock",
+			"func main() {\n{\nx := 1\n}\n{}\n}",
+			false,
+			"func main() {\n    {\n        x := 1\n    }\n    {}\n}\n",
+		},
+		{
+			"Import",
+			"import   \"util.mq\"\nfunc main() {\nutil.foo(util.bar)\n}",
+			false,
+			"import \"util.mq\"\n\nfunc main() {\n    util.foo(util.bar)\n}\n",
+		},
+		{
+			"NamedResult",
+			"func answer()(result int){\nresult := 42\nreturn\n}",
+			false,
+			"func answer() (result int) {\n    result := 42\n    return\n}\n",
+		},
+		{
+			"ReturnValue",
+			"func one(){\nreturn   1+2\n}",
+			false,
+			"func one() {\n    return 1 + 2\n}\n",
+		},
+		{
+			"Defer",
+			"func main(){\ndefer   print( 1 )\n}",
+			false,
+			"func main() {\n    defer print(1)\n}\n",
+		},
+		{
+			"Comments",
+			"x := 1 // trailing\n// doc\nfunc main() {\n// inner\n}",
+			false,
+			"x := 1\n// trailing\n// doc\nfunc main() {\n    // inner\n}\n",
+		},
+		{
+			"BadExpression",
+			"func main() {\nx := )\n}",
+			true,
+			"",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out strings.Builder
+
+			err := Format(strings.NewReader(c.data), &out)
+			if c.fail {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, c.expect, out.String())
+		})
+	}
+}
+
+func TestFormatFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "bad.mq")
+
+	if err := os.WriteFile(filename, []byte("x   :=   1\ny := @"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The errors are located in the file
+	var out strings.Builder
+	err := FormatFile(filename, &out)
+	if assert.Error(t, err) {
+		assert.True(t, strings.HasPrefix(err.Error(), "bad.mq:"), err.Error())
+	}
+
+	assert.Empty(t, out.String())
+
+	if err := os.WriteFile(filename, []byte("x   :=   1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if assert.NoError(t, FormatFile(filename, &out)) {
+		assert.Equal(t, "x := 1\n", out.String())
+	}
+
+	var sourceErr *SourceError
+	assert.ErrorAs(t, FormatFile(filepath.Join(dir, "missing.mq"), &out), &sourceErr)
+}
+
+func TestFormatIdempotence(t *testing.T) {
+	sources := []string{
+		"func main() {\nx := 1 * 2\nif x == 3 {\nprint(1)\n}\n\nprint(3)\n}",
+		"a := (1 - 2) - 3\nb := 1 - (2 - 3)\nc := (8 / 4) / 2\nd := 1 == (2 == 3)\ne := -(-2)",
+		"func foo() {\nif 1 == 1 {\nif 2 == 2 {\nx := \"bar\"\nprint(x)\n}\n}\n}",
+	}
+
+	for _, src := range sources {
+		var once, twice strings.Builder
+
+		assert.NoError(t, Format(strings.NewReader(src), &once))
+		assert.NoError(t, Format(strings.NewReader(once.String()), &twice))
+		assert.Equal(t, once.String(), twice.String())
+
+		// Formatting must not change the meaning of the program
+		expect := NewParser(NewLexerFromReader(strings.NewReader(src))).Run()
+		got := NewParser(NewLexerFromReader(strings.NewReader(once.String()))).Run()
+		assert.Equal(t, stripLocations(expect), stripLocations(got))
+	}
+}
+
+// stripLocations returns the statements of an AST with all the location data removed, so trees parsed from sources
+// with different layouts can be compared.
+func stripLocations(ast *AST) []Expr {
+	var stmts []Expr
+	for _, stmt := range ast.Statements {
+		Inspect(stmt.Expr, func(expr Expr) bool {
+			switch e := expr.(type) {
+			case *FuncDecl:
+				e.Location = nil
+			case *VariableDecl:
+				e.Location = nil
+			case *FuncCall:
+				e.Location = nil
+			case *BinaryExpr:
+				e.Location = nil
+			case *BooleanExpr:
+				e.Location = nil
+			case *UnaryExpr:
+				e.Location = nil
+			case *Identifier:
+				e.Location = nil
+			case *LiteralExpr:
+				e.Location = nil
+			case *IfExpr:
+				e.Location = nil
+			case *ConditionalExpr:
+				e.Location = nil
+			case *InterpolatedString:
+				e.Location = nil
+			case *BlockExpr:
+				e.Location = nil
+			case *ExternDecl:
+				e.Location = nil
+			case *CommentExpr:
+				e.Location = nil
+			}
+
+			return true
+		})
+
+		stmts = append(stmts, stmt.Expr)
+	}
+
+	return stmts
+}
@@ -2,7 +2,8 @@ package maqui
 
 import (
 	"fmt"
-	"strconv"
+	"math"
+	"strings"
 
 	"github.com/llir/llvm/ir"
 	"github.com/llir/llvm/ir/constant"
@@ -60,74 +61,374 @@ type IR interface {
 type LLVMGenerator struct {
 	// ast is the source for the IR. It's assumed valid, and will panic if not.
 	ast *AST
+	// target is the platform the IR is generated for
+	target Target
+	// errors holds the internal errors found while generating the IR
+	errors []CompileError
+	// modules holds the values of each imported module already declared
+	modules map[*Module]ValueLookup
+	// defined holds the imported modules whose function bodies were already generated
+	defined map[*Module]bool
 }
 
-// NewLLVMGenerator creates a new generator with the given AST.
-func NewLLVMGenerator(ast *AST) *LLVMGenerator {
+// NewLLVMGenerator creates a new generator with the given AST, that generates IR for the target platform.
+func NewLLVMGenerator(ast *AST, target Target) *LLVMGenerator {
 	return &LLVMGenerator{
-		ast: ast,
+		ast:     ast,
+		target:  target,
+		modules: make(map[*Module]ValueLookup),
+		defined: make(map[*Module]bool),
 	}
 }
 
-// Do builds the LLVM IR by recursively visiting all the nodes inside the AST. It assumes the AST is valid, and will
-// panic if an unexpected statement is encountered.
-func (g LLVMGenerator) Do() IR {
-	builder := NewLLVMIRBuilder()
+// Do builds the LLVM IR by recursively visiting all the nodes inside the AST. It assumes the AST is valid.
+//
+// The generation is done in two passes. The first one declares the signatures of all functions, and the second one
+// emits their bodies, so a function can be called before its definition in the source.
+//
+// The functions of the imported modules are generated into the same IR module, so the program is linked as a whole.
+//
+// Statements the generator doesn't know how to handle are reported as internal errors, available through Errors once
+// Do returns. If a top-level statement can't be declared, like a global variable, no function body is generated, since
+// the bodies might reference it.
+func (g *LLVMGenerator) Do() IR {
+	builder := NewLLVMIRBuilder(g.target)
+
+	for _, stmt := range g.ast.Statements {
+		g.declare(builder, stmt)
+	}
+
+	if len(builder.errors) != 0 {
+		g.errors = builder.errors
+		return builder.mod
+	}
+
 	for _, stmt := range g.ast.Statements {
 		g.visit(builder, stmt)
 	}
 
+	g.errors = builder.errors
 	return builder.mod
 }
 
+// Errors returns the internal errors found by the last call to Do. If any is present, the generated IR is incomplete
+// and should not be built.
+func (g *LLVMGenerator) Errors() []CompileError {
+	return g.errors
+}
+
+// declare takes an expression and, if it's a definition, declares it without generating its body.
+func (g *LLVMGenerator) declare(b *LLVMIRBuilder, expr Expr) {
+	switch e := expr.(type) {
+	case *AnnotatedExpr:
+		g.declare(b, e.Expr)
+	case *FuncDecl:
+		b.declareFunction(e)
+	case *ExternDecl:
+		b.declareExtern(e)
+	case *ImportDecl:
+		g.declareModule(b, e.Module)
+	case *VariableDecl, *MultiVariableDecl:
+		b.internalError(expr, "top-level variables are not supported yet")
+	default:
+		b.internalError(expr, "unexpected top-level statement %T", expr)
+	}
+}
+
+// declareModule declares the functions of an imported module, and sets them in the values of the importer qualified by
+// the module name. The module is declared inside its own values, so its names don't clash with the ones of the
+// importer. A module imported more than once is only declared the first time.
+func (g *LLVMGenerator) declareModule(b *LLVMIRBuilder, mod *Module) {
+	vals, declared := g.modules[mod]
+	if !declared {
+		vals = NewValueLookup()
+		vals.Inherit(b.builtins)
+		g.modules[mod] = vals
+
+		g.inModule(b, mod, func() {
+			for _, stmt := range mod.AST.Statements {
+				g.declare(b, stmt)
+			}
+		})
+	}
+
+	for _, stmt := range mod.AST.Statements {
+		if f, isFunc := stmt.Expr.(*FuncDecl); isFunc {
+			b.values.Set(mod.Name+"."+f.Name, vals.Get(f.Name))
+		}
+	}
+}
+
 // visit takes an expression and decides what should be done to generate IR based on that expression's type.
-func (g LLVMGenerator) visit(b *LLVMIRBuilder, expr Expr) {
+func (g *LLVMGenerator) visit(b *LLVMIRBuilder, expr Expr) {
 	switch e := expr.(type) {
 	case *AnnotatedExpr:
 		g.visit(b, e.Expr)
 	case *FuncDecl:
 		b.function(e)
+	case *ImportDecl:
+		if g.defined[e.Module] {
+			return
+		}
+
+		g.defined[e.Module] = true
+		g.inModule(b, e.Module, func() {
+			for _, stmt := range e.Module.AST.Statements {
+				g.visit(b, stmt)
+			}
+		})
+	case *ExternDecl:
+		// Externs have no body, so declaring them is enough
+	default:
+		b.internalError(expr, "unexpected top-level statement %T", expr)
 	}
 }
 
+// inModule runs fn with the builder set to generate the imported module, and restores it afterwards
+func (g *LLVMGenerator) inModule(b *LLVMIRBuilder, mod *Module, fn func()) {
+	prevVals, prevModule := b.values, b.module
+	b.values, b.module = g.modules[mod], mod.Name
+
+	defer func() {
+		b.values, b.module = prevVals, prevModule
+	}()
+
+	fn()
+}
+
 // LLVMIRBuilder is a helper structure that simplifies the process of moving the IR module and values around. It
 // implements some methods that take expressions and modify in-place the module based on the created IR.
 type LLVMIRBuilder struct {
 	mod    *ir.Module
 	values ValueLookup
+	target Target
+	// builtins holds the values of the builtin functions, shared by all the generated modules
+	builtins ValueLookup
+	// module is the name of the imported module being generated, or empty for the main file
+	module string
+	// globals holds the values of the module being generated. The function literals are generated inside them, since they
+	// don't capture the variables of the function enclosing them.
+	globals ValueLookup
+	// literals counts the function literals generated so far, so each gets a unique symbol name
+	literals int
+	// results holds the named results of the function being generated
+	results []*Param
+	// deferred holds the calls deferred so far by the function being generated, in the order they were scheduled
+	deferred []*deferredCall
+	// allocas holds the stack slots of the variables of the function being generated. They are placed at the start of its
+	// entry block once the function is done, where LLVM can promote them back into registers.
+	allocas []ir.Instruction
+	// declared holds the names of the variables declared in the current scope. Declaring one of them again stores into
+	// its slot, while declaring a variable of an enclosing scope shadows it with a slot of its own.
+	declared map[string]bool
+	// blockNames counts the blocks of the function being generated by their base name, so each gets a unique name
+	blockNames map[string]int
+	// conditionals holds the conditional expressions loaded so far, by the phi that joins their arms
+	conditionals map[*ir.InstPhi]*conditional
+	// errors holds the internal errors found while building the IR
+	errors []CompileError
 }
 
-// NewLLVMIRBuilder creates a new builder with a module containing the builtin functions and empty values
-func NewLLVMIRBuilder() *LLVMIRBuilder {
+// NewLLVMIRBuilder creates a new builder with a module for the target platform, containing the builtin functions and
+// empty values
+func NewLLVMIRBuilder(target Target) *LLVMIRBuilder {
 	builder := &LLVMIRBuilder{
-		mod:    ir.NewModule(),
-		values: NewValueLookup(),
+		mod:          ir.NewModule(),
+		values:       NewValueLookup(),
+		target:       target,
+		conditionals: make(map[*ir.InstPhi]*conditional),
 	}
 
+	builder.mod.TargetTriple = target.String()
+	builder.mod.DataLayout = target.DataLayout()
+
 	defineBuiltins(builder)
+
+	builder.builtins = NewValueLookup()
+	builder.builtins.Inherit(builder.values)
+
 	return builder
 }
 
-// function defines a function in the body. It will recursively parse the expressions inside the function. The function
-// will be defined in the value table.
-func (b *LLVMIRBuilder) function(expr *FuncDecl) {
-	// TODO: Allow arguments and returns
-	f := b.mod.NewFunc(expr.Name, types.Void)
+// wordType returns the integer type matching the native word size of the target. It should be used for pointer-sized
+// values, like indices.
+func (b *LLVMIRBuilder) wordType() *types.IntType {
+	return types.NewInt(uint64(b.target.WordSize()))
+}
+
+// manglePrefix is prepended to the symbol names of the Maqui functions, so they don't clash with C symbols.
+const manglePrefix = "maqui_"
+
+// symbolName returns the name of the function symbol inside the module. Names are mangled by prepending the
+// [manglePrefix], except for the main function and the exported functions, which keep their exact name. The functions
+// of an imported module are always mangled, and qualified by the module name, as their export only makes them visible
+// to the importers.
+func (b *LLVMIRBuilder) symbolName(expr *FuncDecl) string {
+	if b.module != "" {
+		return manglePrefix + b.module + "." + expr.Name
+	}
+
+	if expr.Exported || expr.Name == "main" {
+		return expr.Name
+	}
+
+	return manglePrefix + expr.Name
+}
+
+// declareFunction adds the function signature to the module, without a body. The function will be defined in the value
+// table, so it can be referenced before its body is generated.
+func (b *LLVMIRBuilder) declareFunction(expr *FuncDecl) *ir.Func {
+	// TODO: Allow arguments
+	var ret types.Type = types.Void
+	if results := resultParams(expr.Results, expr.InferredResult); len(results) != 0 {
+		ret = b.llvmType(expr.GetLocation(), results[0].Type)
+	}
+
+	f := b.mod.NewFunc(b.symbolName(expr), ret)
+	b.values.Set(expr.Name, f)
+
+	return f
+}
+
+// declareExtern adds the signature of an external function to the module, keeping its exact name so it links against
+// the external symbol. If the module already declares a function with the same name, it's reused.
+func (b *LLVMIRBuilder) declareExtern(expr *ExternDecl) *ir.Func {
+	var params []*ir.Param
+	for _, param := range expr.Params {
+		params = append(params, ir.NewParam(param.Name, b.llvmType(param.Location, param.Type)))
+	}
+
+	var ret types.Type = types.Void
+	if len(expr.Returns) != 0 {
+		ret = b.llvmType(expr.GetLocation(), expr.Returns[0])
+	}
+
+	f := externFunc(b, expr.Name, ret, params...)
 	b.values.Set(expr.Name, f)
 
-	block := f.NewBlock("")
+	return f
+}
+
+// llvmType returns the LLVM type that represents the Maqui basic type of the given name. An unknown type is reported as
+// an internal error at the location that uses it, and an int takes its place so the generation can go on.
+func (b *LLVMIRBuilder) llvmType(loc *Location, name string) types.Type {
+	switch name {
+	case "int":
+		return types.I32
+	case "int64":
+		return types.I64
+	case "float":
+		return types.Double
+	case "string":
+		return types.I8Ptr
+	case "bool":
+		return types.I1
+	default:
+		b.errors = append(b.errors, &InternalError{
+			Loc: loc,
+			Msg: "unknown type: " + name,
+		})
+
+		return types.I32
+	}
+}
+
+// function defines the body of a function. It will recursively parse the expressions inside the function. If the
+// function was not declared beforehand it will be declared as well.
+func (b *LLVMIRBuilder) function(expr *FuncDecl) {
+	f, declared := b.values[expr.Name].(*ir.Func)
+	if !declared {
+		f = b.declareFunction(expr)
+	}
+
+	prevGlobals := b.globals
+	b.globals = b.values
+
+	defer func() {
+		b.globals = prevGlobals
+	}()
+
+	b.body(f, resultParams(expr.Results, expr.InferredResult), expr.Body)
+}
+
+// funcLit generates a function literal as a function of its own, and returns it as the value of the literal. The
+// function has internal linkage, as it's only reachable through its value.
+func (b *LLVMIRBuilder) funcLit(expr *FuncLit) (value.Value, []ir.Instruction) {
+	results := resultParams(expr.Results, expr.InferredResult)
+
+	var ret types.Type = types.Void
+	if len(results) != 0 {
+		ret = b.llvmType(expr.GetLocation(), results[0].Type)
+	}
+
+	b.literals++
+	f := b.mod.NewFunc(fmt.Sprintf("%sfunc.%d", manglePrefix, b.literals), ret)
+	f.Linkage = enum.LinkageInternal
 
 	prevVals := b.values
+	b.values = b.globals
+
+	defer func() {
+		b.values = prevVals
+	}()
+
+	b.body(f, results, expr.Body)
+	return f, []ir.Instruction{}
+}
+
+// inferredResult is the name of the result of a function without named results. It's not a valid identifier, so it
+// can't clash with the variables of the function.
+const inferredResult = ".result"
+
+// resultParams returns the results of a function. A function without named results that returns a value gets a single
+// unnamed one, holding the value of its return.
+func resultParams(results []*Param, inferred *BasicType) []*Param {
+	if len(results) != 0 || inferred == nil {
+		return results
+	}
+
+	return []*Param{{Name: inferredResult, Type: inferred.Typ}}
+}
+
+// body generates the blocks of a function from its named results and statements. The variables of the function are
+// defined on top of the current values.
+func (b *LLVMIRBuilder) body(f *ir.Func, results []*Param, body []Expr) {
+	prevVals, prevResults, prevDeferred, prevAllocas, prevNames := b.values, b.results, b.deferred, b.allocas, b.blockNames
+	prevDeclared := b.declared
 	b.values = NewValueLookup()
 	b.values.Inherit(prevVals)
+	b.results = results
+	b.deferred = nil
+	b.allocas = nil
+	b.blockNames = make(map[string]int)
+	b.declared = make(map[string]bool)
 
 	defer func() {
-		b.values = prevVals
+		b.values, b.results, b.deferred, b.allocas, b.blockNames = prevVals, prevResults, prevDeferred, prevAllocas, prevNames
+		b.declared = prevDeclared
 	}()
 
-	for _, stmt := range expr.Body {
+	entry := f.NewBlock(b.blockName("entry"))
+	block := entry
+
+	for _, result := range results {
+		typ := b.llvmType(result.Location, result.Type)
+		slot := b.alloca(typ)
+		b.values.Set(result.Name, slot)
+		block.NewStore(b.zero(typ), slot)
+	}
+
+	for _, stmt := range body {
+		if ret, isReturn := stmt.(*ReturnExpr); isReturn {
+			f.Blocks = append(f.Blocks, b.ret(block, ret.Value)...)
+
+			// The statements after the return are unreachable, but they are still generated inside a block of their own
+			block = f.NewBlock(b.blockName("unreachable"))
+			continue
+		}
+
 		if isBlockExpr(stmt) {
-			continueBlock := ir.NewBlock("")
+			continueBlock := ir.NewBlock(b.blockName(blockKind(stmt) + ".end"))
 
 			blocks := b.blocks(stmt, continueBlock)
 			block.NewBr(blocks[0])
@@ -139,17 +440,107 @@ func (b *LLVMIRBuilder) function(expr *FuncDecl) {
 			continue
 		}
 
-		block.Insts = append(block.Insts, b.instructions(stmt)...)
+		var split []*ir.Block
+		block, split = b.emit(block, b.instructions(stmt))
+		f.Blocks = append(f.Blocks, split...)
 	}
 
-	// TODO: Allow returns
-	block.NewRet(nil)
+	f.Blocks = append(f.Blocks, b.ret(block, nil)...)
+
+	entry.Insts = append(b.allocas, entry.Insts...)
 }
 
-// isBlockExpr returns true if the expression is a block expression (if, for, etc.).
-func isBlockExpr(expr Expr) bool {
+// alloca creates a stack slot for a variable of the type inside the current function
+func (b *LLVMIRBuilder) alloca(t types.Type) *ir.InstAlloca {
+	slot := ir.NewAlloca(t)
+	b.allocas = append(b.allocas, slot)
+
+	return slot
+}
+
+// load returns the value of a variable, loaded from its stack slot. Values without a slot, like functions, are returned
+// as they are.
+func (b *LLVMIRBuilder) load(v value.Value) (value.Value, []ir.Instruction) {
+	slot, isVariable := v.(*ir.InstAlloca)
+	if !isVariable {
+		return v, []ir.Instruction{}
+	}
+
+	ld := ir.NewLoad(slot.ElemType, slot)
+	return ld, []ir.Instruction{ld}
+}
+
+// ret terminates the block by returning from the current function. The calls deferred so far run first, the last one
+// deferred running first. The returned expression, if any, is stored into the result of the function before them. If
+// the function has a result, its current value is returned. The blocks the returned expression is split into are
+// returned, as described by emit.
+func (b *LLVMIRBuilder) ret(block *ir.Block, returned Expr) []*ir.Block {
+	var ins []ir.Instruction
+	if returned != nil {
+		v, loaded := b.recursiveLoad(returned)
+		_, stored := b.store(b.results[0].Name, v)
+		ins = append(loaded, stored...)
+	}
+
+	for i := len(b.deferred) - 1; i >= 0; i-- {
+		ins = append(ins, b.callDeferred(b.deferred[i])...)
+	}
+
+	var v value.Value
+	if len(b.results) != 0 {
+		var loaded []ir.Instruction
+		v, loaded = b.load(b.values.Get(b.results[0].Name))
+		ins = append(ins, loaded...)
+	}
+
+	block, split := b.emit(block, ins)
+	block.NewRet(v)
+
+	return split
+}
+
+// zero returns the zero value of the LLVM type of a Maqui basic type
+func (b *LLVMIRBuilder) zero(typ types.Type) value.Value {
+	switch {
+	case typ.Equal(types.Double):
+		return constant.NewFloat(types.Double, 0)
+	case typ.Equal(types.I8Ptr):
+		return globalString(b, "._empty_str", "")
+	case typ.Equal(types.I1):
+		return constant.NewBool(false)
+	default:
+		return constant.NewInt(typ.(*types.IntType), 0)
+	}
+}
+
+// blockName returns a unique name for a new block of the current function, based on the construct that generates it,
+// like "if.then". The names are deterministic: the first block of a name inside a function keeps it as is, and the
+// following ones get a numeric suffix, like "if.then.1".
+func (b *LLVMIRBuilder) blockName(name string) string {
+	n := b.blockNames[name]
+	b.blockNames[name]++
+
+	if n == 0 {
+		return name
+	}
+
+	return fmt.Sprintf("%s.%d", name, n)
+}
+
+// blockKind returns the base name of the blocks generated by a block expression
+func blockKind(expr Expr) string {
 	switch expr.(type) {
 	case *IfExpr:
+		return "if"
+	default:
+		return "block"
+	}
+}
+
+// isBlockExpr returns true if the expression is a block expression (if, bare blocks, etc.).
+func isBlockExpr(expr Expr) bool {
+	switch expr.(type) {
+	case *IfExpr, *BlockExpr:
 		return true
 	default:
 		return false
@@ -163,8 +554,11 @@ func (b *LLVMIRBuilder) blocks(expr Expr, exit *ir.Block) []*ir.Block {
 	switch e := expr.(type) {
 	case *IfExpr:
 		return b.ifBranch(e, exit)
+	case *BlockExpr:
+		return b.branch("block", e.Body, exit)
 	}
 
+	b.internalError(expr, "unexpected block statement %T", expr)
 	return nil
 }
 
@@ -177,43 +571,192 @@ func (b *LLVMIRBuilder) instructions(expr Expr) []ir.Instruction {
 	case *VariableDecl:
 		_, ins := b.variableDecl(e)
 		return ins
+	case *MultiVariableDecl:
+		return b.multiVariableDecl(e)
 	case *FuncCall:
 		_, ins := b.functionCall(e)
 		return ins
+	case *DeferExpr:
+		call, isCall := e.Call.(*FuncCall)
+		if !isCall {
+			b.internalError(expr, "deferred %T is not a call", e.Call)
+			break
+		}
+
+		return b.deferCall(call)
+	case *BooleanExpr, *UnaryExpr, *ConditionalExpr, *InterpolatedString, *LiteralExpr, *Identifier, *FuncLit:
+		// The value of a standalone expression is unused
+		_, ins := b.recursiveLoad(e)
+		return ins
+	case *ExternDecl:
+		b.declareExtern(e)
+	default:
+		b.internalError(expr, "unexpected statement %T", expr)
 	}
 
 	return []ir.Instruction{}
 }
 
+// internalError reports that the IR for an expression couldn't be generated. An internal error means the AST reached
+// the generator in a shape the semantic analysis should have rejected.
+func (b *LLVMIRBuilder) internalError(expr Expr, format string, args ...interface{}) {
+	b.errors = append(b.errors, &InternalError{
+		Loc: expr.GetLocation(),
+		Msg: fmt.Sprintf(format, args...),
+	})
+}
+
+type InternalError struct {
+	Loc *Location
+	Msg string
+}
+
+func (e InternalError) String() string {
+	return fmt.Sprintf("%s internal error: %s", e.Loc, e.Msg)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e InternalError) GetLocation() *Location {
+	return e.Loc
+}
+
 // ifBranch takes in an if expression and parses recursively it's content. As a product it will generate an IR block
-// slice containing one block for each branch.
+// slice containing one block for each branch. If the condition is a constant expression, only the branch taken is
+// generated.
 func (b *LLVMIRBuilder) ifBranch(expr *IfExpr, exit *ir.Block) []*ir.Block {
-	block := ir.NewBlock("")
+	block := ir.NewBlock(b.blockName("if.cond"))
+
+	if v, err := Eval(expr.Condition); err == nil {
+		if cond, isBool := v.(bool); isBool {
+			return b.constantBranch(block, cond, expr, exit)
+		}
+	}
 
 	condVal, condIns := b.recursiveLoad(expr.Condition)
-	block.Insts = append(block.Insts, condIns...)
+	last, split := b.emit(block, condIns)
+	blocks := append([]*ir.Block{block}, split...)
 
-	trueBlock := ir.NewBlock("")
-	for _, cExpr := range expr.Consequent {
-		trueBlock.Insts = append(trueBlock.Insts, b.instructions(cExpr)...)
+	trueBlocks := b.branch("if.then", expr.Consequent, exit)
+
+	if len(expr.Else) == 0 {
+		last.NewCondBr(condVal, trueBlocks[0], exit)
+		return append(blocks, trueBlocks...)
 	}
 
-	trueBlock.NewBr(exit)
+	falseBlocks := b.elseBranch(expr, exit)
 
-	if len(expr.Else) == 0 {
-		block.NewCondBr(condVal, trueBlock, exit)
-		return []*ir.Block{block, trueBlock}
+	last.NewCondBr(condVal, trueBlocks[0], falseBlocks[0])
+	return append(append(blocks, trueBlocks...), falseBlocks...)
+}
+
+// elseBranch builds the blocks of the else branch of an if expression. An else if chain is built as the blocks of the
+// nested if expression, so its condition is checked right when the previous one fails.
+func (b *LLVMIRBuilder) elseBranch(expr *IfExpr, exit *ir.Block) []*ir.Block {
+	if len(expr.Else) == 1 {
+		if elseIf, isIf := expr.Else[0].(*IfExpr); isIf {
+			return b.ifBranch(elseIf, exit)
+		}
+	}
+
+	return b.branch("if.else", expr.Else, exit)
+}
+
+// constantBranch ends the condition block of an if expression whose condition is always true or always false, by
+// jumping straight to the branch taken. The other branch is unreachable, so it's not generated.
+func (b *LLVMIRBuilder) constantBranch(block *ir.Block, cond bool, expr *IfExpr, exit *ir.Block) []*ir.Block {
+	if !cond && len(expr.Else) == 0 {
+		block.NewBr(exit)
+		return []*ir.Block{block}
 	}
 
-	falseBlock := ir.NewBlock("")
-	for _, eExpr := range expr.Else {
-		falseBlock.Insts = append(falseBlock.Insts, b.instructions(eExpr)...)
+	taken := b.branch("if.then", expr.Consequent, exit)
+	if !cond {
+		taken = b.elseBranch(expr, exit)
+	}
+
+	block.NewBr(taken[0])
+	return append([]*ir.Block{block}, taken...)
+}
+
+// branch builds the blocks of a branch with the given name from its statements, which jumps to the exit block once done.
+// The first of the blocks is the entry of the branch. The block statements nested inside the branch get blocks of their
+// own, which continue in a new block of the branch. A return ends the branch early, and the statements following it are
+// discarded as unreachable. The values defined inside the branch are discarded once it ends.
+func (b *LLVMIRBuilder) branch(name string, exprs []Expr, exit *ir.Block) []*ir.Block {
+	prevVals, prevDeclared := b.values, b.declared
+	b.values = NewValueLookup()
+	b.values.Inherit(prevVals)
+	b.declared = make(map[string]bool)
+
+	defer func() {
+		b.values, b.declared = prevVals, prevDeclared
+	}()
+
+	block := ir.NewBlock(b.blockName(name))
+	blocks := []*ir.Block{block}
+
+	for _, expr := range exprs {
+		if ret, isReturn := expr.(*ReturnExpr); isReturn {
+			return append(blocks, b.ret(block, ret.Value)...)
+		}
+
+		if isBlockExpr(expr) {
+			continueBlock := ir.NewBlock(b.blockName(blockKind(expr) + ".end"))
+
+			nested := b.blocks(expr, continueBlock)
+			block.NewBr(nested[0])
+
+			blocks = append(blocks, nested...)
+			blocks = append(blocks, continueBlock)
+
+			block = continueBlock
+			continue
+		}
+
+		var split []*ir.Block
+		block, split = b.emit(block, b.instructions(expr))
+		blocks = append(blocks, split...)
 	}
 
-	falseBlock.NewBr(exit)
+	block.NewBr(exit)
+	return blocks
+}
+
+// emit appends the instructions to the block. The block is split at the phi of each conditional expression, so only the
+// arm taken is evaluated: the block branches on the condition to a block for each arm, which join in a new block where
+// the phi and the following instructions go. The block the instructions end in is returned, along with the blocks the
+// split created, in order.
+func (b *LLVMIRBuilder) emit(block *ir.Block, ins []ir.Instruction) (*ir.Block, []*ir.Block) {
+	var blocks []*ir.Block
+	for _, inst := range ins {
+		phi, isPhi := inst.(*ir.InstPhi)
+		cond, isCond := b.conditionals[phi]
+		if !isPhi || !isCond {
+			block.Insts = append(block.Insts, inst)
+			continue
+		}
+
+		consequent := ir.NewBlock(b.blockName("cond.then"))
+		alternative := ir.NewBlock(b.blockName("cond.else"))
+		end := ir.NewBlock(b.blockName("cond.end"))
+
+		block.NewCondBr(cond.value, consequent, alternative)
+
+		for i, arm := range []*ir.Block{consequent, alternative} {
+			last, split := b.emit(arm, cond.arms[i])
+			last.NewBr(end)
+			phi.Incs[i].Pred = last
+
+			blocks = append(append(blocks, arm), split...)
+		}
+
+		end.Insts = append(end.Insts, phi)
+
+		blocks = append(blocks, end)
+		block = end
+	}
 
-	block.NewCondBr(condVal, trueBlock, falseBlock)
-	return []*ir.Block{block, trueBlock, falseBlock}
+	return block, blocks
 }
 
 // recursiveLoad will load the value and instructions associated with an instruction expression. Blocks and other
@@ -228,10 +771,16 @@ func (b *LLVMIRBuilder) recursiveLoad(expr Expr) (value.Value, []ir.Instruction)
 		return b.booleanExpression(e)
 	case *UnaryExpr:
 		return b.unaryExpression(e)
+	case *ConditionalExpr:
+		return b.conditionalExpression(e)
+	case *InterpolatedString:
+		return b.interpolatedString(e)
 	case *Identifier:
-		return b.values.Get(e.Name), []ir.Instruction{}
+		return b.load(b.values.Get(e.Name))
 	case *FuncCall:
 		return b.functionCall(e)
+	case *FuncLit:
+		return b.funcLit(e)
 	default:
 		// TODO: Handle gracefully
 		panic("not implemented")
@@ -244,20 +793,61 @@ func (b *LLVMIRBuilder) binaryExpression(expr *BinaryExpr) (value.Value, []ir.In
 	v2, i2 := b.recursiveLoad(expr.Op2)
 	ins := append(i1, i2...)
 
+	v1, v2, i3 := b.widen(v1, v2)
+	ins = append(ins, i3...)
+
+	isFloat := types.IsFloat(v1.Type())
+
 	switch expr.Operation {
 	case BinaryAddition:
+		if isFloat {
+			op := ir.NewFAdd(v1, v2)
+			return op, append(ins, op)
+		}
+
 		op := ir.NewAdd(v1, v2)
 		return op, append(ins, op)
 	case BinarySubtraction:
+		if isFloat {
+			op := ir.NewFSub(v1, v2)
+			return op, append(ins, op)
+		}
+
 		op := ir.NewSub(v1, v2)
 		return op, append(ins, op)
 	case BinaryMultiplication:
+		if isFloat {
+			op := ir.NewFMul(v1, v2)
+			return op, append(ins, op)
+		}
+
 		op := ir.NewMul(v1, v2)
 		return op, append(ins, op)
 	case BinaryDivision:
-		// TODO: Use fdiv and udiv when appropriate
+		if isFloat {
+			op := ir.NewFDiv(v1, v2)
+			return op, append(ins, op)
+		}
+
+		// TODO: Use udiv once unsigned integers exist
 		op := ir.NewSDiv(v1, v2)
 		return op, append(ins, op)
+	case BinaryAnd:
+		op := ir.NewAnd(v1, v2)
+		return op, append(ins, op)
+	case BinaryOr:
+		op := ir.NewOr(v1, v2)
+		return op, append(ins, op)
+	case BinaryXor:
+		op := ir.NewXor(v1, v2)
+		return op, append(ins, op)
+	case BinaryShiftLeft:
+		op := ir.NewShl(v1, v2)
+		return op, append(ins, op)
+	case BinaryShiftRight:
+		// TODO: Use lshr once unsigned integers exist
+		op := ir.NewAShr(v1, v2)
+		return op, append(ins, op)
 	default:
 		// TODO: Handle gracefully
 		panic("unexpected binary op: " + expr.Operation)
@@ -270,8 +860,17 @@ func (b *LLVMIRBuilder) booleanExpression(expr *BooleanExpr) (value.Value, []ir.
 	v2, i2 := b.recursiveLoad(expr.Op2)
 	ins := append(i1, i2...)
 
+	v1, v2, i3 := b.widen(v1, v2)
+	ins = append(ins, i3...)
+
 	switch expr.Operation {
 	case BooleanEquals:
+		if types.IsFloat(v1.Type()) {
+			op := ir.NewFCmp(enum.FPredOEQ, v1, v2)
+			return op, append(ins, op)
+		}
+
+		// Integers and booleans are compared by value, and functions by identity, comparing their pointers
 		// TODO Add more data types
 		op := ir.NewICmp(enum.IPredEQ, v1, v2)
 		return op, append(ins, op)
@@ -287,30 +886,209 @@ func (b *LLVMIRBuilder) unaryExpression(expr *UnaryExpr) (value.Value, []ir.Inst
 
 	switch expr.Operation {
 	case UnaryNegative:
-		minusOne := constant.NewInt(types.I32, -1)
+		if types.IsFloat(v.Type()) {
+			op := ir.NewFNeg(v)
+			return op, append(ins, op)
+		}
+
+		minusOne := constant.NewInt(v.Type().(*types.IntType), -1)
 		op := ir.NewMul(v, minusOne)
 		return op, append(ins, op)
+	case UnaryBitwiseNot:
+		// All bits set
+		mask := constant.NewInt(v.Type().(*types.IntType), -1)
+		op := ir.NewXor(v, mask)
+		return op, append(ins, op)
 	default:
 		// TODO: Handle gracefully
 		panic("unexpected unary op: " + expr.Operation)
 	}
 }
 
+// conditional holds the condition and the instructions of each arm of a conditional expression, kept until the block
+// is split at its phi by emit
+type conditional struct {
+	value value.Value
+	arms  [2][]ir.Instruction
+}
+
+// conditionalExpression loads a conditional expression recursively, and returns its value and instructions. The value
+// is a phi joining the value of each arm, which stands for the arms in the instructions: only the one taken is evaluated
+// once emitted.
+func (b *LLVMIRBuilder) conditionalExpression(expr *ConditionalExpr) (value.Value, []ir.Instruction) {
+	cond, ins := b.recursiveLoad(expr.Condition)
+
+	v1, i1 := b.recursiveLoad(expr.Consequent)
+	v2, i2 := b.recursiveLoad(expr.Alternative)
+
+	// The conversion belongs to the arm of the widened value
+	w1, w2, widened := b.widen(v1, v2)
+	if w1 != v1 {
+		i1 = append(i1, widened...)
+	} else {
+		i2 = append(i2, widened...)
+	}
+
+	phi := ir.NewPhi(ir.NewIncoming(w1, nil), ir.NewIncoming(w2, nil))
+	b.conditionals[phi] = &conditional{
+		value: cond,
+		arms:  [2][]ir.Instruction{i1, i2},
+	}
+
+	return phi, append(ins, phi)
+}
+
+// interpolatedString loads an interpolated string expression and returns its value and instructions. The string is
+// formatted with the C snprintf function into a buffer allocated with malloc, and its value is a pointer to the first
+// character. The buffer is never freed.
+func (b *LLVMIRBuilder) interpolatedString(expr *InterpolatedString) (value.Value, []ir.Instruction) {
+	var ins []ir.Instruction
+	var format strings.Builder
+	var args []value.Value
+
+	for _, part := range expr.Parts {
+		if lit, isLiteral := part.(*LiteralExpr); isLiteral && lit.Typ == LiteralString {
+			format.WriteString(strings.ReplaceAll(lit.Value, "%", "%%"))
+			continue
+		}
+
+		v, partIns := b.recursiveLoad(part)
+		ins = append(ins, partIns...)
+
+		switch t := v.Type().(type) {
+		case *types.FloatType:
+			format.WriteString("%g")
+		case *types.PointerType:
+			format.WriteString("%s")
+		case *types.IntType:
+			if t.BitSize == 1 {
+				format.WriteString("%s")
+
+				sel := ir.NewSelect(v, globalString(b, "._true_str", "true"), globalString(b, "._false_str", "false"))
+				ins = append(ins, sel)
+				v = sel
+				break
+			}
+
+			format.WriteString("%lld")
+
+			var coerceIns []ir.Instruction
+			v, coerceIns = b.coerce(v, types.I64)
+			ins = append(ins, coerceIns...)
+		}
+
+		args = append(args, v)
+	}
+
+	snprintf := externFunc(b, "snprintf", types.I32,
+		ir.NewParam("s", types.I8Ptr), ir.NewParam("n", b.wordType()), ir.NewParam("format", types.I8Ptr))
+	snprintf.Sig.Variadic = true
+
+	malloc := externFunc(b, "malloc", types.I8Ptr, ir.NewParam("size", b.wordType()))
+
+	fmtAddr := globalString(b, fmt.Sprintf(".str.%d", len(b.mod.Globals)), format.String())
+
+	// The first call only measures the length of the string
+	size := ir.NewCall(snprintf, append([]value.Value{constant.NewNull(types.I8Ptr), constant.NewInt(b.wordType(), 0), fmtAddr}, args...)...)
+	ins = append(ins, size)
+
+	var n value.Value = size
+	if b.wordType().BitSize > 32 {
+		ext := ir.NewSExt(size, b.wordType())
+		ins = append(ins, ext)
+		n = ext
+	}
+
+	n = ir.NewAdd(n, constant.NewInt(b.wordType(), 1)) // NUL terminator
+	ins = append(ins, n.(ir.Instruction))
+
+	buf := ir.NewCall(malloc, n)
+	ins = append(ins, buf)
+
+	str := ir.NewCall(snprintf, append([]value.Value{buf, n, fmtAddr}, args...)...)
+	ins = append(ins, str)
+
+	return buf, ins
+}
+
 // variableDecl loads a variable declaration expression recursively, and returns its value and instructions
 func (b *LLVMIRBuilder) variableDecl(expr *VariableDecl) (value.Value, []ir.Instruction) {
 	v, ins := b.recursiveLoad(expr.Value)
-	b.values.Set(expr.Name, v)
+	v, stored := b.store(expr.Name, v)
+
+	return v, append(ins, stored...)
+}
+
+// multiVariableDecl loads all the values of a multiple variable declaration, and only then stores each of them into
+// its variable, so the variables being declared can be used by the values. It returns the instructions.
+func (b *LLVMIRBuilder) multiVariableDecl(expr *MultiVariableDecl) []ir.Instruction {
+	var ins []ir.Instruction
+
+	values := make([]value.Value, len(expr.Values))
+	for i, val := range expr.Values {
+		var loaded []ir.Instruction
+		values[i], loaded = b.recursiveLoad(val)
+		ins = append(ins, loaded...)
+	}
+
+	for i, name := range expr.Names {
+		_, stored := b.store(name, values[i])
+		ins = append(ins, stored...)
+	}
+
+	return ins
+}
+
+// store assigns the value to the variable of the given name, and returns the stored value and the instructions.
+// Declaring a variable again in the same scope with the same type stores into its existing slot, while a variable of an
+// enclosing scope is shadowed by a new slot, so its value is left untouched. Named results always keep their slot, as
+// their type can't change. The value of the blank identifier is discarded.
+func (b *LLVMIRBuilder) store(name string, v value.Value) (value.Value, []ir.Instruction) {
+	if name == blankIdentifier {
+		return v, nil
+	}
+
+	var ins []ir.Instruction
+
+	slot, declared := b.values[name].(*ir.InstAlloca)
+	if declared && b.isResult(name) {
+		v, ins = b.coerce(v, slot.ElemType)
+	} else if !b.declared[name] {
+		declared = false
+	}
 
-	return v, ins
+	if !declared || !slot.ElemType.Equal(v.Type()) {
+		slot = b.alloca(v.Type())
+		b.values.Set(name, slot)
+		b.declared[name] = true
+	}
+
+	return v, append(ins, ir.NewStore(v, slot))
+}
+
+// isResult returns true if the name is a named result of the function being generated
+func (b *LLVMIRBuilder) isResult(name string) bool {
+	for _, result := range b.results {
+		if result.Name == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 // loadLiteral loads a literal declaration, and returns its value and instructions
 func (b *LLVMIRBuilder) loadLiteral(expr *LiteralExpr) (value.Value, []ir.Instruction) {
 	switch expr.Typ {
 	case LiteralString:
-		// TODO: Implement
-		panic("not implemented")
+		return b.loadLiteralString(expr)
+	case LiteralBool:
+		return constant.NewBool(expr.Value == "true"), []ir.Instruction{}
 	case LiteralNumber:
+		if isFloatLiteral(expr.Value) {
+			return b.loadLiteralFloat(expr)
+		}
+
 		return b.loadLiteralInt(expr)
 	default:
 		// TODO: Handle gracefully
@@ -320,19 +1098,127 @@ func (b *LLVMIRBuilder) loadLiteral(expr *LiteralExpr) (value.Value, []ir.Instru
 
 // loadLiteralInt loads a literal integer expression and returns its value and instructions
 func (b *LLVMIRBuilder) loadLiteralInt(expr *LiteralExpr) (value.Value, []ir.Instruction) {
-	v, err := strconv.ParseInt(expr.Value, 10, 32)
-	if err != nil {
-		// TODO: Handle gracefully
-		panic(err)
+	n, err := expr.number()
+	v, isInt := n.(int64)
+	if err != nil || !isInt {
+		b.internalError(expr, "invalid integer literal: %s", expr.Value)
+		return constant.NewInt(types.I32, 0), []ir.Instruction{}
+	}
+
+	typ := types.I32
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		// Numbers too big for an int get widened
+		typ = types.I64
+	}
+
+	c := constant.NewInt(typ, v)
+	return c, []ir.Instruction{}
+}
+
+// loadLiteralString loads a literal string expression and returns its value and instructions. The string is stored as
+// a NUL-terminated global constant, and its value is a pointer to the first character.
+func (b *LLVMIRBuilder) loadLiteralString(expr *LiteralExpr) (value.Value, []ir.Instruction) {
+	str := constant.NewCharArrayFromString(expr.Value + "\x00")
+
+	glob := b.mod.NewGlobalDef(fmt.Sprintf(".str.%d", len(b.mod.Globals)), str)
+	glob.Immutable = true
+
+	zero := constant.NewInt(b.wordType(), 0)
+	return constant.NewGetElementPtr(str.Typ, glob, zero, zero), []ir.Instruction{}
+}
+
+// loadLiteralFloat loads a literal floating point expression and returns its value and instructions
+func (b *LLVMIRBuilder) loadLiteralFloat(expr *LiteralExpr) (value.Value, []ir.Instruction) {
+	n, err := expr.number()
+	v, isFloat := n.(float64)
+	if err != nil || !isFloat {
+		b.internalError(expr, "invalid floating point literal: %s", expr.Value)
+		return constant.NewFloat(types.Double, 0), []ir.Instruction{}
 	}
 
-	c := constant.NewInt(types.I32, v)
+	c := constant.NewFloat(types.Double, v)
 	return c, []ir.Instruction{}
 }
 
 // functionCall loads a function call expression and returns its value and instructions
 func (b *LLVMIRBuilder) functionCall(expr *FuncCall) (value.Value, []ir.Instruction) {
+	callee, callVals, ins := b.callOperands(expr)
+
+	call := ir.NewCall(callee, callVals...)
+	ins = append(ins, call)
+
+	if !call.Type().Equal(types.Void) {
+		return call, ins
+	}
+
+	return nil, ins
+}
+
+// deferredCall is a call scheduled by a defer statement. Its callee and arguments are evaluated by the defer statement,
+// and kept in stack slots until the call runs, so later declarations don't change them.
+type deferredCall struct {
+	callee value.Value
+	args   []value.Value
+}
+
+// deferCall evaluates the callee and arguments of a deferred call, and schedules the call to run when the function
+// returns. It returns the instructions that evaluate and store them.
+func (b *LLVMIRBuilder) deferCall(expr *FuncCall) []ir.Instruction {
+	callee, callVals, ins := b.callOperands(expr)
+
+	deferred := &deferredCall{}
+
+	var spilled []ir.Instruction
+	deferred.callee, spilled = b.spill(callee)
+	ins = append(ins, spilled...)
+
+	for _, v := range callVals {
+		v, spilled = b.spill(v)
+		deferred.args = append(deferred.args, v)
+		ins = append(ins, spilled...)
+	}
+
+	b.deferred = append(b.deferred, deferred)
+	return ins
+}
+
+// callDeferred returns the instructions that load the callee and arguments of a deferred call, and call it
+func (b *LLVMIRBuilder) callDeferred(c *deferredCall) []ir.Instruction {
+	callee, ins := b.load(c.callee)
+
+	args := make([]value.Value, len(c.args))
+	for i, arg := range c.args {
+		var loaded []ir.Instruction
+		args[i], loaded = b.load(arg)
+		ins = append(ins, loaded...)
+	}
+
+	return append(ins, ir.NewCall(callee, args...))
+}
+
+// spill stores a value into a new stack slot, so it can be loaded later from any block of the function, and returns the
+// slot and the instructions. Constants are returned as they are.
+func (b *LLVMIRBuilder) spill(v value.Value) (value.Value, []ir.Instruction) {
+	if _, isConst := v.(constant.Constant); isConst {
+		return v, nil
+	}
+
+	slot := b.alloca(v.Type())
+	return slot, []ir.Instruction{ir.NewStore(v, slot)}
+}
+
+// callOperands loads the callee and the arguments of a function call expression, and returns them along with the
+// instructions. A callee other than a name is loaded before the arguments, and a function stored in a variable is loaded
+// from its slot. The arguments are coerced to the types of the parameters.
+func (b *LLVMIRBuilder) callOperands(expr *FuncCall) (value.Value, []value.Value, []ir.Instruction) {
 	var ins []ir.Instruction
+	var callee value.Value
+
+	id, byName := expr.Callee.(*Identifier)
+	if !byName {
+		callee, ins = b.recursiveLoad(expr.Callee)
+	}
+
 	var callVals []value.Value
 	for _, arg := range expr.Args {
 		argVal, argIns := b.recursiveLoad(arg)
@@ -341,9 +1227,98 @@ func (b *LLVMIRBuilder) functionCall(expr *FuncCall) (value.Value, []ir.Instruct
 		callVals = append(callVals, argVal)
 	}
 
-	call := ir.NewCall(b.values.Get(expr.Name), callVals...)
-	ins = append(ins, call)
+	if byName {
+		var loadIns []ir.Instruction
+		callee, loadIns = b.load(b.callee(id.Name, callVals))
+		ins = append(ins, loadIns...)
+	}
 
-	// TODO: Implement function call returns
-	return nil, ins
+	sig := callee.Type().(*types.PointerType).ElemType.(*types.FuncType)
+	for i := range callVals {
+		// Match the width of the parameter. The variadic arguments get the default promotions of C, so booleans are
+		// passed as ints.
+		var param types.Type = types.I32
+		if i < len(sig.Params) {
+			param = sig.Params[i]
+		} else if !sig.Variadic {
+			break
+		}
+
+		var coerceIns []ir.Instruction
+		callVals[i], coerceIns = b.coerce(callVals[i], param)
+		ins = append(ins, coerceIns...)
+	}
+
+	return callee, callVals, ins
+}
+
+// callee returns the value of the called function. If the function has an overload for the type of its only argument,
+// the overload is returned instead.
+func (b *LLVMIRBuilder) callee(name string, args []value.Value) value.Value {
+	if len(args) == 1 {
+		if f, ok := b.values[overloadName(name, args[0].Type().String())]; ok {
+			return f
+		}
+	}
+
+	return b.values.Get(name)
+}
+
+// widen matches the types of two numeric values, by converting the narrowest one to the type of the widest. Integers
+// are always narrower than floats. Values that are not numeric, or that have the same type, are returned unchanged.
+func (b *LLVMIRBuilder) widen(v1, v2 value.Value) (value.Value, value.Value, []ir.Instruction) {
+	if types.IsFloat(v1.Type()) && types.IsInt(v2.Type()) {
+		v2, ins := b.coerce(v2, v1.Type())
+		return v1, v2, ins
+	}
+
+	if types.IsInt(v1.Type()) && types.IsFloat(v2.Type()) {
+		v1, ins := b.coerce(v1, v2.Type())
+		return v1, v2, ins
+	}
+
+	t1, isInt1 := v1.Type().(*types.IntType)
+	t2, isInt2 := v2.Type().(*types.IntType)
+	if !isInt1 || !isInt2 || t1.BitSize == t2.BitSize {
+		return v1, v2, nil
+	}
+
+	if t1.BitSize < t2.BitSize {
+		v1, ins := b.coerce(v1, t2)
+		return v1, v2, ins
+	}
+
+	v2, ins := b.coerce(v2, t1)
+	return v1, v2, ins
+}
+
+// coerce converts an integer value to a wider integer type. Constants are converted directly, while other values get
+// sign-extended (or zero-extended if they are booleans). Integer constants can also be converted to floats. If no
+// conversion is possible the value is returned unchanged.
+func (b *LLVMIRBuilder) coerce(v value.Value, t types.Type) (value.Value, []ir.Instruction) {
+	if to, toFloat := t.(*types.FloatType); toFloat {
+		if c, isConst := v.(*constant.Int); isConst {
+			return constant.NewFloat(to, float64(c.X.Int64())), nil
+		}
+
+		return v, nil
+	}
+
+	from, isInt := v.Type().(*types.IntType)
+	to, toInt := t.(*types.IntType)
+	if !isInt || !toInt || from.BitSize >= to.BitSize {
+		return v, nil
+	}
+
+	if c, isConst := v.(*constant.Int); isConst && from.BitSize != 1 {
+		return constant.NewInt(to, c.X.Int64()), nil
+	}
+
+	if from.BitSize == 1 {
+		ext := ir.NewZExt(v, to)
+		return ext, []ir.Instruction{ext}
+	}
+
+	ext := ir.NewSExt(v, to)
+	return ext, []ir.Instruction{ext}
 }
@@ -1,10 +1,12 @@
 package maqui
 
 import (
+	"strings"
+	"testing"
+
 	"github.com/llir/llvm/ir/constant"
 	"github.com/llir/llvm/ir/types"
 	"github.com/stretchr/testify/assert"
-	"testing"
 )
 
 func TestValueLookup(t *testing.T) {
@@ -43,3 +45,516 @@ func TestValueLookupInherit(t *testing.T) {
 	assert.Equal(t, val2, vals1.Get("id2"))
 	assert.Equal(t, val4, vals1.Get("id4"))
 }
+
+// linuxTarget is the target used to generate the IR in tests
+var linuxTarget = Target{
+	Arch:   X86_64,
+	Vendor: Unknown,
+	OS:     Linux,
+}
+
+// generateIR runs the full front-end over the source and returns the generated LLVM IR. The test fails if the source
+// has compile errors, or the generator reports internal errors.
+func generateIR(t *testing.T, src string) string {
+	ast, _ := analyze(src)
+	if !assert.Empty(t, ast.Errors) {
+		t.FailNow()
+	}
+
+	gen := NewLLVMGenerator(ast, linuxTarget)
+	mod := gen.Do().String()
+	if !assert.Empty(t, gen.Errors()) {
+		t.FailNow()
+	}
+
+	return mod
+}
+
+func TestForwardFunctionCall(t *testing.T) {
+	mod := generateIR(t, "func main() {\nfoo()\n}\nfunc foo() {\nprint(1)\n}")
+
+	assert.Contains(t, mod, "define void @main()")
+	assert.Contains(t, mod, "call void @maqui_foo()")
+	assert.Contains(t, mod, "define void @maqui_foo()")
+	assert.Equal(t, 1, strings.Count(mod, "define void @maqui_foo()"), "foo must be defined only once")
+}
+
+func TestFunctionMangling(t *testing.T) {
+	mod := generateIR(t, "func foo() {}\nexport func bar() {\nfoo()\n}\nfunc main() {\nbar()\n}")
+
+	assert.Contains(t, mod, "define void @maqui_foo()")
+	assert.Contains(t, mod, "call void @maqui_foo()")
+	assert.Contains(t, mod, "define void @bar()")
+	assert.Contains(t, mod, "call void @bar()")
+	assert.Contains(t, mod, "define void @main()")
+}
+
+func TestBuiltinNameMangling(t *testing.T) {
+	mod := generateIR(t, "func print() {\nprintln(1)\n}\nfunc main() {\nprint()\n}")
+
+	assert.Contains(t, mod, "define void @maqui_print()")
+	assert.Contains(t, mod, "call void @maqui_print()")
+	assert.Contains(t, mod, "define void @maqui.print(")
+}
+
+func TestTargetTriple(t *testing.T) {
+	mod := generateIR(t, "func main() {}")
+
+	assert.Contains(t, mod, `target triple = "x86_64-unknown-linux"`)
+	assert.Contains(t, mod, `target datalayout = "`+linuxTarget.DataLayout()+`"`)
+}
+
+func TestTargetWordType(t *testing.T) {
+	arm64 := Target{
+		Arch:   AArch64,
+		Vendor: Unknown,
+		OS:     Linux,
+	}
+
+	x86 := Target{
+		Arch:   X86,
+		Vendor: Unknown,
+		OS:     Linux,
+	}
+
+	assert.Equal(t, types.I64, NewLLVMIRBuilder(arm64).wordType())
+	assert.Equal(t, types.I32, NewLLVMIRBuilder(x86).wordType())
+
+	ast := &AST{Global: NewGlobalSymbolTable()}
+	assert.Contains(t, NewLLVMGenerator(ast, arm64).Do().String(), "i64 0, i64 0")
+	assert.Contains(t, NewLLVMGenerator(ast, x86).Do().String(), "i32 0, i32 0")
+}
+
+func TestInt64Arithmetic(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := 5000000000\ny := x + 1\nprint(y)\nprint(1)\n}")
+
+	assert.Contains(t, mod, "store i64 5000000000, i64* %0")
+	assert.Contains(t, mod, "add i64 %2, 1")
+	assert.Contains(t, mod, "call void @maqui.print(i64 %")
+	assert.Contains(t, mod, "call void @maqui.print(i64 1)")
+	assert.Contains(t, mod, `c"%lld\00"`)
+}
+
+func TestNegativeLiterals(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := -2147483648\ny := -9223372036854775808\nprint(x)\nprint(y)\n}")
+
+	// The smallest values are constants of their own type, rather than negations that overflow
+	assert.Contains(t, mod, "store i32 -2147483648, i32* %0")
+	assert.Contains(t, mod, "store i64 -9223372036854775808, i64* %1")
+	assert.NotContains(t, mod, "mul")
+}
+
+func TestDivision(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := 3.0 / 2.0\ny := 3 / 2\nz := 3.0 / 2\n}")
+
+	assert.Contains(t, mod, "fdiv double 3.0, 2.0")
+	assert.Contains(t, mod, "sdiv i32 3, 2")
+	assert.NotContains(t, mod, "sdiv double")
+	assert.Equal(t, 2, strings.Count(mod, "fdiv double 3.0, 2.0"))
+}
+
+func TestFormatCall(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := true\nformat(\"%d %s %d\", 1, \"a\", x)\n}")
+
+	// The call goes straight to printf, with the booleans promoted to ints
+	assert.Contains(t, mod, `c"%d %s %d\00"`)
+	assert.Regexp(t, `call i32 \(i8\*, \.\.\.\) @printf\(i8\* getelementptr .*, i32 1, i8\* getelementptr .*, i32 %\d+\)`, mod)
+	assert.NotContains(t, mod, "@maqui.format")
+}
+
+func TestExternCall(t *testing.T) {
+	mod := generateIR(t, "extern func puts(s string) int\nfunc main() {\nn := puts(\"hi\")\nprint(n)\n}")
+
+	assert.Contains(t, mod, "declare i32 @puts(i8* %s)")
+	assert.Contains(t, mod, `constant [3 x i8] c"hi\00"`)
+	assert.Contains(t, mod, "call i32 @puts(i8* getelementptr ([3 x i8], [3 x i8]* @.str.")
+	assert.NotContains(t, mod, "@maqui_puts")
+}
+
+func TestTopLevelVariables(t *testing.T) {
+	ast, _ := analyze("x := 5\nfunc main() {\nprintln(x)\n}")
+	if !assert.Empty(t, ast.Errors) {
+		return
+	}
+
+	// The variables are reported instead of failing once main references them
+	gen := NewLLVMGenerator(ast, linuxTarget)
+	gen.Do()
+
+	if assert.Len(t, gen.Errors(), 1) {
+		assert.Equal(t, ast.Statements[0].Expr.GetLocation(), gen.Errors()[0].GetLocation())
+		assert.Contains(t, gen.Errors()[0].String(), "internal error: top-level variables are not supported yet")
+	}
+}
+
+func TestExternUnknownType(t *testing.T) {
+	ast := &AST{
+		Statements: []*AnnotatedExpr{
+			{
+				Expr: &ExternDecl{
+					Name:   "foo",
+					Params: []*Param{{Name: "v", Type: "bar"}},
+				},
+			},
+		},
+	}
+
+	gen := NewLLVMGenerator(ast, linuxTarget)
+	gen.Do()
+
+	if assert.Len(t, gen.Errors(), 1) {
+		assert.Equal(t, "<nil> internal error: unknown type: bar", gen.Errors()[0].String())
+	}
+}
+
+func TestPrintFormats(t *testing.T) {
+	mod := generateIR(t, "func main() {\nprint(1)\nprintln(2)\n}")
+
+	assert.Contains(t, mod, `@._print_fmt = global [5 x i8] c"%lld\00"`)
+	assert.Contains(t, mod, `@._println_fmt = global [6 x i8] c"%lld\0A\00"`)
+	assert.Contains(t, mod, "call void @maqui.print(i64 1)")
+	assert.Contains(t, mod, "call void @maqui.println(i64 2)")
+}
+
+func TestBoolPrint(t *testing.T) {
+	mod := generateIR(t, "func main() {\nb := 1 == 1\nprint(b)\nprintln(true)\n}")
+
+	assert.Contains(t, mod, "icmp eq i32 1, 1")
+	assert.Contains(t, mod, "call void @maqui.print_i1(i1 %2)")
+	assert.Contains(t, mod, "call void @maqui.println_i1(i1 true)")
+	assert.Contains(t, mod, `c"true\00"`)
+	assert.Contains(t, mod, `c"false\00"`)
+}
+
+func TestFloatAndStringPrint(t *testing.T) {
+	mod := generateIR(t, "func main() {\nprint(2.5)\nprintln(0.5)\nprint(\"a\")\nprintln(\"hi\")\n}")
+
+	assert.Contains(t, mod, "call void @maqui.print_double(double 2.5)")
+	assert.Contains(t, mod, "call void @maqui.println_double(double 0.5)")
+	assert.Contains(t, mod, "call void @maqui.print_i8ptr(i8* ")
+	assert.Contains(t, mod, "call void @maqui.println_i8ptr(i8* ")
+	assert.Contains(t, mod, `c"%g\0A\00"`)
+	assert.Contains(t, mod, `c"%s\0A\00"`)
+}
+
+func TestUnhandledStatement(t *testing.T) {
+	ast := &AST{
+		Statements: []*AnnotatedExpr{
+			{
+				Expr: &FuncDecl{
+					Name: "main",
+					Body: []Expr{
+						&CommentExpr{Text: "not code"},
+						&FuncCall{Callee: &Identifier{Name: "abort"}},
+					},
+				},
+			},
+		},
+	}
+
+	gen := NewLLVMGenerator(ast, linuxTarget)
+	mod := gen.Do().String()
+
+	if assert.Len(t, gen.Errors(), 1) {
+		assert.Equal(t, "<nil> internal error: unexpected statement *maqui.CommentExpr", gen.Errors()[0].String())
+	}
+
+	// The rest of the function is still generated
+	assert.Contains(t, mod, "call void @maqui.abort()")
+}
+
+func TestConditional(t *testing.T) {
+	mod := generateIR(t, "func main() {\nc := 1 == 2\nx := c ? 1 : 2\nprintln(x)\n}")
+
+	assert.Contains(t, mod, "br i1 %3, label %cond.then, label %cond.else")
+	assert.Contains(t, mod, "cond.end:\n\t%4 = phi i32 [ 1, %cond.then ], [ 2, %cond.else ]\n\tstore i32 %4, i32* %1")
+
+	// Only the arm taken is evaluated, so the calls of each arm are made in its own block
+	mod = generateIR(t, "func one() (r int) {\nprint(1)\nr := 1\n}\nfunc two() (r int) {\nprint(2)\nr := 2\n}\n"+
+		"func main() {\nc := 1 == 2\nx := c ? one() : two() + 1\n}")
+
+	assert.Contains(t, mod, "cond.then:\n\t%4 = call i32 @maqui_one()\n\tbr label %cond.end")
+	assert.Contains(t, mod, "cond.else:\n\t%5 = call i32 @maqui_two()\n\t%6 = add i32 %5, 1\n\tbr label %cond.end")
+	assert.Contains(t, mod, "cond.end:\n\t%7 = phi i32 [ %4, %cond.then ], [ %6, %cond.else ]")
+
+	// Nested conditionals join from the block their arm ends in
+	mod = generateIR(t, "func main() {\nc := 1 == 2\nx := c ? 1 : (c ? 2 : 3.5)\n}")
+
+	assert.Contains(t, mod, "cond.end.1:\n\t%5 = phi double [ 2.0, %cond.then.1 ], [ 3.5, %cond.else.1 ]\n\tbr label %cond.end")
+	assert.Contains(t, mod, "cond.end:\n\t%6 = phi double [ 1.0, %cond.then ], [ %5, %cond.end.1 ]")
+}
+
+func TestOperandOrder(t *testing.T) {
+	// Non-commutative operations must keep the order of their operands from the source down to the IR
+	cases := []struct {
+		name   string
+		expr   string
+		expect []string
+	}{
+		{"Subtraction", "10 - 2", []string{"sub i32 10, 2"}},
+		{"ChainedSubtraction", "10 - 2 - 3", []string{"%1 = sub i32 10, 2", "%2 = sub i32 %1, 3"}},
+		{"NestedSubtraction", "10 - (2 - 3)", []string{"%1 = sub i32 2, 3", "%2 = sub i32 10, %1"}},
+		{"Division", "10 / 2", []string{"sdiv i32 10, 2"}},
+		{"ChainedDivision", "10 / 2 / 5", []string{"%1 = sdiv i32 10, 2", "%2 = sdiv i32 %1, 5"}},
+		{"MixedDivision", "10 / 2 * 5", []string{"%1 = sdiv i32 10, 2", "%2 = mul i32 %1, 5"}},
+		{"FloatDivision", "9.0 / 3 / 2", []string{"%1 = fdiv double 9.0, 3.0", "%2 = fdiv double %1, 2.0"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mod := generateIR(t, "func main() {\nx := "+c.expr+"\n}")
+
+			last := -1
+			for _, ins := range c.expect {
+				i := strings.Index(mod, ins)
+				if assert.NotEqual(t, -1, i, "missing instruction %q", ins) {
+					assert.Greater(t, i, last, "instruction %q out of order", ins)
+					last = i
+				}
+			}
+		})
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	mod := generateIR(t, "extern func puts(s string) int\nfunc main() {\nx := 1\nputs(\"x is ${x}, ${x == 1} 100%\")\n}")
+
+	assert.Contains(t, mod, `c"x is %lld, %s 100%%\00"`)
+	assert.Contains(t, mod, "call i32 (i8*, i64, i8*, ...) @snprintf(i8* null, i64 0")
+	assert.Contains(t, mod, "call i8* @malloc(i64 %")
+}
+
+func TestBitwise(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := 6 & 3 | 8\ny := 1 << 4\nz := 6 >> 1 ^ 3\n}")
+
+	assert.Contains(t, mod, "%3 = and i32 6, 3")
+	assert.Contains(t, mod, "%4 = or i32 %3, 8")
+	assert.Contains(t, mod, "%5 = shl i32 1, 4")
+	assert.Contains(t, mod, "%6 = ashr i32 6, 1")
+	assert.Contains(t, mod, "%7 = xor i32 %6, 3")
+}
+
+func TestBitwiseNot(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := ~5\ny := 5000000000\nz := ~y\n}")
+
+	assert.Contains(t, mod, "xor i32 5, -1")
+	assert.Contains(t, mod, "xor i64 %4, -1")
+}
+
+func TestNamedResult(t *testing.T) {
+	mod := generateIR(t, "func answer() (result int) {\nif true {\nresult := 42\nreturn\n}\n}\nfunc main() {\nx := answer()\n}")
+
+	assert.Contains(t, mod, "define i32 @maqui_answer()")
+	assert.Contains(t, mod, "store i32 42, i32* %0")
+	assert.Contains(t, mod, "store i32 0, i32* %0") // The result starts zero-initialized
+	assert.Contains(t, mod, "ret i32 %1")
+	assert.Contains(t, mod, "call i32 @maqui_answer()")
+
+	mod = generateIR(t, "func name() (s string) {}\nfunc main() {\nreturn\n{\nprint(1)\n}\n}")
+
+	assert.Contains(t, mod, "store i8* getelementptr")
+	assert.Contains(t, mod, "ret void")
+}
+
+func TestInferredResult(t *testing.T) {
+	mod := generateIR(t, "func one() {\nc := false\nif c {\nreturn 2\n}\nreturn 1\n}\nfunc main() {\nx := one() + 1\n}")
+
+	assert.Contains(t, mod, "define i32 @maqui_one()")
+	assert.Contains(t, mod, "store i32 2, i32* %0")
+	assert.Contains(t, mod, "store i32 1, i32* %0")
+	assert.Contains(t, mod, "call i32 @maqui_one()")
+
+	mod = generateIR(t, "func main() {\nf := func() {\nreturn 1.5\n}\nx := f()\n}")
+
+	assert.Contains(t, mod, "define internal double @maqui_func.1()")
+	assert.Contains(t, mod, "store double 1.5, double* %0")
+}
+
+func TestNestedBlocks(t *testing.T) {
+	// A return inside a bare block ends the function, returning the named result
+	mod := generateIR(t, "func f() (r int) {\nr := 5\n{\nreturn\n}\n}\nfunc main() {\nx := f()\n}")
+
+	assert.Contains(t, mod, "br label %block\n\nblock:\n\t%1 = load i32, i32* %0\n\tret i32 %1\n\nblock.end:")
+
+	// The block statements nested inside branches and bare blocks get blocks of their own
+	mod = generateIR(t, "func main() {\nc := 1 == 1\nif c {\nif c {\nprint(1)\n}\n}\n{\nif c {\nreturn\n}\n}\n}")
+
+	body := mod[strings.Index(mod, "define void @main()"):]
+
+	var names []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasSuffix(line, ":") {
+			names = append(names, strings.TrimSuffix(line, ":"))
+		}
+	}
+
+	assert.Equal(t, []string{"entry", "if.cond", "if.then", "if.cond.1", "if.then.1", "if.end.1", "if.end", "block",
+		"if.cond.2", "if.then.2", "if.end.2", "block.end"}, names)
+	assert.Contains(t, body, "if.then.2:\n\tret void")
+}
+
+func TestReturnBeforeNewLine(t *testing.T) {
+	// The call on the line after the return is an unreachable statement, not the returned value
+	mod := generateIR(t, "func main() {\nreturn\nprintln(2)\n}")
+
+	assert.Contains(t, mod, "entry:\n\tret void\n\nunreachable:\n\tcall void @maqui.println(i64 2)")
+}
+
+func TestBlockNames(t *testing.T) {
+	mod := generateIR(t, "func main() {\nc := true\nif c {\nprint(1)\n} else {\nprint(2)\n}\nif c {\nprint(3)\n}\n}")
+
+	body := mod[strings.Index(mod, "define void @main()"):]
+
+	var names []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasSuffix(line, ":") {
+			names = append(names, strings.TrimSuffix(line, ":"))
+		}
+	}
+
+	assert.Equal(t, []string{"entry", "if.cond", "if.then", "if.else", "if.end", "if.cond.1", "if.then.1", "if.end.1"}, names)
+}
+
+func TestVariableSlots(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := 1\nx := 3\nif true {\nx := 2\ny := 1.5\n}\nprintln(x)\n}")
+
+	// Declaring x again in the same scope stores into its slot, while the x of the branch shadows it with a slot of its
+	// own
+	assert.Contains(t, mod, "%0 = alloca i32\n\t%1 = alloca i32\n\t%2 = alloca double\n")
+	assert.Contains(t, mod, "store i32 1, i32* %0")
+	assert.Contains(t, mod, "store i32 3, i32* %0")
+	assert.Contains(t, mod, "store i32 2, i32* %1")
+	assert.Contains(t, mod, "store double 1.5, double* %2")
+	assert.Contains(t, mod, "%3 = load i32, i32* %0")
+	assert.Contains(t, mod, "sext i32 %3 to i64")
+
+	// A declaration with another type gets a new slot
+	mod = generateIR(t, "func main() {\nx := 1\nx := 2.0\nprintln(x)\n}")
+
+	assert.Contains(t, mod, "%0 = alloca i32\n\t%1 = alloca double\n")
+	assert.Contains(t, mod, "store double 2.0, double* %1")
+
+	// The x of the bare block shadows the outer one, so it's left untouched
+	mod = generateIR(t, "func main() {\nx := 1\n{\nx := 2\n}\nprintln(x)\n}")
+
+	assert.Contains(t, mod, "store i32 1, i32* %0")
+	assert.Contains(t, mod, "store i32 2, i32* %1")
+	assert.Contains(t, mod, "load i32, i32* %0")
+}
+
+func TestDeferredCalls(t *testing.T) {
+	mod := generateIR(t, "func main() {\ndefer print(1)\nprint(2)\nif true {\nreturn\n}\ndefer print(3)\n}")
+
+	// The deferred calls run before each return, so the early return only runs the first one
+	assert.Contains(t, mod, "if.then:\n\tcall void @maqui.print(i64 1)\n\tret void")
+	assert.Contains(t, mod, "if.end:\n\tcall void @maqui.print(i64 3)\n\tcall void @maqui.print(i64 1)\n\tret void")
+	assert.Equal(t, 2, strings.Count(mod, "call void @maqui.print(i64 1)"))
+
+	// The arguments are evaluated by the defer statement, so declaring x again doesn't change the deferred call
+	mod = generateIR(t, "func main() {\nx := 1\ndefer println(x)\nx := 2.5\nif true {\nreturn\n}\n}")
+
+	assert.Contains(t, mod, "%3 = load i32, i32* %0\n\t%4 = sext i32 %3 to i64\n\tstore i64 %4, i64* %1")
+	assert.Contains(t, mod, "if.then:\n\t%5 = load i64, i64* %1\n\tcall void @maqui.println(i64 %5)\n\tret void")
+	assert.NotContains(t, mod, "call void @maqui.println_double(")
+}
+
+func TestPanicCall(t *testing.T) {
+	mod := generateIR(t, "func main() {\npanic(\"boom\")\n}")
+
+	assert.Contains(t, mod, "define void @maqui.panic(i8* %msg) noreturn")
+	assert.Contains(t, mod, `c"panic: %s\0A\00"`)
+	assert.Contains(t, mod, "call i32 @fflush(i8* null)\n\tcall void @abort()\n\tunreachable")
+	assert.Contains(t, mod, "call void @maqui.panic(i8* getelementptr")
+}
+
+func TestAssertCall(t *testing.T) {
+	mod := generateIR(t, "func main() {\nassert(1 == 1)\n}")
+
+	assert.Contains(t, mod, "define void @maqui.assert(i1 %cond) {\nentry:\n\tbr i1 %cond, label %assert.ok, label %assert.fail")
+	assert.Contains(t, mod, "assert.fail:\n\t%0 = call i32 @fflush(i8* null)\n\tcall void @abort()\n\tunreachable")
+	assert.Contains(t, mod, "%0 = icmp eq i32 1, 1\n\tcall void @maqui.assert(i1 %0)")
+}
+
+func TestFunctionIdentity(t *testing.T) {
+	mod := generateIR(t, "func f() {}\nfunc g() {}\nfunc main() {\nx := f == g\nprint(x)\n}")
+
+	// Functions are compared by identity
+	assert.Contains(t, mod, "icmp eq void ()* @maqui_f, @maqui_g")
+}
+
+func TestFuncLiteralFunction(t *testing.T) {
+	mod := generateIR(t, "func main() {\nf := func() (r int) {\nr := 1\n}\n}")
+
+	// The literal is generated as an internal function, and its pointer is stored in the variable
+	assert.Contains(t, mod, "define internal i32 @maqui_func.1() {\nentry:\n\t%0 = alloca i32\n")
+	assert.Contains(t, mod, "\t%0 = alloca i32 ()*\n\tstore i32 ()* @maqui_func.1, i32 ()** %0\n")
+}
+
+func TestFuncValueCall(t *testing.T) {
+	mod := generateIR(t, "func main() {\nf := func() {}\nf()\nfunc() {}()\n}")
+
+	// The function stored in the variable is loaded before calling it, while the literal is called directly
+	assert.Contains(t, mod, "\tstore void ()* @maqui_func.1, void ()** %0\n\t%1 = load void ()*, void ()** %0\n\tcall void %1()\n")
+	assert.Contains(t, mod, "\tcall void @maqui_func.2()\n")
+}
+
+func TestBlankDeclaration(t *testing.T) {
+	mod := generateIR(t, "func f() (r int) {\nr := 1\n}\nfunc main() {\n_ := f()\n}")
+
+	// The call is still made, but its result is not stored
+	assert.Contains(t, mod, "define void @main() {\nentry:\n\t%0 = call i32 @maqui_f()\n\tret void\n}")
+}
+
+func TestMultiVariableStores(t *testing.T) {
+	mod := generateIR(t, "func main() {\na, b := 1, 2\na, b := b, a\nprint(a)\n}")
+
+	// Both values are loaded before any of them is stored
+	assert.Contains(t, mod, "\t%2 = load i32, i32* %1\n\t%3 = load i32, i32* %0\n\tstore i32 %2, i32* %0\n\tstore i32 %3, i32* %1\n")
+}
+
+func TestElseIfChain(t *testing.T) {
+	mod := generateIR(t, "func main() {\nx := 3\nif x == 1 {\nprint(1)\n} else if x == 2 {\nprint(2)\n}\n}")
+
+	// The condition of the nested if is checked when the first one fails, and both branches exit the whole chain
+	assert.Contains(t, mod, "br i1 %2, label %if.then, label %if.cond.1\n")
+	assert.Contains(t, mod, "br i1 %4, label %if.then.1, label %if.end\n")
+	assert.Contains(t, mod, "if.then.1:\n\tcall void @maqui.print(i64 2)\n\tbr label %if.end\n")
+}
+
+func TestConstantBranches(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+	}{
+		{"False", "if false {\nprint(1)\n}", "if.cond:\n\tbr label %if.end\n\nif.end:\n\tret void"},
+		{"True", "if true {\nprint(1)\n} else {\nprint(2)\n}", "if.cond:\n\tbr label %if.then\n\nif.then:\n\tcall void @maqui.print(i64 1)\n\tbr label %if.end\n\nif.end:"},
+		{"FalseElse", "if false {\nprint(1)\n} else {\nprint(2)\n}", "if.cond:\n\tbr label %if.else\n\nif.else:\n\tcall void @maqui.print(i64 2)\n\tbr label %if.end\n\nif.end:"},
+		{"FoldedComparison", "if 1 == 2 {\nprint(1)\n}", "if.cond:\n\tbr label %if.end\n\nif.end:"},
+		{"FalseElseIf", "if false {\nprint(1)\n} else if true {\nprint(2)\n}", "if.cond:\n\tbr label %if.cond.1\n\nif.cond.1:\n\tbr label %if.then.1\n\nif.then.1:\n\tcall void @maqui.print(i64 2)"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			mod := generateIR(t, "func main() {\n"+c.src+"\n}")
+
+			assert.Contains(t, mod, c.expect)
+
+			// Only the builtins branch on a condition
+			main := mod[strings.Index(mod, "@main("):]
+			assert.NotContains(t, main, "br i1")
+		})
+	}
+
+	// The branch not taken emits no calls
+	mod := generateIR(t, "func main() {\nif false {\nprint(1)\n}\n}")
+	assert.NotContains(t, mod, "call void @maqui.print(")
+}
+
+func TestOverflowingConditionNotFolded(t *testing.T) {
+	// int wraps at 32 bits at runtime, so the condition is true and can't be folded as false
+	mod := generateIR(t, "func main() {\nif (2147483647 + 1) == -2147483648 {\nprint(1)\n} else {\nprint(2)\n}\n}")
+	main := mod[strings.Index(mod, "@main("):]
+	assert.Contains(t, main, "br i1")
+	assert.Contains(t, main, "icmp eq i32")
+}
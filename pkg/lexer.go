@@ -2,11 +2,15 @@ package maqui
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -21,8 +25,11 @@ type lexerState func(l *Lexer) lexerState
 
 //go:generate stringer -type=TokenType -trimprefix=Token
 const (
-	// EOF is returned by the lexer when a new rune is fetched from the stream, but it was already exhausted.
-	EOF rune = 0
+	// EOF is returned by the lexer when a new rune is fetched from the stream, but it was already exhausted. It's
+	// negative so it can't collide with any valid rune, including NUL.
+	EOF rune = -1
+	// InvalidUTF8 is returned by the lexer when the next bytes of the stream are not a valid UTF-8 encoding.
+	InvalidUTF8 rune = -2
 
 	// TokenError denotes a lexing error. The value of the token should contain further error details.
 	TokenError TokenType = iota
@@ -33,8 +40,11 @@ const (
 	// specific type of number, and can hold any of decimal, integer or complex numbers.
 	TokenNumber
 	// TokenString denotes a [Token] which holds a string value. The surrounding double-quotes (") are removed, and only
-	// the inner value of the string should be found inside the [Token].
+	// the inner value of the string should be found inside the [Token], with its escape sequences already replaced.
 	TokenString
+	// TokenBool denotes a boolean value, from the 'true' and 'false' keywords. The value of the [Token] holds the
+	// keyword.
+	TokenBool
 
 	// TokenIdentifier holds any identifier, that is, any non double-quoted (") text. An identifier might be a function,
 	// variable, type and so on. No assumptions are made over the identifier, and it might be invalid or undeclared. Any
@@ -74,21 +84,66 @@ const (
 	TokenIf
 	// TokenElse denotes the 'else' keyword.
 	TokenElse
+	// TokenExport denotes the 'export' keyword.
+	TokenExport
+	// TokenExtern denotes the 'extern' keyword.
+	TokenExtern
 
 	// TokenBooleanEquals denotes the '==' symbol, a boolean equality comparator.
 	TokenBooleanEquals
+
+	// TokenQuestion denotes the question mark symbol ('?'), that starts the arms of a conditional expression.
+	TokenQuestion
+	// TokenColon denotes the colon symbol (':'), that separates the arms of a conditional expression.
+	TokenColon
+
+	// TokenInterpolatedString denotes a string containing one or more interpolations (${...}). As with [TokenString],
+	// the surrounding double-quotes (") are removed, and the value holds the verbatim content of the string, including
+	// the interpolations and the escape sequences.
+	TokenInterpolatedString
+
+	// TokenAmpersand denotes the ampersand symbol ('&'), the bitwise and operator.
+	TokenAmpersand
+	// TokenPipe denotes the pipe symbol ('|'), the bitwise or operator.
+	TokenPipe
+	// TokenCaret denotes the caret symbol ('^'), the bitwise exclusive or operator.
+	TokenCaret
+	// TokenShiftLeft denotes the '<<' symbol, the left shift operator.
+	TokenShiftLeft
+	// TokenShiftRight denotes the '>>' symbol, the arithmetic right shift operator.
+	TokenShiftRight
+	// TokenTilde denotes the tilde symbol ('~'), the bitwise not operator.
+	TokenTilde
+
+	// TokenImport denotes the 'import' keyword.
+	TokenImport
+	// TokenDot denotes the dot symbol ('.'), that separates the name of an imported module from the name of its
+	// functions.
+	TokenDot
+	// TokenReturn denotes the 'return' keyword.
+	TokenReturn
+	// TokenDefer denotes the 'defer' keyword.
+	TokenDefer
 )
 
 // keywordTable holds all the defined keywords and their respective token. It's used to lookup if an identifier
 // corresponds to a keyword.
 var keywordTable = map[string]TokenType{
-	"func": TokenFunc,
-	"if":   TokenIf,
-	"else": TokenElse,
+	"func":   TokenFunc,
+	"if":     TokenIf,
+	"else":   TokenElse,
+	"export": TokenExport,
+	"extern": TokenExtern,
+	"import": TokenImport,
+	"return": TokenReturn,
+	"defer":  TokenDefer,
+	"true":   TokenBool,
+	"false":  TokenBool,
 }
 
 // operatorTable holds a map between operator symbols and their token. It's used to check if a given string corresponds
-// to an operator token.
+// to an operator token. Operators of any length can be added to it, as the lexer always takes the longest one the
+// stream starts with.
 var operatorTable = map[string]TokenType{
 	"+":  TokenPlus,
 	"-":  TokenMinus,
@@ -102,6 +157,41 @@ var operatorTable = map[string]TokenType{
 	"}":  TokenCloseCurly,
 	",":  TokenComma,
 	"==": TokenBooleanEquals,
+	"?":  TokenQuestion,
+	":":  TokenColon,
+	"&":  TokenAmpersand,
+	"|":  TokenPipe,
+	"^":  TokenCaret,
+	"<<": TokenShiftLeft,
+	">>": TokenShiftRight,
+	"~":  TokenTilde,
+	".":  TokenDot,
+}
+
+// operatorCandidates maps the first rune of each operator of the [operatorTable] to all the operators starting with it,
+// longest first
+var operatorCandidates = groupOperators(operatorTable)
+
+// groupOperators groups the operators of the table by their first rune, sorting each group from the longest operator to
+// the shortest
+func groupOperators(table map[string]TokenType) map[rune][]string {
+	groups := make(map[rune][]string)
+	for op := range table {
+		r, _ := utf8.DecodeRuneInString(op)
+		groups[r] = append(groups[r], op)
+	}
+
+	for _, group := range groups {
+		sort.Slice(group, func(i, j int) bool {
+			if len(group[i]) != len(group[j]) {
+				return len(group[i]) > len(group[j])
+			}
+
+			return group[i] < group[j]
+		})
+	}
+
+	return groups
 }
 
 // Token contains a lexicographical token parsed from the input stream. A Token contains its type, an optional semantic
@@ -126,6 +216,11 @@ type Location struct {
 	Start uint64
 	End   uint64
 	File  string
+	// Line is the line of the position, starting from 1, when it's set by a line directive (//line file:N). It's 0
+	// otherwise, and the line is found from the offsets instead. The offsets always point to the file that was lexed.
+	Line uint64
+	// NewLine is true if a new-line, or the end of a file, separates the token at the position from the previous one
+	NewLine bool
 }
 
 // Tokenizer defines a lexer that transforms a given stream of text into a sequential series of Tokens.
@@ -146,9 +241,13 @@ type Lexer struct {
 	// filename is the location of the original file in disk. The provided path might be relative or absolute.
 	filename string
 
-	// reader is the current stream.
+	// reader is the current stream. It's nil if the lexer reads from src instead.
 	reader *bufio.Reader
 
+	// src holds the whole source when the lexer was created from a byte slice. Runes are decoded directly from it,
+	// indexed by pos.
+	src []byte
+
 	// output is the result channel of the lexer. Once a [Token] is ready its immediately placed on the channel.
 	output chan Token
 
@@ -156,13 +255,50 @@ type Lexer struct {
 	// error management, and not as a marker for the stream. Once a token is emitted start is set to equal pos.
 	start uint64
 
-	// pos is the current position of the lexer. It gets incremented every time a new rune is fetched from the stream
+	// pos is the current byte offset of the lexer. It gets incremented by the width of every rune fetched from the
+	// stream
 	pos uint64
+
+	// width is the size in bytes of the last rune fetched from the stream. It's used to roll back the position on peek.
+	width int
+
+	// sources holds the readers still to be lexed after the current one, when the lexer was created from several of
+	// them. They are lexed in order, as a continuation of the stream.
+	sources []NamedReader
+
+	// buf holds the text of the token being built by the current state. It's reused by every token, so building one
+	// doesn't allocate more than its final value. It's cleared by reset.
+	buf []byte
+
+	// lines is the number of new-lines consumed from the current source, and startLines the number of them before start
+	lines, startLines uint64
+
+	// newLine is true if a new-line was skipped since the last token was emitted, or if the current source followed
+	// another one and no token was emitted from it yet
+	newLine bool
+
+	// directive holds the last line directive found in the current source, or nil if none was
+	directive *lineDirective
+}
+
+// lineDirective overrides the file and line of the tokens that follow it. The line after the directive gets its line.
+type lineDirective struct {
+	// file is the name of the file the tokens are reported in
+	file string
+	// line is the line the source following the directive is reported as
+	line uint64
+	// lines is the number of new-lines the lexer consumed up to the line following the directive
+	lines uint64
 }
 
-// NewLexer creates a lexer and sets the stream to the file at the provided path.
+// tokenBufferSize is the number of tokens the lexer can emit ahead of its consumer. A larger buffer lets the lexer and
+// the parser run without handing control to each other on every token.
+const tokenBufferSize = 64
+
+// NewLexer creates a lexer and sets the stream to the file at the provided path. If the file can't be opened, a
+// *SourceError is returned.
 func NewLexer(filename string) (*Lexer, error) {
-	f, err := os.Open(filename)
+	f, err := OpenSource(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -173,11 +309,84 @@ func NewLexer(filename string) (*Lexer, error) {
 	return l, nil
 }
 
+// OpenSource opens the source file at the path for reading. If it can't be opened, a *SourceError telling why is
+// returned.
+func OpenSource(filename string) (*os.File, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, &SourceError{Path: filename, Err: err}
+	}
+
+	return f, nil
+}
+
+// SourceError is returned when a source can't be read. It wraps the error of the file system, so errors.Is can tell a
+// missing source (fs.ErrNotExist) apart from one without read permissions (fs.ErrPermission).
+type SourceError struct {
+	// Path is the path of the source
+	Path string
+	// Err is the error of the file system
+	Err error
+}
+
+func (e *SourceError) Error() string {
+	switch {
+	case errors.Is(e.Err, fs.ErrNotExist):
+		return fmt.Sprintf("source not found: %s", e.Path)
+	case errors.Is(e.Err, fs.ErrPermission):
+		return fmt.Sprintf("permission denied reading the source %s", e.Path)
+	default:
+		return fmt.Sprintf("can't read the source %s: %v", e.Path, e.Err)
+	}
+}
+
+// Unwrap returns the error of the file system
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
 // NewLexerFromReader creates a lexer and sets the stream to the provided reader.
 func NewLexerFromReader(reader io.Reader) *Lexer {
 	return &Lexer{
 		reader: bufio.NewReader(reader),
-		output: make(chan Token, 2),
+		output: make(chan Token, tokenBufferSize),
+	}
+}
+
+// NamedReader is a source of code along with the name of the file it comes from.
+type NamedReader struct {
+	// Name is the name of the file, used for the locations of its tokens
+	Name string
+	// Reader is the stream of the source
+	Reader io.Reader
+}
+
+// NewLexerFromReaders creates a lexer that lexes the sources in order, as a single stream, like a naive include would
+// concatenate them. Each source starts a new token, so a token can't span two of them. The locations of the tokens
+// point to the file they come from, with their offsets relative to its start. A single [TokenEOF] is emitted once the
+// last source is exhausted, and lexing stops at the first error.
+func NewLexerFromReaders(sources ...NamedReader) *Lexer {
+	l := &Lexer{
+		output: make(chan Token, tokenBufferSize),
+	}
+
+	if len(sources) == 0 {
+		l.reader = bufio.NewReader(strings.NewReader(""))
+		return l
+	}
+
+	l.filename, l.reader = sources[0].Name, bufio.NewReader(sources[0].Reader)
+	l.sources = sources[1:]
+
+	return l
+}
+
+// NewLexerFromBytes creates a lexer that reads directly from the provided source, without wrapping it in a reader.
+// It's the cheapest option when the source is already in memory. The slice must not be modified while lexing.
+func NewLexerFromBytes(src []byte) *Lexer {
+	return &Lexer{
+		src:    src,
+		output: make(chan Token, tokenBufferSize),
 	}
 }
 
@@ -200,16 +409,16 @@ func (l *Lexer) GetFilename() string {
 
 // Do starts lexing on a goroutine, and sends the completed tokens to the results channel.
 func (l *Lexer) Do() {
-	for state := startState; state != nil; {
+	for state := headerState; state != nil; {
 		state = state(l)
 	}
 
 	close(l.output)
 }
 
-// Run lexes the stream sequentially and blocks until the full output is ready or an error is encountered. [Do] and
-// [Get] should always be preferred for parallelizable workloads. Internally [Run] wraps these methods in a blocking
-// manner.
+// Run lexes the stream sequentially and blocks until the full output is ready or an error is encountered. If an error
+// is found, the tokens lexed before it are returned along with it. [Do] and [Get] should always be preferred for
+// parallelizable workloads. Internally [Run] wraps these methods in a blocking manner.
 func (l *Lexer) Run() ([]Token, error) {
 	go l.Do()
 
@@ -222,7 +431,7 @@ func (l *Lexer) Run() ([]Token, error) {
 			}
 
 			if t.Typ == TokenError {
-				return nil, errors.New(t.Value)
+				return tokens, errors.New(t.Value)
 			}
 
 			tokens = append(tokens, t)
@@ -230,21 +439,87 @@ func (l *Lexer) Run() ([]Token, error) {
 	}
 }
 
+// Tokenize lexes the whole source and returns its tokens, along with their locations. Unlike [Lexer.Run], a lexing
+// error is returned as a [CompileError] pointing to where it was found, so it can be reported like any other. The
+// tokens lexed before the error are returned too, which is enough for tools like syntax highlighters.
+func Tokenize(src string) ([]Token, []CompileError) {
+	l := NewLexerFromReader(strings.NewReader(src))
+	go l.Do()
+
+	var tokens []Token
+	var errs []CompileError
+	for t := range l.Chan() {
+		switch t.Typ {
+		case TokenEOF:
+		case TokenError:
+			errs = append(errs, &LexerError{
+				Loc: t.Loc,
+				Msg: t.Value,
+			})
+		default:
+			tokens = append(tokens, t)
+		}
+	}
+
+	return tokens, errs
+}
+
+type LexerError struct {
+	Loc *Location
+	Msg string
+}
+
+func (e LexerError) String() string {
+	return fmt.Sprintf("%s lexing error: %s", e.Loc, e.Msg)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e LexerError) GetLocation() *Location {
+	return e.Loc
+}
+
+// headerState is the first state of the lexer. It skips a leading UTF-8 byte order mark (BOM) and a shebang line
+// (#!/usr/bin/env maqui), if present, so the file can be run as a script. The shebang is discarded as a comment would,
+// but no token is emitted for it. A [startState] is always returned.
+func headerState(l *Lexer) lexerState {
+	if l.peek() == '\uFEFF' {
+		l.next()
+	}
+
+	if l.hasPrefix("#!") {
+		for r := l.peek(); r != '\n' && r != EOF; r = l.peek() {
+			l.next()
+		}
+	}
+
+	l.start, l.startLines = l.pos, l.lines
+
+	return startState
+}
+
 // startState is the default state of the lexer. Once a state has been depleted, [startState] should be used to pick the
 // next one.
 func startState(l *Lexer) lexerState {
 	for {
 		switch r := l.peek(); {
 		case unicode.IsSpace(r):
-			l.next()
+			if l.next() == '\n' {
+				l.newLine = true
+			}
+
+			l.start, l.startLines = l.pos, l.lines // Tokens don't include the leading whitespace
 			continue
 		case r == EOF:
 			return endState
+		case r == InvalidUTF8:
+			return l.errorf("invalid UTF-8 encoding at byte %d", l.pos)
 		case '0' <= r && r <= '9':
 			return numberState
 		case r == '"':
 			return stringState
-		case unicode.IsLetter(r):
+		case r == '`':
+			return rawStringState
+		case isIdentifierRune(r):
 			return identifierState
 		default:
 			return operatorState
@@ -253,111 +528,331 @@ func startState(l *Lexer) lexerState {
 }
 
 // numberState is entered once a digit is found in the stream. The state concatenates the numeric value found
-// until the next token is no longer numeric. A [Token] is then emitted as a [TokenNumber] with its value set to the
-// parsed number.
+// until the next token is no longer numeric. A decimal point followed by the fractional digits is also accepted, as is
+// an exponent in scientific notation (1.5e10, 2E-3). Hexadecimal floats (0x1.8p3) are accepted as well, and they always
+// require a binary exponent. A [Token] is then emitted as a [TokenNumber] with its value set to the parsed number.
+//
+// Malformed numbers emit an error instead: a decimal point without fractional digits (1.), a second decimal point
+// (1.2.3), an exponent without digits (1e, 1e+), a hexadecimal float without its exponent (0x1.8) or a number running
+// into a letter (12ab).
 func numberState(l *Lexer) lexerState {
-	var num strings.Builder
-	for r := l.peek(); '0' <= r && r <= '9'; r = l.peek() {
-		num.WriteRune(l.next())
+	l.reset()
+	l.write(l.next())
+
+	isDigit := isDecimalDigit
+	exponent := "eE"
+	if string(l.buf) == "0" && (l.peek() == 'x' || l.peek() == 'X') {
+		l.write(l.next())
+		isDigit, exponent = isHexDigit, "pP"
+	}
+
+	for r := l.peek(); isDigit(r); r = l.peek() {
+		l.write(l.next())
+	}
+
+	if l.peek() == '.' {
+		l.write(l.next())
+
+		fractional := false
+		for r := l.peek(); isDigit(r); r = l.peek() {
+			l.write(l.next())
+			fractional = true
+		}
+
+		if !fractional {
+			return l.errorf("malformed number %q: expected digits after the decimal point", l.text())
+		}
 	}
 
-	return l.emmitValue(TokenNumber, num.String())
+	if strings.ContainsRune(exponent, l.peek()) {
+		l.write(l.next())
+		if r := l.peek(); r == '+' || r == '-' {
+			l.write(l.next())
+		}
+
+		// The exponent is always decimal, even for hexadecimal floats
+		digits := false
+		for r := l.peek(); isDecimalDigit(r); r = l.peek() {
+			l.write(l.next())
+			digits = true
+		}
+
+		if !digits {
+			return l.errorf("malformed number %q: expected digits in the exponent", l.text())
+		}
+	} else if exponent == "pP" {
+		return l.errorf("malformed number %q: expected a 'p' exponent in the hexadecimal float", l.text())
+	}
+
+	if r := l.peek(); r == '.' || isIdentifierRune(r) {
+		l.write(l.next())
+		return l.errorf("malformed number %q", l.text())
+	}
+
+	return l.emmitValue(TokenNumber, l.text())
+}
+
+// isDecimalDigit returns true if the rune is a decimal digit (0-9)
+func isDecimalDigit(r rune) bool {
+	return '0' <= r && r <= '9'
+}
+
+// isHexDigit returns true if the rune is a hexadecimal digit (0-9, a-f or A-F)
+func isHexDigit(r rune) bool {
+	return isDecimalDigit(r) || ('a' <= r && r <= 'f') || ('A' <= r && r <= 'F')
 }
 
 // stringState is entered once a leading double-quote (") is found. The state builds a string, concatenating characters
 // from the stream until a closing double-quote (") is found. A token is then emitted of type [TokenString] and value
 // set to the parsed text. It might emmit an error if an unclosed string is found, in this case no [TokenString] is
 // generated.
+//
+// A backslash escapes the character that follows it, which must be a double-quote, a backslash or a dollar sign, so
+// "\"", "\\" and "\${" stand for a double-quote, a backslash and a "${" that is not an interpolation.
+//
+// If the string holds an interpolation (${...}) a [TokenInterpolatedString] is emitted instead. The content of the
+// interpolations is kept as is, and parsed later on, as are the escape sequences of the string. An interpolation can't
+// contain double-quotes.
 func stringState(l *Lexer) lexerState {
 	l.next() // Skip the leading double-quote
 
-	var str strings.Builder
+	typ := TokenString
+
+	l.reset()
 	for r := l.next(); r != '"'; r = l.next() {
 		if r == EOF {
-			return l.errorf("unclosed string: %s", str.String())
+			return l.errorf("unclosed string: %s", l.text())
+		}
+
+		if r == InvalidUTF8 {
+			return l.errorf("invalid UTF-8 encoding at byte %d", l.pos-1)
+		}
+
+		l.write(r)
+
+		if r == '\\' {
+			e := l.next()
+			if e == EOF {
+				return l.errorf("unclosed string: %s", l.text())
+			}
+
+			if !strings.ContainsRune(stringEscapes, e) {
+				return l.errorf("unknown escape sequence: \\%c", e)
+			}
+
+			l.write(e)
+			continue
+		}
+
+		if r == '$' && l.peek() == '{' {
+			typ = TokenInterpolatedString
+
+			for r = l.next(); r != '}'; r = l.next() {
+				if r == '"' || r == EOF {
+					return l.errorf("unclosed interpolation: %s", l.text())
+				}
+
+				if r == InvalidUTF8 {
+					return l.errorf("invalid UTF-8 encoding at byte %d", l.pos-1)
+				}
+
+				l.write(r)
+			}
+
+			l.write(r)
+		}
+	}
+
+	if typ == TokenString {
+		return l.emmitValue(typ, unescapeString(l.text()))
+	}
+
+	return l.emmitValue(typ, l.text())
+}
+
+// stringEscapes holds the characters a backslash can escape inside a double-quoted string
+const stringEscapes = `"\$`
+
+// unescapeString replaces the escape sequences of the verbatim content of a double-quoted string by the characters they
+// escape
+func unescapeString(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+
+	var str strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+
+		str.WriteByte(s[i])
+	}
+
+	return str.String()
+}
+
+// escapeString escapes the characters of a value that can't appear verbatim inside a double-quoted string, that is, the
+// double-quotes, the backslashes, and the dollar signs that would start an interpolation
+func escapeString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+
+	return strings.ReplaceAll(s, "${", `\${`)
+}
+
+// rawStringState is entered once a leading backtick (`) is found. The state builds a string from the verbatim content of
+// the stream until a closing backtick is found, including any new-lines. A token of type [TokenString] is then emitted.
+// It might emmit an error if the string is unclosed, in this case no [TokenString] is generated.
+func rawStringState(l *Lexer) lexerState {
+	l.next() // Skip the leading backtick
+
+	l.reset()
+	for r := l.next(); r != '`'; r = l.next() {
+		if r == EOF {
+			return l.errorf("unclosed raw string: %s", l.text())
 		}
 
-		str.WriteRune(r)
+		if r == InvalidUTF8 {
+			return l.errorf("invalid UTF-8 encoding at byte %d", l.pos-1)
+		}
+
+		l.write(r)
 	}
 
-	return l.emmitValue(TokenString, str.String())
+	return l.emmitValue(TokenString, l.text())
 }
 
 // identifierState is entered when a non-escaped string is found in the stream. The state builds the identifier by
 // consuming from the stream up to the moment a not valid identifier character is found. If the identifier does not
 // match a keyword the state emits a Token of type [TokenIdentifier] and the value set to the identifier. If the
 // identifier is a keyword the keyword's type is emitted, based on the [keywordTable].
+//
+// Identifiers are made of letters and underscores (_). A lone underscore is the blank identifier.
 func identifierState(l *Lexer) lexerState {
-	var id strings.Builder
-	for r := l.peek(); unicode.IsLetter(r); r = l.peek() {
-		id.WriteRune(l.next())
+	l.reset()
+	for r := l.peek(); isIdentifierRune(r); r = l.peek() {
+		l.write(l.next())
 	}
 
-	if t, ok := keywordTable[id.String()]; ok {
-		return l.emmitValue(t, id.String())
+	if t, ok := keywordTable[string(l.buf)]; ok {
+		return l.emmitValue(t, l.text())
 	}
 
-	return l.emmitValue(TokenIdentifier, id.String())
+	return l.emmitValue(TokenIdentifier, l.text())
+}
+
+// isIdentifierRune returns true if the rune can be part of an identifier, that is, if it's a letter or an underscore
+func isIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
 }
 
-// operatorState is entered once a symbol matching an operator is found. If the operator starts a comment ("//" or "/*")
-// the leading operator is consumed and a comment state is returned. If the operator is valid (present in the
-// [operatorTable]), the corresponding token type is emitted, otherwise an error will be emitted.
+// operatorState is entered once a symbol that is not part of an identifier, number or string is found. The longest
+// operator of the [operatorTable] the stream starts with is consumed (maximal munch), so "<<" is never lexed as two
+// "<". If the operator starts a comment ("//") a comment state is returned, otherwise the corresponding token type is
+// emitted. If no operator matches, an error will be emitted.
 func operatorState(l *Lexer) lexerState {
-	r := l.next()
-	if r == ':' || r == '/' || r == '=' { // Some operators can be two runes
-		op := string(r) + string(l.peek())
-		if tok, ok := operatorTable[string(r)+string(l.peek())]; ok {
-			l.next() // Skip
+	r := l.peek()
+	for _, op := range operatorCandidates[r] {
+		if !l.hasPrefix(op) {
+			continue
+		}
 
-			if tok == TokenLineComment {
-				return lineCommentState
-			}
+		for range op {
+			l.next()
+		}
 
-			return l.emmitValue(tok, op)
+		tok := operatorTable[op]
+		if tok == TokenLineComment {
+			return lineCommentState
 		}
-	}
 
-	if tok, ok := operatorTable[string(r)]; ok {
-		return l.emmitValue(tok, string(r))
+		return l.emmitValue(tok, op)
 	}
 
-	return l.errorf("invalid symbol '%c'", r)
+	l.next()
+	return l.errorf("invalid symbol %q", r)
 }
 
 // lineCommentState is entered when a leading "//" is found. It's expected that the "//" operator is already
 // consumed when this state is entered. The state builds the comment by reading all runes from the stream until
 // the rune matches a new-line ("/n") or the end-of-file is reached. The emitted token is of type [TokenLineComment]
 // and holds the comment as a value.
+//
+// A comment of the form "//line file:N" is a line directive: the tokens of the lines that follow it are located in the
+// given file, with the next line being line N, so code generators can point the diagnostics at the source they
+// generated the code from. Comments that are not valid directives are kept as regular comments.
 func lineCommentState(l *Lexer) lexerState {
-	var id strings.Builder
+	l.reset()
 	for r := l.peek(); r != '\n' && r != EOF; r = l.peek() {
-		id.WriteRune(l.next())
+		if r == InvalidUTF8 {
+			return l.errorf("invalid UTF-8 encoding at byte %d", l.pos)
+		}
+
+		l.write(l.next())
 	}
 
-	return l.emmitValue(TokenLineComment, id.String())
+	if d, ok := parseLineDirective(string(l.buf)); ok {
+		d.lines = l.lines + 1
+		l.directive = d
+	}
+
+	return l.emmitValue(TokenLineComment, l.text())
+}
+
+// parseLineDirective parses the text of a comment as a line directive ("line file:N"), returning false if it isn't a
+// valid one. The file is split at the last colon, so it can hold colons itself.
+func parseLineDirective(comment string) (*lineDirective, bool) {
+	if !strings.HasPrefix(comment, "line ") {
+		return nil, false
+	}
+
+	arg := strings.TrimSpace(strings.TrimPrefix(comment, "line "))
+
+	i := strings.LastIndexByte(arg, ':')
+	if i <= 0 {
+		return nil, false
+	}
+
+	line, err := strconv.ParseUint(arg[i+1:], 10, 64)
+	if err != nil || line == 0 {
+		return nil, false
+	}
+
+	return &lineDirective{file: arg[:i], line: line}, true
 }
 
-// endState emits an end-of-file token and finishes the execution by returning a nil state as a result.
+// endState emits an end-of-file token and finishes the execution by returning a nil state as a result. If there are
+// sources left, the lexer moves to the next one instead, and a [headerState] is returned.
 func endState(l *Lexer) lexerState {
-	l.emmitNext(TokenEOF)
+	if len(l.sources) != 0 {
+		next := l.sources[0]
+		l.sources = l.sources[1:]
+
+		l.filename, l.reader = next.Name, bufio.NewReader(next.Reader)
+		l.start, l.pos, l.width = 0, 0, 0
+		l.lines, l.startLines, l.directive = 0, 0, nil
+		l.newLine = true
+
+		return headerState
+	}
+
+	l.emmitValue(TokenEOF, "")
 	return nil
 }
 
-// errorf is a shorthand for emitting a [TokenError] token with its value set to formatted string.
+// errorf is a shorthand for emitting a [TokenError] token with its value set to formatted string. The sources left are
+// discarded, since lexing stops at the error.
 func (l *Lexer) errorf(format string, args ...interface{}) lexerState {
 	l.output <- Token{
 		Typ:   TokenError,
 		Value: fmt.Sprintf(format, args...),
+		Loc:   l.location(),
 	}
 
-	return endState
-}
+	l.sources = nil
 
-// emmitNext is a shorthand for emitting a token of the t type, and setting its value to the next token in the stream.
-// The stream is advanced one position.
-func (l *Lexer) emmitNext(t TokenType) lexerState {
-	return l.emmitValue(t, string(l.next()))
+	return endState
 }
 
 // emmitValue emits a value of type t and value val. The location of the emitted token is resolved by the lexer's
@@ -369,27 +864,69 @@ func (l *Lexer) emmitValue(t TokenType, val string) lexerState {
 		Loc:   l.location(),
 	}
 
-	l.start = l.pos
+	l.start, l.startLines = l.pos, l.lines
+	l.newLine = false
 
 	return startState
 }
 
+// reset clears the text of the token being built, keeping the memory of the buffer
+func (l *Lexer) reset() {
+	l.buf = l.buf[:0]
+}
+
+// write appends the rune to the text of the token being built
+func (l *Lexer) write(r rune) {
+	l.buf = utf8.AppendRune(l.buf, r)
+}
+
+// text returns the text of the token being built. The string is a copy, so it stays valid once the buffer is reused.
+func (l *Lexer) text() string {
+	return string(l.buf)
+}
+
 // peek returns the next rune on the stream without advancing its position.
 func (l *Lexer) peek() rune {
-	r := l.next()
-	if r != EOF && r != utf8.RuneError {
-		l.pos-- // Revert position incrementer
+	if l.reader == nil {
+		r, _ := l.decode()
+		return r
 	}
 
-	_ = l.reader.UnreadRune()
+	r := l.next()
+
+	// Only a rune that was actually read is reverted, so the position never goes below the start of the stream, even at
+	// the end of an empty one
+	if l.width != 0 && l.pos >= uint64(l.width) {
+		l.pos -= uint64(l.width)
+		_ = l.reader.UnreadRune()
+
+		if r == '\n' {
+			l.lines--
+		}
+	}
 
 	return r
 }
 
-// next fetches the next rune in the stream and consumes it by advancing one position.
+// next fetches the next rune in the stream and consumes it by advancing the position by its width. If the stream is
+// exhausted [EOF] is returned, and if the next bytes are not valid UTF-8 the invalid byte is consumed and [InvalidUTF8]
+// is returned.
 func (l *Lexer) next() rune {
-	r, _, err := l.reader.ReadRune()
+	if l.reader == nil {
+		r, size := l.decode()
+		l.width = size
+		l.pos += uint64(size)
+
+		if r == '\n' {
+			l.lines++
+		}
+
+		return r
+	}
+
+	r, size, err := l.reader.ReadRune()
 	if err != nil {
+		l.width = 0
 		if err == io.EOF {
 			return EOF
 		}
@@ -397,32 +934,127 @@ func (l *Lexer) next() rune {
 		return utf8.RuneError
 	}
 
-	l.pos++
+	l.width = size
+	l.pos += uint64(size)
+
+	if r == '\n' {
+		l.lines++
+	}
+
+	if r == utf8.RuneError && size == 1 {
+		return InvalidUTF8
+	}
+
 	return r
 }
 
-// location returns the current location data of the lexer.
+// decode returns the rune of the source at the current position and its width, without consuming it. It's only used
+// when the lexer reads from a byte slice.
+func (l *Lexer) decode() (rune, int) {
+	if l.pos >= uint64(len(l.src)) {
+		return EOF, 0
+	}
+
+	r, size := utf8.DecodeRune(l.src[l.pos:])
+	if r == utf8.RuneError && size == 1 {
+		return InvalidUTF8, size
+	}
+
+	return r, size
+}
+
+// hasPrefix returns true if the stream continues with the given prefix. The stream is not advanced.
+func (l *Lexer) hasPrefix(prefix string) bool {
+	if l.reader == nil {
+		return bytes.HasPrefix(l.src[l.pos:], []byte(prefix))
+	}
+
+	b, _ := l.reader.Peek(len(prefix))
+	return string(b) == prefix
+}
+
+// location returns the current location data of the lexer. After a line directive the file and line it sets are used.
 func (l *Lexer) location() *Location {
-	return &Location{
-		File:  l.filename,
-		Start: l.start,
-		End:   l.pos,
+	loc := &Location{
+		File:    l.filename,
+		Start:   l.start,
+		End:     l.pos,
+		NewLine: l.newLine,
+	}
+
+	if d := l.directive; d != nil && l.startLines >= d.lines {
+		loc.File = d.file
+		loc.Line = d.line + l.startLines - d.lines
 	}
+
+	return loc
 }
 
-// String pretty formats the location data.
+// String pretty formats the location data. Locations set by a line directive are formatted by their line, since their
+// offsets point to another file.
 func (m *Location) String() string {
+	if m.Line != 0 {
+		return fmt.Sprintf("%s:%d", path.Base(m.File), m.Line)
+	}
+
 	return fmt.Sprintf("%s:[%d:%d]", path.Base(m.File), m.Start, m.End)
 }
 
+// GoString formats the token for debugging, like Token{Identifier, "foo"}. It's used by the %#v verb, so test failures
+// show the name of the token type instead of its number. The location is left out.
+func (t Token) GoString() string {
+	return fmt.Sprintf("Token{%s, %q}", t.Typ, t.Value)
+}
+
+// Render reconstructs the source code of the token, so lexing the result yields an equivalent token. Strings get their
+// surrounding double-quotes back, and comments their leading "//" and trailing new-line. Tokens of type [TokenEOF] and
+// [TokenError] have no source representation and render as an empty string.
+func (t Token) Render() string {
+	switch t.Typ {
+	case TokenEOF, TokenError:
+		return ""
+	case TokenString:
+		return quoteString(t.Value)
+	case TokenInterpolatedString:
+		return `"` + t.Value + `"`
+	case TokenLineComment:
+		return "//" + t.Value + "\n"
+	default:
+		return t.Value
+	}
+}
+
+// quoteString returns the source code of a string literal with the provided value. The value is double-quoted, and
+// escaped where needed.
+func quoteString(s string) string {
+	return `"` + escapeString(s) + `"`
+}
+
+// RenderTokens reconstructs the source code of a token slice using [Token.Render]. Tokens are separated by a single
+// space so adjacent identifiers, keywords and numbers don't merge, except after a comment, that already ends with a
+// new-line.
+func RenderTokens(toks []Token) string {
+	var src strings.Builder
+	for i, tok := range toks {
+		src.WriteString(tok.Render())
+
+		if i != len(toks)-1 && !tok.isComment() {
+			src.WriteRune(' ')
+		}
+	}
+
+	return src.String()
+}
+
 // isValid will return false if the token is of type [TokenEOF] or [TokenError], and true otherwise
 func (t Token) isValid() bool {
 	return t.Typ != TokenEOF && t.Typ != TokenError
 }
 
-// isEmpty returns true if the token is empty, and false otherwise
+// isEmpty returns true if the token is the zero Token, like the ones received from a closed channel, and false
+// otherwise
 func (t Token) isEmpty() bool {
-	return t.Typ != TokenEOF && t.Typ != TokenError
+	return t == Token{}
 }
 
 // isComment will return true only if the token is of type [TokenLineComment]
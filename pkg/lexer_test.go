@@ -1,188 +1,907 @@
 package maqui
 
 import (
+	"bytes"
+	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"go.maqui.dev/internal/test"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// lexerCases holds the table used by both the lexer tests and as the seed corpus of the lexer fuzz target.
+var lexerCases = []struct {
+	name   string
+	data   string
+	fail   bool
+	expect []Token
+}{
+	{
+		"EmptyMain",
+		"func main () {}",
+		false,
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+	},
+	{
+		"SingleLineComment",
+		"//this is a comment\n",
+		false,
+		[]Token{
+			{TokenLineComment, "this is a comment", nil},
+		},
+	},
+	{
+		"MainWithSingleLineComment",
+		"func main () {\n// this is a comment \n}",
+		false,
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenLineComment, " this is a comment ", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+	},
+	{
+		"UnicodeVarDeclaration",
+		"únicódeShouldBeVàlid := 1",
+		false,
+		[]Token{
+			{TokenIdentifier, "únicódeShouldBeVàlid", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+		},
+	},
+	{
+		"StringVarDeclaration",
+		"varDeclExpr := \"string\"",
+		false,
+		[]Token{
+			{TokenIdentifier, "varDeclExpr", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenString, "string", nil},
+		},
+	},
+	{
+		"EmptyString",
+		"\"\"",
+		false,
+		[]Token{
+			{TokenString, "", nil},
+		},
+	},
+	{
+		"UnclosedString",
+		"x := \"unclosed string",
+		true,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+		},
+	},
+	{
+		"InterpolatedString",
+		"\"x is ${x + 1}!\"",
+		false,
+		[]Token{
+			{TokenInterpolatedString, "x is ${x + 1}!", nil},
+		},
+	},
+	{
+		"EscapedString",
+		`x := "say \"hi\" \\ \${name}"`,
+		false,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenString, `say "hi" \ ${name}`, nil},
+		},
+	},
+	{
+		"EscapedInterpolatedString",
+		`"\"${x}\" \${y}"`,
+		false,
+		[]Token{
+			{TokenInterpolatedString, `\"${x}\" \${y}`, nil},
+		},
+	},
+	{
+		"UnknownEscape",
+		`x := "a\n"`,
+		true,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+		},
+	},
+	{
+		"UnclosedInterpolation",
+		"print(\"x is ${x\"",
+		true,
+		[]Token{
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+		},
+	},
+	{
+		"MultilineRawString",
+		"x := `line \"one\"\n${two}\n`",
+		false,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenString, "line \"one\"\n${two}\n", nil},
+		},
+	},
+	{
+		"UnclosedRawString",
+		"x := `unclosed\nraw string",
+		true,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+		},
+	},
+	{
+		"BadCharacter",
+		"x := @",
+		true,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+		},
+	},
+	{
+		"EmptyIfElse",
+		"if {} else {} ",
+		false,
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+	},
+	{
+		"IfExprCond",
+		"if 1+1 {} else {} ",
+		false,
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+	},
+	{
+		"IfWithBody",
+		"if 1+1 {\n2 - 3 \n 2 + 3\n} else {\n1 - 2 \n 1 + 2\n} ",
+		false,
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "2", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "3", nil},
+			{TokenNumber, "2", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "1", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "2", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+	},
+	{
+		"FloatDivision",
+		"3.0 / 2.25",
+		false,
+		[]Token{
+			{TokenNumber, "3.0", nil},
+			{TokenDiv, "/", nil},
+			{TokenNumber, "2.25", nil},
+		},
+	},
+	{
+		"BoolLiterals",
+		"true == false",
+		false,
+		[]Token{
+			{TokenBool, "true", nil},
+			{TokenBooleanEquals, "==", nil},
+			{TokenBool, "false", nil},
+		},
+	},
+	{
+		"Conditional",
+		"x := c ? 1 : 2",
+		false,
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenIdentifier, "c", nil},
+			{TokenQuestion, "?", nil},
+			{TokenNumber, "1", nil},
+			{TokenColon, ":", nil},
+			{TokenNumber, "2", nil},
+		},
+	},
+	{
+		"BitwiseOperators",
+		"a & b | c ^ 1 << 4 >> 2",
+		false,
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenAmpersand, "&", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenPipe, "|", nil},
+			{TokenIdentifier, "c", nil},
+			{TokenCaret, "^", nil},
+			{TokenNumber, "1", nil},
+			{TokenShiftLeft, "<<", nil},
+			{TokenNumber, "4", nil},
+			{TokenShiftRight, ">>", nil},
+			{TokenNumber, "2", nil},
+		},
+	},
+	{
+		"BitwiseNot",
+		"~5",
+		false,
+		[]Token{
+			{TokenTilde, "~", nil},
+			{TokenNumber, "5", nil},
+		},
+	},
+	{
+		"Import",
+		"import \"util.mq\"\nutil.foo()",
+		false,
+		[]Token{
+			{TokenImport, "import", nil},
+			{TokenString, "util.mq", nil},
+			{TokenIdentifier, "util", nil},
+			{TokenDot, ".", nil},
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+	},
+	{
+		"Return",
+		"func f() (r int) {\nreturn\n}",
+		false,
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "r", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenReturn, "return", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+	},
+	{
+		"Defer",
+		"defer print(1)",
+		false,
+		[]Token{
+			{TokenDefer, "defer", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+	},
+	{
+		"SingleAngleBracket",
+		"1 < 2",
+		true,
+		[]Token{
+			{TokenNumber, "1", nil},
+		},
+	},
+	{
+		"SimpleEquals",
+		"1 == 1",
+		false,
+		[]Token{
+			{TokenNumber, "1", nil},
+			{TokenBooleanEquals, "==", nil},
+			{TokenNumber, "1", nil},
+		},
+	},
+	{
+		"Underscores",
+		"_ := snake_case",
+		false,
+		[]Token{
+			{TokenIdentifier, "_", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenIdentifier, "snake_case", nil},
+		},
+	},
+}
+
 func TestLexer(t *testing.T) {
+	for _, c := range lexerCases {
+		t.Run(c.name, func(t *testing.T) {
+			r := strings.NewReader(c.data)
+			l := NewLexerFromReader(r)
+
+			// The tokens lexed before an error are kept
+			toks, err := l.Run()
+			if c.fail {
+				assert.Error(t, err)
+			}
+
+			for i := 0; i < len(toks); i++ {
+				toks[i].Loc = nil // ignore meta
+			}
+
+			assert.Equal(t, c.expect, toks)
+		})
+	}
+}
+
+func TestLexerNulByte(t *testing.T) {
+	// A NUL byte inside a string or a comment is regular content
+	toks, err := NewLexerFromReader(strings.NewReader("\"a\x00b\" //c\x00d\n1")).Run()
+	assert.NoError(t, err)
+
+	for i := range toks {
+		toks[i].Loc = nil // ignore meta
+	}
+
+	assert.Equal(t, []Token{
+		{TokenString, "a\x00b", nil},
+		{TokenLineComment, "c\x00d", nil},
+		{TokenNumber, "1", nil},
+	}, toks)
+
+	// Elsewhere it's an invalid symbol, and not the end of the stream
+	_, err = NewLexerFromReader(strings.NewReader("1 \x00 2")).Run()
+	assert.EqualError(t, err, `invalid symbol '\x00'`)
+}
+
+func TestLexerInvalidUTF8(t *testing.T) {
 	cases := []struct {
 		name   string
 		data   string
-		fail   bool
-		expect []Token
+		expect string
 	}{
-		{
-			"EmptyMain",
-			"func main () {}",
-			false,
-			[]Token{
-				{TokenFunc, "func", nil},
-				{TokenIdentifier, "main", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenCloseParentheses, ")", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-		},
-		{
-			"SingleLineComment",
-			"//this is a comment\n",
-			false,
-			[]Token{
-				{TokenLineComment, "this is a comment", nil},
-			},
-		},
-		{
-			"MainWithSingleLineComment",
-			"func main () {\n// this is a comment \n}",
-			false,
-			[]Token{
-				{TokenFunc, "func", nil},
-				{TokenIdentifier, "main", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenCloseParentheses, ")", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenLineComment, " this is a comment ", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-		},
-		{
-			"UnicodeVarDeclaration",
-			"únicódeShouldBeVàlid := 1",
-			false,
-			[]Token{
-				{TokenIdentifier, "únicódeShouldBeVàlid", nil},
-				{TokenDeclaration, ":=", nil},
-				{TokenNumber, "1", nil},
-			},
-		},
-		{
-			"StringVarDeclaration",
-			"varDeclExpr := \"string\"",
-			false,
-			[]Token{
-				{TokenIdentifier, "varDeclExpr", nil},
-				{TokenDeclaration, ":=", nil},
-				{TokenString, "string", nil},
-			},
-		},
-		{
-			"EmptyString",
-			"\"\"",
-			false,
-			[]Token{
-				{TokenString, "", nil},
-			},
-		},
-		{
-			"UnclosedString",
-			"\"unclosed string",
-			true,
-			nil,
-		},
-		{
-			"BadCharacter",
-			"@",
-			true,
-			nil,
-		},
-		{
-			"EmptyIfElse",
-			"if {} else {} ",
-			false,
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
-				{TokenElse, "else", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-		},
-		{
-			"IfExprCond",
-			"if 1+1 {} else {} ",
-			false,
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "1", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
-				{TokenElse, "else", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-		},
-		{
-			"IfWithBody",
-			"if 1+1 {\n2 - 3 \n 2 + 3\n} else {\n1 - 2 \n 1 + 2\n} ",
-			false,
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "1", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "2", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "3", nil},
-				{TokenNumber, "2", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenCloseCurly, "}", nil},
-				{TokenElse, "else", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "1", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "2", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "2", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-		},
-		{
-			"SimpleEquals",
-			"1 == 1",
-			false,
-			[]Token{
-				{TokenNumber, "1", nil},
-				{TokenBooleanEquals, "==", nil},
-				{TokenNumber, "1", nil},
-			},
-		},
+		{"Statement", "x := \xff", "invalid UTF-8 encoding at byte 5"},
+		{"String", "\"ab\xc3\"", "invalid UTF-8 encoding at byte 3"},
+		{"Comment", "// é\xe2\x82\n", "invalid UTF-8 encoding at byte 5"},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			r := strings.NewReader(c.data)
-			l := NewLexerFromReader(r)
+			_, err := NewLexerFromReader(strings.NewReader(c.data)).Run()
+			assert.EqualError(t, err, c.expect)
+		})
+	}
 
+	// An encoded replacement character is valid
+	toks, err := NewLexerFromReader(strings.NewReader("\"�\"")).Run()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "�", toks[0].Value)
+	}
+}
+
+func TestLexerOperators(t *testing.T) {
+	// Every operator is lexed on its own, from both kinds of stream
+	for op, typ := range operatorTable {
+		if typ == TokenLineComment {
+			continue
+		}
+
+		for _, l := range []*Lexer{NewLexerFromReader(strings.NewReader(op)), NewLexerFromBytes([]byte(op))} {
 			toks, err := l.Run()
-			if c.fail {
-				assert.Error(t, err)
+			if assert.NoError(t, err, op) && assert.Len(t, toks, 1, op) {
+				assert.Equal(t, Token{typ, op, &Location{Start: 0, End: uint64(len(op))}}, toks[0])
 			}
+		}
+	}
 
-			for i := 0; i < len(toks); i++ {
+	cases := []struct {
+		name   string
+		data   string
+		expect []Token
+		err    string
+	}{
+		{"LongestFirst", "<<>>", []Token{{TokenShiftLeft, "<<", nil}, {TokenShiftRight, ">>", nil}}, ""},
+		{"Adjacent", "::=:", []Token{{TokenColon, ":", nil}, {TokenDeclaration, ":=", nil}, {TokenColon, ":", nil}}, ""},
+		{"PrefixOnly", "<<<", []Token{{TokenShiftLeft, "<<", nil}}, "invalid symbol '<'"},
+		{"TrailingPrefix", "x =", []Token{{TokenIdentifier, "x", nil}}, "invalid symbol '='"},
+		{"Comment", "1//2", []Token{{TokenNumber, "1", nil}, {TokenLineComment, "2", nil}}, ""},
+		{"Unknown", "1 @", []Token{{TokenNumber, "1", nil}}, "invalid symbol '@'"},
+		{"UnknownRune", "€", nil, "invalid symbol '€'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			toks, err := NewLexerFromReader(strings.NewReader(c.data)).Run()
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, c.err)
+			}
+
+			for i := range toks {
 				toks[i].Loc = nil // ignore meta
 			}
 
 			assert.Equal(t, c.expect, toks)
 		})
 	}
+
+	// Adding an operator only takes a new entry in the table
+	groups := groupOperators(map[string]TokenType{"*": TokenMulti, "***": TokenMulti, "**": TokenMulti, "+": TokenPlus})
+	assert.Equal(t, map[rune][]string{'*': {"***", "**", "*"}, '+': {"+"}}, groups)
+}
+
+func TestLexerOperatorTable(t *testing.T) {
+	// The declaration is the longest match, and a lone = is not an operator
+	toks, err := NewLexerFromReader(strings.NewReader("x :== 1")).Run()
+	assert.EqualError(t, err, "invalid symbol '='")
+
+	if assert.Len(t, toks, 2) {
+		assert.Equal(t, Token{TokenDeclaration, ":=", &Location{Start: 2, End: 4}}, toks[1])
+	}
+
+	// A longer operator sharing a prefix with the existing ones is picked up from the table alone. The table is replaced
+	// by an extended copy for this test only.
+	table, candidates := operatorTable, operatorCandidates
+	t.Cleanup(func() {
+		operatorTable, operatorCandidates = table, candidates
+	})
+
+	operatorTable = map[string]TokenType{"<<=": TokenShiftLeft}
+	for op, typ := range table {
+		operatorTable[op] = typ
+	}
+
+	operatorCandidates = groupOperators(operatorTable)
+
+	toks, err = NewLexerFromReader(strings.NewReader("x <<= 1 << 2")).Run()
+	assert.NoError(t, err)
+
+	var values []string
+	for _, tok := range toks {
+		values = append(values, tok.Value)
+	}
+
+	assert.Equal(t, []string{"x", "<<=", "1", "<<", "2"}, values)
+}
+
+func TestOperatorTableCoversOperations(t *testing.T) {
+	// The parser takes the operations from the value of the operator tokens, so every operation must be in the table
+	for op := range binaryOpNames {
+		assert.Contains(t, operatorTable, string(op))
+	}
+
+	assert.Contains(t, operatorTable, string(BooleanEquals))
+}
+
+func TestLexerNumbers(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   string
+		expect string
+		err    string
+	}{
+		{"Integer", "123", "123", ""},
+		{"Zero", "0", "0", ""},
+		{"Float", "12.50", "12.50", ""},
+		{"FollowedByOperator", "1.5+", "1.5", ""},
+		{"TrailingDecimalPoint", "1.", "1.", `malformed number "1.": expected digits after the decimal point`},
+		{"TwoDecimalPoints", "1.2.3", "1.2.", `malformed number "1.2."`},
+		{"Letters", "12ab", "12a", `malformed number "12a"`},
+		{"Exponent", "1e5", "1e5", ""},
+		{"ScientificFloat", "1.5e10", "1.5e10", ""},
+		{"NegativeExponent", "2E-3", "2E-3", ""},
+		{"PositiveExponent", "2e+3", "2e+3", ""},
+		{"HexFloat", "0x1.8p3", "0x1.8p3", ""},
+		{"HexFloatNoFraction", "0XAP-2", "0XAP-2", ""},
+		{"EmptyExponent", "1e", "1e", `malformed number "1e": expected digits in the exponent`},
+		{"EmptySignedExponent", "1e+", "1e+", `malformed number "1e+": expected digits in the exponent`},
+		{"HexExponentWithoutDigits", "0x1.8p", "0x1.8p", `malformed number "0x1.8p": expected digits in the exponent`},
+		{"HexWithoutExponent", "0x1.8", "0x1.8", `malformed number "0x1.8": expected a 'p' exponent in the hexadecimal float`},
+		{"LettersAfterExponent", "1e5x", "1e5x", `malformed number "1e5x"`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			l := NewLexerFromReader(strings.NewReader(c.data))
+			go l.Do()
+
+			tok := l.Get()
+			if c.err == "" {
+				assert.Equal(t, Token{TokenNumber, c.expect, &Location{Start: 0, End: uint64(len(c.expect))}}, tok)
+				return
+			}
+
+			// The error points to the malformed number
+			assert.Equal(t, Token{TokenError, c.err, &Location{Start: 0, End: uint64(len(c.expect))}}, tok)
+		})
+	}
+}
+
+func TestLexerHeader(t *testing.T) {
+	cases := []struct {
+		name  string
+		data  string
+		start uint64
+	}{
+		{"BOM", "\uFEFFx := 1", 3},
+		{"Shebang", "#!/usr/bin/env maqui\nx := 1", 21},
+		{"BOMAndShebang", "\uFEFF#!/usr/bin/env maqui\r\nx := 1", 25},
+		{"ShebangOnly", "#!/usr/bin/env maqui", 0},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			toks, err := NewLexerFromReader(strings.NewReader(c.data)).Run()
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			if c.start == 0 {
+				assert.Empty(t, toks)
+				return
+			}
+
+			if assert.Len(t, toks, 3) {
+				assert.Equal(t, c.start, toks[0].Loc.Start)
+			}
+
+			for i := range toks {
+				toks[i].Loc = nil // ignore meta
+			}
+
+			assert.Equal(t, []Token{
+				{TokenIdentifier, "x", nil},
+				{TokenDeclaration, ":=", nil},
+				{TokenNumber, "1", nil},
+			}, toks)
+		})
+	}
+
+	// Only the start of the file is a header
+	_, err := NewLexerFromReader(strings.NewReader("x := 1\n#!/usr/bin/env maqui")).Run()
+	assert.EqualError(t, err, "invalid symbol '#'")
+
+	_, err = NewLexerFromReader(strings.NewReader("x := \uFEFF1")).Run()
+	assert.Error(t, err)
+}
+
+func TestTokenize(t *testing.T) {
+	src := "func main() {\nx := \"a\" // b\n}"
+
+	toks, errs := Tokenize(src)
+	assert.Empty(t, errs)
+
+	// The tokens are the same returned by Run, locations included
+	expect, err := NewLexerFromReader(strings.NewReader(src)).Run()
+	assert.NoError(t, err)
+	assert.Equal(t, expect, toks)
+
+	toks, errs = Tokenize("x := 1 $")
+	assert.Len(t, toks, 3)
+
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, &LexerError{
+			Loc: &Location{Start: 7, End: 8},
+			Msg: "invalid symbol '$'",
+		}, errs[0])
+	}
+}
+
+// lexStream collects the raw stream of a lexer, including its locations, the error and the final EOF
+func lexStream(l *Lexer) []Token {
+	go l.Do()
+
+	var stream []Token
+	for tok := range l.Chan() {
+		stream = append(stream, tok)
+	}
+
+	return stream
+}
+
+func TestLexerBufferReuse(t *testing.T) {
+	// Each token is built in the same buffer, so a shorter token must not change the value of a longer one before it
+	toks, err := NewLexerFromReader(strings.NewReader("abcdef x \"long string\" \"s\" 12345 6 // comment\n//c")).Run()
+	assert.NoError(t, err)
+
+	var values []string
+	for _, tok := range toks {
+		values = append(values, tok.Value)
+	}
+
+	assert.Equal(t, []string{"abcdef", "x", "long string", "s", "12345", "6", " comment", "c"}, values)
+}
+
+func TestLexerFromBytes(t *testing.T) {
+	sources := []string{
+		"\uFEFF#!/usr/bin/env maqui\r\nx := 1",
+		"\"a\x00b\" //c\x00d\n1",
+		"x := \"caf\xe9\"",
+		"s := \"ñandú ${a + 1}\" // ünïcode",
+		"1.5e10 + 0x1.8p3",
+		"1e+",
+		"x := 1\n#!/usr/bin/env maqui",
+		"",
+	}
+
+	for _, c := range lexerCases {
+		sources = append(sources, c.data)
+	}
+
+	for _, src := range sources {
+		t.Run(src, func(t *testing.T) {
+			expect := lexStream(NewLexerFromReader(strings.NewReader(src)))
+			assert.Equal(t, expect, lexStream(NewLexerFromBytes([]byte(src))))
+		})
+	}
+}
+
+func TestLexerFromReaders(t *testing.T) {
+	l := NewLexerFromReaders(
+		NamedReader{Name: "a.mq", Reader: strings.NewReader("x := 1\n")},
+		NamedReader{Name: "b.mq", Reader: strings.NewReader("\uFEFFy")},
+		NamedReader{Name: "c.mq", Reader: strings.NewReader("")},
+		NamedReader{Name: "d.mq", Reader: strings.NewReader("f()")},
+	)
+
+	toks, err := l.Run()
+	assert.NoError(t, err)
+
+	expect := []Token{
+		{TokenIdentifier, "x", &Location{Start: 0, End: 1, File: "a.mq"}},
+		{TokenDeclaration, ":=", &Location{Start: 2, End: 4, File: "a.mq"}},
+		{TokenNumber, "1", &Location{Start: 5, End: 6, File: "a.mq"}},
+		// The first token of a source is on a new line
+		{TokenIdentifier, "y", &Location{Start: 3, End: 4, File: "b.mq", NewLine: true}},
+		{TokenIdentifier, "f", &Location{Start: 0, End: 1, File: "d.mq", NewLine: true}},
+		{TokenOpenParentheses, "(", &Location{Start: 1, End: 2, File: "d.mq"}},
+		{TokenCloseParentheses, ")", &Location{Start: 2, End: 3, File: "d.mq"}},
+	}
+
+	assert.Equal(t, expect, toks)
+
+	// An error stops the lexing, so the sources after it are not lexed
+	toks, err = NewLexerFromReaders(
+		NamedReader{Name: "a.mq", Reader: strings.NewReader("x \"y")},
+		NamedReader{Name: "b.mq", Reader: strings.NewReader("z\"")},
+	).Run()
+
+	assert.EqualError(t, err, "unclosed string: y")
+	assert.Len(t, toks, 1)
+}
+
+func TestLexerLineDirective(t *testing.T) {
+	src := "a\n//line gen/source.txt:10\nb\n\n`c\nd` e\n// line ignored.txt:1\nf\n//line other.txt:x\ng"
+	lexers := map[string]func(src string) *Lexer{
+		"Reader": func(src string) *Lexer { return NewLexerFromReader(strings.NewReader(src)) },
+		"Bytes":  func(src string) *Lexer { return NewLexerFromBytes([]byte(src)) },
+	}
+
+	for name, newLexer := range lexers {
+		t.Run(name, func(t *testing.T) {
+			l := newLexer(src)
+			l.filename = "out.mq"
+
+			toks, err := l.Run()
+			assert.NoError(t, err)
+
+			expect := []Token{
+				{TokenIdentifier, "a", &Location{Start: 0, End: 1, File: "out.mq"}},
+				{TokenLineComment, "line gen/source.txt:10", &Location{Start: 2, End: 26, File: "out.mq", NewLine: true}},
+				{TokenIdentifier, "b", &Location{Start: 27, End: 28, File: "gen/source.txt", Line: 10, NewLine: true}},
+				// Tokens spanning several lines are on the line they start at
+				{TokenString, "c\nd", &Location{Start: 30, End: 35, File: "gen/source.txt", Line: 12, NewLine: true}},
+				{TokenIdentifier, "e", &Location{Start: 36, End: 37, File: "gen/source.txt", Line: 13}},
+				// Malformed directives are regular comments
+				{TokenLineComment, " line ignored.txt:1", &Location{Start: 38, End: 59, File: "gen/source.txt", Line: 14, NewLine: true}},
+				{TokenIdentifier, "f", &Location{Start: 60, End: 61, File: "gen/source.txt", Line: 15, NewLine: true}},
+				{TokenLineComment, "line other.txt:x", &Location{Start: 62, End: 80, File: "gen/source.txt", Line: 16, NewLine: true}},
+				{TokenIdentifier, "g", &Location{Start: 81, End: 82, File: "gen/source.txt", Line: 17, NewLine: true}},
+			}
+
+			assert.Equal(t, expect, toks)
+		})
+	}
+
+	loc := &Location{Start: 27, End: 28, File: "gen/source.txt", Line: 10}
+	assert.Equal(t, "source.txt:10", loc.String())
+	assert.Equal(t, 10, NewDiagnostic(&UndefinedError{Loc: loc, Name: "b"}, []byte(src)).Line)
+}
+
+func TestLexerPeekAtStart(t *testing.T) {
+	lexers := map[string]func(src string) *Lexer{
+		"Reader": func(src string) *Lexer { return NewLexerFromReader(strings.NewReader(src)) },
+		"Bytes":  func(src string) *Lexer { return NewLexerFromBytes([]byte(src)) },
+	}
+
+	for name, newLexer := range lexers {
+		t.Run(name, func(t *testing.T) {
+			l := newLexer("ñx")
+			assert.Equal(t, 'ñ', l.peek())
+			assert.Equal(t, 'ñ', l.peek())
+			assert.Equal(t, &Location{Start: 0, End: 0}, l.location())
+
+			assert.Equal(t, 'ñ', l.next())
+			assert.Equal(t, &Location{Start: 0, End: 2}, l.location())
+
+			// Peeking an empty stream doesn't move the position either
+			l = newLexer("")
+			assert.Equal(t, EOF, l.peek())
+			assert.Equal(t, EOF, l.peek())
+			assert.Equal(t, &Location{Start: 0, End: 0}, l.location())
+		})
+	}
+}
+
+func TestTokenTypeString(t *testing.T) {
+	assert.Equal(t, "Func", TokenFunc.String())
+	assert.Equal(t, "Error", TokenError.String())
+	assert.Equal(t, "Defer", TokenDefer.String())
+	assert.Equal(t, "TokenType(100)", TokenType(100).String())
+	assert.Equal(t, "Identifier", fmt.Sprintf("%s", TokenIdentifier))
+}
+
+func TestTokenGoString(t *testing.T) {
+	tok := Token{TokenIdentifier, "foo", &Location{Start: 4, End: 7}}
+
+	assert.Equal(t, `Token{Identifier, "foo"}`, fmt.Sprintf("%#v", tok))
+	assert.Equal(t, `[]maqui.Token{Token{Declaration, ":="}, Token{EOF, ""}}`, fmt.Sprintf("%#v", []Token{{TokenDeclaration, ":=", nil}, {TokenEOF, "", nil}}))
+}
+
+func TestTokenRender(t *testing.T) {
+	assert.Equal(t, "foo", Token{TokenIdentifier, "foo", nil}.Render())
+	assert.Equal(t, "\"foo bar\"", Token{TokenString, "foo bar", nil}.Render())
+	assert.Equal(t, `"foo \"bar\""`, Token{TokenString, `foo "bar"`, nil}.Render())
+	assert.Equal(t, "\"a\\\\b \\${c} `\"", Token{TokenString, "a\\b ${c} `", nil}.Render())
+	assert.Equal(t, "// comment\n", Token{TokenLineComment, " comment", nil}.Render())
+	assert.Equal(t, ":=", Token{TokenDeclaration, ":=", nil}.Render())
+	assert.Equal(t, "", Token{TokenEOF, "", nil}.Render())
+	assert.Equal(t, "", Token{TokenError, "invalid symbol '@'", nil}.Render())
+}
+
+// assertRenderRoundTrip lexes the source, renders the tokens back and asserts lexing the rendered source yields the
+// same tokens.
+func assertRenderRoundTrip(t *testing.T, src string) {
+	toks, err := NewLexerFromReader(strings.NewReader(src)).Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	rendered, err := NewLexerFromReader(strings.NewReader(RenderTokens(toks))).Run()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for i := range toks {
+		toks[i].Loc = nil // ignore meta
+	}
+
+	for i := range rendered {
+		rendered[i].Loc = nil // ignore meta
+	}
+
+	assert.Equal(t, toks, rendered)
+}
+
+func TestRenderRoundTrip(t *testing.T) {
+	for _, c := range lexerCases {
+		if c.fail {
+			continue
+		}
+
+		t.Run(c.name, func(t *testing.T) {
+			assertRenderRoundTrip(t, c.data)
+		})
+	}
+
+	for i := 0; i < 100; i++ {
+		src := test.GetRandomTokens(50)
+		t.Run("Random", func(t *testing.T) {
+			assertRenderRoundTrip(t, src)
+		})
+	}
+}
+
+func FuzzLexer(f *testing.F) {
+	for _, c := range lexerCases {
+		f.Add([]byte(c.data))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+
+			// Both sources must produce the same stream
+			assert.Equal(t, lexStream(NewLexerFromReader(bytes.NewReader(data))), lexStream(NewLexerFromBytes(data)))
+
+			// The tokens before an error are returned along with it, and are all valid
+			toks, _ := NewLexerFromReader(bytes.NewReader(data)).Run()
+			for _, tok := range toks {
+				assert.True(t, tok.isValid(), "unexpected %v token in the lexer output", tok.Typ)
+			}
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("lexer did not terminate for input %q", data)
+		}
+
+		// The raw stream must always end with exactly one EOF, optionally preceded by a single error
+		l := NewLexerFromReader(bytes.NewReader(data))
+		go l.Do()
+
+		var stream []Token
+		for tok := range l.Chan() {
+			stream = append(stream, tok)
+		}
+
+		if !assert.NotEmpty(t, stream) {
+			return
+		}
+
+		assert.Equal(t, TokenEOF, stream[len(stream)-1].Typ)
+
+		for i, tok := range stream[:len(stream)-1] {
+			if tok.Typ == TokenError {
+				assert.Equal(t, len(stream)-2, i, "error token must be the last before EOF")
+			}
+
+			assert.NotEqual(t, TokenEOF, tok.Typ, "EOF token must be the last of the stream")
+		}
+	})
 }
 
 // Use a package-level variable to avoid compiler optimisation
 var benchResult []Token
 
 func benchmarkLexer(size int, b *testing.B) {
+	b.ReportAllocs()
+
 	for n := 0; n < b.N; n++ {
 		// Setup
 		b.StopTimer()
@@ -200,6 +919,25 @@ func benchmarkLexer(size int, b *testing.B) {
 	}
 }
 
+func benchmarkLexerFromBytes(size int, b *testing.B) {
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		// Setup
+		b.StopTimer()
+		data := []byte(test.GetRandomTokens(size))
+		l := NewLexerFromBytes(data)
+
+		var err error
+		b.StartTimer()
+
+		benchResult, err = l.Run()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func BenchmarkLexer100(b *testing.B) {
 	benchmarkLexer(100, b)
 }
@@ -219,3 +957,11 @@ func BenchmarkLexer100000(b *testing.B) {
 func BenchmarkLexer1000000(b *testing.B) {
 	benchmarkLexer(1000000, b)
 }
+
+func BenchmarkLexerFromBytes1000(b *testing.B) {
+	benchmarkLexerFromBytes(1000, b)
+}
+
+func BenchmarkLexerFromBytes100000(b *testing.B) {
+	benchmarkLexerFromBytes(100000, b)
+}
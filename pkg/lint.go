@@ -0,0 +1,315 @@
+package maqui
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity tells how serious a diagnostic is.
+type Severity int
+
+const (
+	// SeverityError is the severity of the compile errors, which stop the compilation
+	SeverityError Severity = iota
+	// SeverityWarning is the severity of the warnings, which don't stop the compilation
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+
+	return "error"
+}
+
+// SeverityOf returns the severity of a diagnostic. Diagnostics without a Severity method, like most compile errors, are
+// errors.
+func SeverityOf(err CompileError) Severity {
+	if s, ok := err.(interface{ Severity() Severity }); ok {
+		return s.Severity()
+	}
+
+	return SeverityError
+}
+
+// Warning is a diagnostic over code that is valid, but likely a mistake. Unlike the compile errors, warnings don't stop
+// the compilation, unless the Compiler is set to treat them as errors.
+type Warning interface {
+	CompileError
+	// Kind returns the name of the check that found the warning, used to suppress it
+	Kind() string
+	// Severity returns SeverityWarning
+	Severity() Severity
+}
+
+// lintCheck looks for likely mistakes inside a single expression. It returns nil if none is found.
+type lintCheck func(expr Expr) []Warning
+
+// lintChecks holds all the checks run by the Linter
+var lintChecks = []lintCheck{
+	checkShadowedBuiltin,
+	checkUnusedVariables,
+	checkFormatArgs,
+}
+
+// Linter goes over an analyzed AST looking for likely mistakes, and reports them as warnings. Each kind of warning can
+// be suppressed for the cases where the code is intentional.
+type Linter struct {
+	// suppressed holds the kinds of the warnings that are not reported
+	suppressed map[string]bool
+}
+
+// NewLinter creates a linter that reports all kinds of warnings
+func NewLinter() *Linter {
+	return &Linter{
+		suppressed: make(map[string]bool),
+	}
+}
+
+// Suppress stops the linter from reporting the warnings of the given kind
+func (l *Linter) Suppress(kind string) {
+	l.suppressed[kind] = true
+}
+
+// Do runs all checks over the statements of the AST, including the nested ones, and returns the warnings found in
+// source order. The warnings of the statements marked by an ignore directive are suppressed.
+func (l *Linter) Do(ast *AST) []Warning {
+	var warnings []Warning
+	for _, stmt := range ast.Statements {
+		Inspect(stmt.Expr, func(expr Expr) bool {
+			for _, check := range lintChecks {
+				for _, w := range check(expr) {
+					if !l.suppressed[w.Kind()] && !isIgnored(ast, w) {
+						warnings = append(warnings, w)
+					}
+				}
+			}
+
+			return true
+		})
+	}
+
+	sort.SliceStable(warnings, func(i, j int) bool {
+		l1, l2 := warnings[i].GetLocation(), warnings[j].GetLocation()
+		return l1 != nil && (l2 == nil || l1.Start < l2.Start)
+	})
+
+	return warnings
+}
+
+// isIgnored returns true if an ignore directive of the AST suppresses the warning
+func isIgnored(ast *AST, w Warning) bool {
+	for _, d := range ast.Ignores {
+		if d.Suppresses(w) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkShadowedBuiltin flags the variables and functions named after a builtin function, which make the builtin
+// unreachable from their scope
+func checkShadowedBuiltin(expr Expr) []Warning {
+	var names []string
+	switch e := expr.(type) {
+	case *VariableDecl:
+		names = []string{e.Name}
+	case *MultiVariableDecl:
+		names = e.Names
+	case *FuncDecl:
+		names = []string{e.Name}
+	default:
+		return nil
+	}
+
+	var warnings []Warning
+	for _, name := range names {
+		if _, isBuiltin := builtins[name]; isBuiltin {
+			warnings = append(warnings, &ShadowedBuiltinWarning{
+				Loc:  expr.GetLocation(),
+				Name: name,
+			})
+		}
+	}
+
+	return warnings
+}
+
+// checkUnusedVariables flags the variables declared inside a function that are never read. Declaring a variable again
+// counts as a single variable, so it's flagged only if none of its declarations are read. Named results are returned,
+// including the ones of the function literals inside the function, so they are never flagged, and neither is the blank identifier, which discards its value on purpose.
+func checkUnusedVariables(expr Expr) []Warning {
+	f, isFunc := expr.(*FuncDecl)
+	if !isFunc {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	for _, result := range f.Results {
+		used[result.Name] = true
+	}
+
+	// The declarations are kept as single variables, in order
+	var decls []*VariableDecl
+	for _, stmt := range f.Body {
+		Inspect(stmt, func(expr Expr) bool {
+			switch e := expr.(type) {
+			case *VariableDecl:
+				decls = append(decls, e)
+			case *MultiVariableDecl:
+				for _, name := range e.Names {
+					decls = append(decls, &VariableDecl{Location: e.Location, Name: name})
+				}
+			case *FuncLit:
+				for _, result := range e.Results {
+					used[result.Name] = true
+				}
+			case *Identifier:
+				used[e.Name] = true
+			}
+
+			return true
+		})
+	}
+
+	var warnings []Warning
+	for _, decl := range decls {
+		if !used[decl.Name] && decl.Name != blankIdentifier {
+			warnings = append(warnings, &UnusedVariableWarning{
+				Loc:  decl.GetLocation(),
+				Name: decl.Name,
+			})
+		}
+	}
+
+	return warnings
+}
+
+// checkFormatArgs flags the calls to the format builtin that take a different number of arguments than the ones
+// expected by their format. It's a best-effort check, so only formats given as a string literal are checked.
+func checkFormatArgs(expr Expr) []Warning {
+	call, isCall := expr.(*FuncCall)
+	if !isCall || call.calleeName() != "format" || len(call.Args) == 0 {
+		return nil
+	}
+
+	format, isLiteral := call.Args[0].(*LiteralExpr)
+	if !isLiteral || format.Typ != LiteralString {
+		return nil
+	}
+
+	expected := countFormatArgs(format.Value)
+	if expected == len(call.Args)-1 {
+		return nil
+	}
+
+	return []Warning{&FormatArgsWarning{
+		Loc:      call.GetLocation(),
+		Expected: expected,
+		Got:      len(call.Args) - 1,
+	}}
+}
+
+// countFormatArgs returns the number of arguments taken by a printf-style format. Each conversion takes one, and so
+// does each width or precision given as '*'. A literal percent sign, written "%%", takes none.
+func countFormatArgs(format string) int {
+	n := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+
+		// Skip the flags, width, precision and length up to the conversion
+		for i++; i < len(format) && !strings.ContainsRune("%diouxXeEfFgGaAcspn", rune(format[i])); i++ {
+			if format[i] == '*' {
+				n++
+			}
+		}
+
+		if i < len(format) && format[i] != '%' {
+			n++
+		}
+	}
+
+	return n
+}
+
+// ShadowedBuiltinWarning flags a declaration that shadows a builtin function.
+type ShadowedBuiltinWarning struct {
+	Loc  *Location
+	Name string
+}
+
+func (w ShadowedBuiltinWarning) String() string {
+	return fmt.Sprintf("%s shadowed builtin: '%s' shadows the builtin function of the same name", w.Loc, w.Name)
+}
+
+// GetLocation returns the location of the declaration that shadows the builtin
+func (w ShadowedBuiltinWarning) GetLocation() *Location {
+	return w.Loc
+}
+
+// Kind returns "shadow", the kind of the shadowing warnings
+func (w ShadowedBuiltinWarning) Kind() string {
+	return "shadow"
+}
+
+// Severity returns SeverityWarning
+func (w ShadowedBuiltinWarning) Severity() Severity {
+	return SeverityWarning
+}
+
+// UnusedVariableWarning flags a variable that is declared but never read.
+type UnusedVariableWarning struct {
+	Loc  *Location
+	Name string
+}
+
+func (w UnusedVariableWarning) String() string {
+	return fmt.Sprintf("%s unused variable: '%s' is declared but never used", w.Loc, w.Name)
+}
+
+// GetLocation returns the location of the declaration of the variable
+func (w UnusedVariableWarning) GetLocation() *Location {
+	return w.Loc
+}
+
+// Kind returns "unused", the kind of the unused variable warnings
+func (w UnusedVariableWarning) Kind() string {
+	return "unused"
+}
+
+// Severity returns SeverityWarning
+func (w UnusedVariableWarning) Severity() Severity {
+	return SeverityWarning
+}
+
+// FormatArgsWarning flags a call to the format builtin with a different number of arguments than its format expects.
+type FormatArgsWarning struct {
+	Loc      *Location
+	Expected int
+	Got      int
+}
+
+func (w FormatArgsWarning) String() string {
+	return fmt.Sprintf("%s format arguments: the format expects %d arguments, but %d were given", w.Loc, w.Expected,
+		w.Got)
+}
+
+// GetLocation returns the location of the call
+func (w FormatArgsWarning) GetLocation() *Location {
+	return w.Loc
+}
+
+// Kind returns "format", the kind of the format argument warnings
+func (w FormatArgsWarning) Kind() string {
+	return "format"
+}
+
+// Severity returns SeverityWarning
+func (w FormatArgsWarning) Severity() Severity {
+	return SeverityWarning
+}
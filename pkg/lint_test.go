@@ -0,0 +1,237 @@
+package maqui
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lint analyses the source code and returns the warnings found by a linter with the given kinds suppressed
+func lint(src string, suppressed ...string) []Warning {
+	analyzer := NewContextAnalyser(NewParser(NewLexerFromReader(strings.NewReader(src))))
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+
+	linter := NewLinter()
+	for _, kind := range suppressed {
+		linter.Suppress(kind)
+	}
+
+	return linter.Do(analyzer.Do(global))
+}
+
+func TestLintShadowedBuiltin(t *testing.T) {
+	cases := []struct {
+		name       string
+		src        string
+		suppressed []string
+		expect     []Warning
+	}{
+		{
+			"Variable",
+			"print := 1",
+			nil,
+			[]Warning{&ShadowedBuiltinWarning{Loc: &Location{Start: 0, End: 5}, Name: "print"}},
+		},
+		{
+			"Function",
+			"func println() {}",
+			nil,
+			[]Warning{&ShadowedBuiltinWarning{Loc: &Location{Start: 0, End: 4}, Name: "println"}},
+		},
+		{
+			"Nested",
+			"func main() {\nabort := 1\nprintln(abort)\n}",
+			nil,
+			[]Warning{&ShadowedBuiltinWarning{Loc: &Location{Start: 14, End: 19, NewLine: true}, Name: "abort"}},
+		},
+		{
+			"NotBuiltin",
+			"func main() {\nprinter := 1\nprintln(printer)\n}",
+			nil,
+			nil,
+		},
+		{
+			"Suppressed",
+			"print := 1",
+			[]string{"shadow"},
+			nil,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.expect, lint(c.src, c.suppressed...))
+		})
+	}
+}
+
+func TestLintUnusedVariables(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Unused", "func main() {\nx := 1\n}", []string{"x"}},
+		{"Used", "func main() {\nx := 1\nprintln(x)\n}", nil},
+		{"UsedInBranch", "func main() {\nx := 1\nif true {\nprintln(x + 1)\n}\n}", nil},
+		{"DeclaredAgain", "func main() {\nx := 1\nx := x + 1\n}", nil},
+		{"NamedResult", "func f() (r int) {\nr := 1\n}", nil},
+		{"FuncLiteral", "func main() {\nf := func() (r int) {\nx := 1\n}\nf()\n}", []string{"x"}},
+		{"Several", "func main() {\na := 1\nb := a\nif true {\nc := 2\n}\n}", []string{"b", "c"}},
+		{"TopLevel", "x := 1", nil},
+		{"Blank", "func main() {\n_ := 1\n}", nil},
+		{"MultiVariableDecl", "func main() {\na, b, _ := 1, 2, 3\nprint(a)\n}", []string{"b"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var unused []string
+			for _, w := range lint(c.src) {
+				if assert.IsType(t, &UnusedVariableWarning{}, w) {
+					unused = append(unused, w.(*UnusedVariableWarning).Name)
+				}
+			}
+
+			assert.Equal(t, c.expect, unused)
+		})
+	}
+}
+
+func TestLintFormatArgs(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Matching", "func main() {\nformat(\"%d and %s\", 1, \"a\")\n}", nil},
+		{"NoArgs", "func main() {\nformat(\"100%%\")\n}", nil},
+		{"StarWidth", "func main() {\nformat(\"%*d\", 4, 1)\n}", nil},
+		{"Missing", "func main() {\nformat(\"%d %d\", 1)\n}", []string{"format arguments: the format expects 2 arguments, but 1 were given"}},
+		{"Extra", "func main() {\nformat(\"%lld\", 1, 2)\n}", []string{"format arguments: the format expects 1 arguments, but 2 were given"}},
+		{"NotLiteral", "func main() {\nf := \"%d\"\nformat(f)\n}", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var warnings []string
+			for _, w := range lint(c.src) {
+				warnings = append(warnings, strings.SplitN(w.String(), " ", 2)[1])
+			}
+
+			assert.Equal(t, c.expect, warnings)
+		})
+	}
+}
+
+func TestLintIgnoreDirective(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Ignored", "func main() {\n// maqui:ignore unused\nx := 1\n}", nil},
+		{"OtherKind", "func main() {\n// maqui:ignore shadow\nx := 1\n}", []string{"unused x"}},
+		{"SeveralKinds", "func main() {\n//maqui:ignore shadow unused\nprint := 1\n}", nil},
+		{"AllKinds", "func main() {\n// maqui:ignore\nprint := 1\n}", nil},
+		{"NextStatementOnly", "func main() {\n// maqui:ignore unused\nx := 1\ny := 1\n}", []string{"unused y"}},
+		{"WholeFunction", "// maqui:ignore unused\nfunc main() {\nx := 1\ny := 1\n}", nil},
+		{"NotDirective", "func main() {\n// maqui:ignored unused\nx := 1\n}", []string{"unused x"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var warnings []string
+			for _, w := range lint(c.src) {
+				warnings = append(warnings, w.Kind()+" "+strings.Trim(strings.SplitN(w.String(), "'", 3)[1], "'"))
+			}
+
+			assert.Equal(t, c.expect, warnings)
+		})
+	}
+}
+
+func TestCompilerWarnings(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "main.mq")
+	if !assert.NoError(t, os.WriteFile(path, []byte("func main() {\nprint := 1\nprintln(print)\n}"), 0o644)) {
+		return
+	}
+
+	var reported []Warning
+
+	c := NewCompiler(linuxTarget)
+	c.SetWarningHandler(func(w Warning) {
+		reported = append(reported, w)
+	})
+
+	ast, err := c.Analyze(path)
+	if assert.NoError(t, err) && assert.Len(t, reported, 1) {
+		assert.Empty(t, ast.Errors)
+		assert.Equal(t, ast.Warnings, reported)
+		assert.Equal(t, "shadow", reported[0].Kind())
+	}
+
+	reported = nil
+	c.SuppressWarning("shadow")
+
+	ast, err = c.Analyze(path)
+	if assert.NoError(t, err) {
+		assert.Empty(t, ast.Warnings)
+		assert.Empty(t, reported)
+	}
+}
+
+func TestWarningsAsErrors(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+
+	// The compiler writes its output to the working directory
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	path := filepath.Join(dir, "main.mq")
+	if !assert.NoError(t, os.WriteFile(path, []byte("func main() {\nx := 1\n}"), 0o644)) {
+		return
+	}
+
+	c := NewCompiler(linuxTarget)
+	c.clang = stubClang(t, dir)
+
+	errs, err := c.Compile(path)
+	if assert.NoError(t, err) {
+		assert.Empty(t, errs)
+		assert.FileExists(t, filepath.Join(dir, "args"))
+	}
+
+	if !assert.NoError(t, os.Remove(filepath.Join(dir, "args"))) {
+		return
+	}
+
+	c.SetWarningsAsErrors(true)
+
+	errs, err = c.Compile(path)
+	if assert.NoError(t, err) && assert.Len(t, errs, 1) {
+		assert.IsType(t, &UnusedVariableWarning{}, errs[0])
+		assert.Equal(t, SeverityWarning, SeverityOf(errs[0]))
+		assert.NoFileExists(t, filepath.Join(dir, "args"))
+	}
+}
+
+func TestSeverityOf(t *testing.T) {
+	assert.Equal(t, SeverityError, SeverityOf(&UndefinedError{Name: "x"}))
+	assert.Equal(t, SeverityWarning, SeverityOf(&ShadowedBuiltinWarning{Name: "print"}))
+	assert.Equal(t, "warning", SeverityWarning.String())
+	assert.Equal(t, "error", SeverityError.String())
+}
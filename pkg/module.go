@@ -0,0 +1,116 @@
+package maqui
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Module is a file brought into another one through an import, along with its analyzed AST.
+type Module struct {
+	// Name is the name the functions of the module are qualified with. It's the name of the file, without the extension,
+	// and it's unique among the modules of a program, as their symbols are mangled with it.
+	Name string
+	// AST holds the analyzed statements of the module
+	AST *AST
+}
+
+// ModuleLoader resolves the imports of a file into modules.
+type ModuleLoader interface {
+	// Load lexes, parses and analyses the file at the path, and returns it as a module
+	Load(path string) (*Module, error)
+}
+
+// ErrImportCycle is returned when a module imports itself, either directly or through other modules.
+var ErrImportCycle = errors.New("import cycle")
+
+// moduleLoader is the ModuleLoader used by the Compiler. Each module is loaded only once, no matter how many times it's
+// imported, and the imports of the loaded modules are resolved by the same loader.
+type moduleLoader struct {
+	// compiler is used to analyze the loaded files
+	compiler *Compiler
+	// diag is an optional channel where the compile errors of the modules are sent as soon as they are found
+	diag chan<- CompileError
+	// modules holds the modules already loaded, mapped by their path
+	modules map[string]*Module
+	// names holds the paths of the modules already loaded, mapped by their name
+	names map[string]string
+	// loading holds the paths of the files being loaded, used to detect import cycles
+	loading map[string]bool
+	// errors holds the compile errors found inside the loaded modules
+	errors []CompileError
+	// warnings holds the warnings found inside the loaded modules
+	warnings []Warning
+}
+
+// newModuleLoader creates a loader for the imports of the file at the path
+func newModuleLoader(c *Compiler, filename string, diag chan<- CompileError) *moduleLoader {
+	return &moduleLoader{
+		compiler: c,
+		diag:     diag,
+		modules:  make(map[string]*Module),
+		names:    make(map[string]string),
+		loading:  map[string]bool{filepath.Clean(filename): true},
+	}
+}
+
+// Load analyzes the file at the path and returns it as a module. If the module was already loaded, the same module is
+// returned. The compile errors found inside the module are kept by the loader instead of failing the import. Two files
+// with the same name can't be loaded, since the symbols of their functions would collide.
+func (l *moduleLoader) Load(path string) (*Module, error) {
+	path = filepath.Clean(path)
+	if l.loading[path] {
+		return nil, fmt.Errorf("%w through %s", ErrImportCycle, filepath.Base(path))
+	}
+
+	if mod, loaded := l.modules[path]; loaded {
+		return mod, nil
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if !isModuleName(name) {
+		return nil, fmt.Errorf("invalid module name '%s'", name)
+	}
+
+	if other, used := l.names[name]; used {
+		return nil, fmt.Errorf("module name '%s' is already used by %s", name, other)
+	}
+
+	l.loading[path] = true
+	defer delete(l.loading, path)
+
+	ast, err := l.compiler.analyzeFile(path, l.diag, l)
+	if err != nil {
+		return nil, err
+	}
+
+	l.errors = append(l.errors, ast.Errors...)
+	l.warnings = append(l.warnings, ast.Warnings...)
+
+	mod := &Module{
+		Name: name,
+		AST:  ast,
+	}
+
+	l.modules[path] = mod
+	l.names[name] = path
+	return mod, nil
+}
+
+// isModuleName returns true if the name can be used to qualify the functions of a module, that is, if it's an
+// identifier and not a keyword or the blank identifier
+func isModuleName(name string) bool {
+	if name == "" || name == blankIdentifier {
+		return false
+	}
+
+	for _, r := range name {
+		if !isIdentifierRune(r) {
+			return false
+		}
+	}
+
+	_, isKeyword := keywordTable[name]
+	return !isKeyword
+}
@@ -1,6 +1,13 @@
 package maqui
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 // AST is an Abstract Syntax Tree that contains the statements found inside a file, and its respective symbol table.
 // The statements are presented as annotated expressions, that contain the resolved type of the expression, if any.
@@ -11,6 +18,10 @@ type AST struct {
 	Statements []*AnnotatedExpr
 	// Errors list all compile errors
 	Errors []CompileError
+	// Warnings list the likely mistakes found by the Linter, which don't stop the compilation
+	Warnings []Warning
+	// Ignores holds the ignore directives found in the comments, used to suppress the warnings of some statements
+	Ignores []*IgnoreDirective
 	// Filename is a string that points to the file that created this AST
 	Filename string
 }
@@ -57,6 +68,14 @@ type FuncDecl struct {
 	Name string
 	// Body contains all the statements inside the definition blocks
 	Body []Expr
+	// Exported is true if the function was marked with the export keyword, and should keep its exact name as a symbol
+	Exported bool
+	// Results holds the named results of the function, if any. They are declared as zero-initialized variables inside
+	// the body, and their values are returned once the function ends.
+	Results []*Param
+	// InferredResult is the type of the result of a function without named results, inferred by the semantic analysis
+	// from the values it returns. It's nil if the function returns no value.
+	InferredResult *BasicType
 }
 
 // GetLocation returns the location of the source code that generated the function
@@ -64,6 +83,101 @@ func (e FuncDecl) GetLocation() *Location {
 	return e.Location
 }
 
+// FuncLit is an expression that represents an anonymous function, as in f := func() { ... }. Its value is the function
+// itself, which can be stored and called like the declared ones. The body of a function literal doesn't see the
+// variables of the function enclosing it, only the top-level definitions of the file.
+type FuncLit struct {
+	// Location points to the source code that created the literal
+	Location *Location
+	// Body contains all the statements inside the literal blocks
+	Body []Expr
+	// Results holds the named results of the function, if any. They behave like the ones of a [FuncDecl].
+	Results []*Param
+	// InferredResult is the type of the result of a literal without named results, as in [FuncDecl].
+	InferredResult *BasicType
+}
+
+// GetLocation returns the location of the source code that generated the literal
+func (e FuncLit) GetLocation() *Location {
+	return e.Location
+}
+
+// Param is a named and typed parameter of a function signature.
+type Param struct {
+	// Location points to the source code that created the parameter
+	Location *Location
+	// Name is the name of the parameter
+	Name string
+	// Type is the name of the parameter's type
+	Type string
+}
+
+// ExternDecl is an expression that declares a function defined outside Maqui, like a C function. It only contains the
+// signature of the function, which is linked against the external symbol of the same name.
+type ExternDecl struct {
+	// Locations points to the source code that created this declaration
+	Location *Location
+	// Name is the name of the function, and of the external symbol
+	Name string
+	// Params holds the parameters of the function, in order
+	Params []*Param
+	// Returns holds the names of the returned types, if any
+	Returns []string
+}
+
+// GetLocation returns the location of the source code that generated the declaration
+func (e ExternDecl) GetLocation() *Location {
+	return e.Location
+}
+
+// ReturnExpr is a return statement. It ends the function, returning its value if any. A bare return returns the current
+// values of the named results of the function.
+type ReturnExpr struct {
+	// Location points to the source code that created the statement
+	Location *Location
+	// Value is the returned expression. It's nil for a bare return.
+	Value Expr
+}
+
+// GetLocation returns the location of the source code that generated the statement
+func (e ReturnExpr) GetLocation() *Location {
+	return e.Location
+}
+
+// DeferExpr schedules a function call to run when the enclosing function returns, right before each of its returns.
+// Deferred calls run in the reverse order they were scheduled, and their arguments are evaluated when the defer
+// statement runs.
+type DeferExpr struct {
+	// Location points to the source code that created the statement
+	Location *Location
+	// Call is the deferred expression, which must be a function call
+	Call Expr
+}
+
+// GetLocation returns the location of the source code that generated the statement
+func (e DeferExpr) GetLocation() *Location {
+	return e.Location
+}
+
+// ImportDecl is an expression that imports a module from another file. The exported functions of the module are brought
+// into scope qualified by the name of the module, so the function foo of the module util is called as util.foo().
+type ImportDecl struct {
+	// Location points to the source code that created the import
+	Location *Location
+	// Path is the path of the imported file, relative to the importing file
+	Path string
+	// Module is the module the path was resolved to by the semantic analysis. It's nil if the import couldn't be resolved.
+	Module *Module
+}
+
+// GetLocation returns the location of the source code that generated the import
+func (e ImportDecl) GetLocation() *Location {
+	return e.Location
+}
+
+// blankIdentifier is the name of the blank identifier (_). Declaring it discards the value, and it can't be used as one.
+const blankIdentifier = "_"
+
 // VariableDecl is an expression that defines a variable declaration. It contains the name, value (also an expression),
 // and resolved type of the variable. It also has a [Location] that points to where the variable was created in the
 // source code.
@@ -83,14 +197,35 @@ func (e VariableDecl) GetLocation() *Location {
 	return e.Location
 }
 
-// FuncCall is an expression that defines a function call inside the code. It contains the name of the call function,
-// the arguments provided and the type resolved for each argument, and the location inside the source that created
-// this call.
+// MultiVariableDecl is an expression that declares several variables at once, as in a, b := 1, 2. Each variable is
+// assigned the value at the same position. All the values are evaluated before any of the variables is assigned, so
+// a, b := b, a swaps the variables. The number of names and values is checked by the semantic analysis.
+type MultiVariableDecl struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Names holds the names of the created variables, in order
+	Names []string
+	// Values holds the values the variables are assigned to, in order
+	Values []Expr
+	// ResolvedTypes contains the types the compiler resolved each variable to. It has the same length and position in
+	// relation to Names.
+	ResolvedTypes []Type
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e MultiVariableDecl) GetLocation() *Location {
+	return e.Location
+}
+
+// FuncCall is an expression that defines a function call inside the code. It contains the called expression, the
+// arguments provided and the type resolved for each argument, and the location inside the source that created this
+// call.
 type FuncCall struct {
 	// Location points to the source code that created the expression
 	Location *Location
-	// Name is the name of the called function
-	Name string
+	// Callee is the called expression. It's usually an *Identifier holding the name of the function, but it can be any
+	// expression whose value is a function, like a function literal or another call.
+	Callee Expr
 	// Args is an expression list of the provided arguments
 	Args []Expr
 	// ResolvedTypes contains the resolved types of the arguments. It has the same length and position in relation to
@@ -103,6 +238,11 @@ func (e FuncCall) GetLocation() *Location {
 	return e.Location
 }
 
+// calleeName returns the name of the called function, or the formatted callee if it's not called by its name
+func (e *FuncCall) calleeName() string {
+	return (&formatter{}).expr(e.Callee, precPrimary)
+}
+
 // Identifier is an expression the holds an identifier. It contains its location inside the code and the identifier name.
 type Identifier struct {
 	// Location points to the source code that created the expression
@@ -128,8 +268,8 @@ func (e EOS) GetLocation() *Location {
 	return e.Location
 }
 
-// BinaryOp defines a binary operation type. Valid types are addition (+), subtraction (-), multiplication (*), and
-// division (/).
+// BinaryOp defines a binary operation type. Valid types are addition (+), subtraction (-), multiplication (*),
+// division (/), and the bitwise and (&), or (|), exclusive or (^), left shift (<<) and right shift (>>).
 type BinaryOp string
 
 const (
@@ -141,8 +281,40 @@ const (
 	BinaryMultiplication BinaryOp = "*"
 	// BinaryDivision is the division (/) of two expressions
 	BinaryDivision BinaryOp = "/"
+	// BinaryAnd is the bitwise and (&) of two integer expressions
+	BinaryAnd BinaryOp = "&"
+	// BinaryOr is the bitwise or (|) of two integer expressions
+	BinaryOr BinaryOp = "|"
+	// BinaryXor is the bitwise exclusive or (^) of two integer expressions
+	BinaryXor BinaryOp = "^"
+	// BinaryShiftLeft shifts the bits of an integer expression to the left (<<)
+	BinaryShiftLeft BinaryOp = "<<"
+	// BinaryShiftRight shifts the bits of an integer expression to the right (>>), keeping its sign
+	BinaryShiftRight BinaryOp = ">>"
 )
 
+// binaryOpNames maps the binary operations to their readable names
+var binaryOpNames = map[BinaryOp]string{
+	BinaryAddition:       "addition",
+	BinarySubtraction:    "subtraction",
+	BinaryMultiplication: "multiplication",
+	BinaryDivision:       "division",
+	BinaryAnd:            "bitwise and",
+	BinaryOr:             "bitwise or",
+	BinaryXor:            "bitwise exclusive or",
+	BinaryShiftLeft:      "left shift",
+	BinaryShiftRight:     "right shift",
+}
+
+// String returns the readable name of the operation, like "subtraction" for (-). Unknown operations are returned as is.
+func (op BinaryOp) String() string {
+	if name, ok := binaryOpNames[op]; ok {
+		return name
+	}
+
+	return string(op)
+}
+
 // BooleanOp defines a binary operation type with a resulting boolean, like comparator operators. Valid types are
 // equals (==) (TODO)
 type BooleanOp string
@@ -195,10 +367,24 @@ func (e BooleanExpr) GetLocation() *Location {
 type UnaryOp string
 
 const (
-	// UnaryNegative is the negation of an expression. For example -1.
+	// UnaryNegative is the negation of an expression. For example -x. Negated numbers are parsed as negative literals.
 	UnaryNegative UnaryOp = "-"
+	// UnaryBitwiseNot flips all the bits of an integer expression. For example ~1.
+	UnaryBitwiseNot UnaryOp = "~"
 )
 
+// String returns the readable name of the operation, like "negation" for (-). Unknown operations are returned as is.
+func (op UnaryOp) String() string {
+	switch op {
+	case UnaryNegative:
+		return "negation"
+	case UnaryBitwiseNot:
+		return "bitwise not"
+	default:
+		return string(op)
+	}
+}
+
 // UnaryExpr is an operation over only one operand. It contains the receiver, the operation performed, and the source
 // code location that generated this expression.
 type UnaryExpr struct {
@@ -223,6 +409,8 @@ const (
 	LiteralNumber LiteralType = iota
 	// LiteralString defines the immediate value type of an escaped text
 	LiteralString
+	// LiteralBool defines the immediate value type of the true and false keywords
+	LiteralBool
 )
 
 // LiteralExpr contains an expression that's used as an immediate. It contains  the type (LiteralType), location and
@@ -234,6 +422,9 @@ type LiteralExpr struct {
 	Typ LiteralType
 	// Value holds the value of the literal. For string literals the commas escaping the string will be removed.
 	Value string
+	// Number holds the parsed value of a number literal, an int64 for integers and a float64 for floating point
+	// numbers. It's set by the Parser, and nil for any other literal.
+	Number any
 }
 
 // GetLocation returns the location of the source code that generated the expression
@@ -241,6 +432,25 @@ func (e LiteralExpr) GetLocation() *Location {
 	return e.Location
 }
 
+// number returns the parsed value of a number literal. Literals not built by the Parser, and so without a parsed value,
+// are parsed on demand.
+func (e *LiteralExpr) number() (any, error) {
+	if e.Number != nil {
+		return e.Number, nil
+	}
+
+	return parseNumber(e.Value)
+}
+
+// parseNumber parses the value of a number literal into an int64, or into a float64 if it has a decimal point
+func parseNumber(value string) (any, error) {
+	if isFloatLiteral(value) {
+		return strconv.ParseFloat(value, 64)
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
+
 // IfExpr holds a logic branching expression.
 type IfExpr struct {
 	// Location points to the source code that created the expression
@@ -249,7 +459,8 @@ type IfExpr struct {
 	Condition Expr
 	// Consequent is the expressions that should run if the condition is truthful
 	Consequent []Expr
-	// Else is an optional slice of expressions that run if the condition is false
+	// Else is an optional slice of expressions that run if the condition is false. An else if is held as a single
+	// nested *IfExpr.
 	Else []Expr
 }
 
@@ -258,6 +469,67 @@ func (e IfExpr) GetLocation() *Location {
 	return e.Location
 }
 
+// ConditionalExpr holds a conditional expression (c ? a : b). It evaluates to the consequent if the condition is
+// truthful, and to the alternative otherwise.
+type ConditionalExpr struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Condition is the evaluation that decides which of the arms is the value of the expression
+	Condition Expr
+	// Consequent is the value of the expression if the condition is truthful
+	Consequent Expr
+	// Alternative is the value of the expression if the condition is false
+	Alternative Expr
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e ConditionalExpr) GetLocation() *Location {
+	return e.Location
+}
+
+// InterpolatedString holds a string literal with interpolations (${...}). The value of the string is the
+// concatenation of its parts.
+type InterpolatedString struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Parts are the pieces of the string, in order. The verbatim text is held as string *LiteralExpr, and the
+	// interpolations as the expressions they contain.
+	Parts []Expr
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e InterpolatedString) GetLocation() *Location {
+	return e.Location
+}
+
+// BlockExpr holds a bare block of statements, delimited by curly brackets. The block introduces a new lexical scope,
+// so the definitions inside it are not visible after it ends.
+type BlockExpr struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Body is the expressions inside the block
+	Body []Expr
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e BlockExpr) GetLocation() *Location {
+	return e.Location
+}
+
+// CommentExpr holds a line comment found between statements. It has no semantic meaning and is only produced by a
+// [Parser] with comment preservation enabled (see [Parser.PreserveComments]).
+type CommentExpr struct {
+	// Location points to the source code that created the expression
+	Location *Location
+	// Text is the content of the comment, without the leading slashes
+	Text string
+}
+
+// GetLocation returns the location of the source code that generated the expression
+func (e CommentExpr) GetLocation() *Location {
+	return e.Location
+}
+
 // isValidExpr will return false if the expression is of type *BadExpr or *EOS
 func isValidExpr(expr Expr) bool {
 	if expr == nil {
@@ -274,6 +546,185 @@ func isValidExpr(expr Expr) bool {
 	return true
 }
 
+// Inspect traverses an expression tree in depth-first order. It starts by calling fn(expr), and if fn returns true it
+// recursively inspects each of the children of expr. Nil expressions are ignored.
+func Inspect(expr Expr, fn func(Expr) bool) {
+	if expr == nil || !fn(expr) {
+		return
+	}
+
+	switch e := expr.(type) {
+	case *AnnotatedExpr:
+		Inspect(e.Expr, fn)
+	case *FuncDecl:
+		for _, child := range e.Body {
+			Inspect(child, fn)
+		}
+	case *FuncLit:
+		for _, child := range e.Body {
+			Inspect(child, fn)
+		}
+	case *VariableDecl:
+		Inspect(e.Value, fn)
+	case *MultiVariableDecl:
+		for _, value := range e.Values {
+			Inspect(value, fn)
+		}
+	case *ReturnExpr:
+		Inspect(e.Value, fn)
+	case *DeferExpr:
+		Inspect(e.Call, fn)
+	case *FuncCall:
+		Inspect(e.Callee, fn)
+		for _, arg := range e.Args {
+			Inspect(arg, fn)
+		}
+	case *BinaryExpr:
+		Inspect(e.Op1, fn)
+		Inspect(e.Op2, fn)
+	case *BooleanExpr:
+		Inspect(e.Op1, fn)
+		Inspect(e.Op2, fn)
+	case *UnaryExpr:
+		Inspect(e.Operand, fn)
+	case *ConditionalExpr:
+		Inspect(e.Condition, fn)
+		Inspect(e.Consequent, fn)
+		Inspect(e.Alternative, fn)
+	case *InterpolatedString:
+		for _, part := range e.Parts {
+			Inspect(part, fn)
+		}
+	case *IfExpr:
+		Inspect(e.Condition, fn)
+		for _, child := range e.Consequent {
+			Inspect(child, fn)
+		}
+
+		for _, child := range e.Else {
+			Inspect(child, fn)
+		}
+	case *BlockExpr:
+		for _, child := range e.Body {
+			Inspect(child, fn)
+		}
+	}
+}
+
+// Rewrite transforms an expression tree bottom-up. The children of each node are rewritten first, and then the node is
+// replaced by the result of fn, which receives a copy of the node holding the rewritten children. Nodes are copied
+// before being handed to fn, so the original tree is never mutated and a new tree is returned. Nil expressions are
+// returned as is.
+func Rewrite(expr Expr, fn func(Expr) Expr) Expr {
+	if expr == nil {
+		return nil
+	}
+
+	switch e := expr.(type) {
+	case *AnnotatedExpr:
+		c := *e
+		c.Expr = Rewrite(e.Expr, fn)
+		return fn(&c)
+	case *FuncDecl:
+		c := *e
+		c.Body = rewriteAll(e.Body, fn)
+		return fn(&c)
+	case *FuncLit:
+		c := *e
+		c.Body = rewriteAll(e.Body, fn)
+		return fn(&c)
+	case *ExternDecl:
+		c := *e
+		return fn(&c)
+	case *ImportDecl:
+		c := *e
+		return fn(&c)
+	case *ReturnExpr:
+		c := *e
+		c.Value = Rewrite(e.Value, fn)
+		return fn(&c)
+	case *DeferExpr:
+		c := *e
+		c.Call = Rewrite(e.Call, fn)
+		return fn(&c)
+	case *VariableDecl:
+		c := *e
+		c.Value = Rewrite(e.Value, fn)
+		return fn(&c)
+	case *MultiVariableDecl:
+		c := *e
+		c.Values = rewriteAll(e.Values, fn)
+		return fn(&c)
+	case *FuncCall:
+		c := *e
+		c.Callee = Rewrite(e.Callee, fn)
+		c.Args = rewriteAll(e.Args, fn)
+		return fn(&c)
+	case *BinaryExpr:
+		c := *e
+		c.Op1 = Rewrite(e.Op1, fn)
+		c.Op2 = Rewrite(e.Op2, fn)
+		return fn(&c)
+	case *BooleanExpr:
+		c := *e
+		c.Op1 = Rewrite(e.Op1, fn)
+		c.Op2 = Rewrite(e.Op2, fn)
+		return fn(&c)
+	case *UnaryExpr:
+		c := *e
+		c.Operand = Rewrite(e.Operand, fn)
+		return fn(&c)
+	case *ConditionalExpr:
+		c := *e
+		c.Condition = Rewrite(e.Condition, fn)
+		c.Consequent = Rewrite(e.Consequent, fn)
+		c.Alternative = Rewrite(e.Alternative, fn)
+		return fn(&c)
+	case *InterpolatedString:
+		c := *e
+		c.Parts = rewriteAll(e.Parts, fn)
+		return fn(&c)
+	case *IfExpr:
+		c := *e
+		c.Condition = Rewrite(e.Condition, fn)
+		c.Consequent = rewriteAll(e.Consequent, fn)
+		c.Else = rewriteAll(e.Else, fn)
+		return fn(&c)
+	case *BlockExpr:
+		c := *e
+		c.Body = rewriteAll(e.Body, fn)
+		return fn(&c)
+	case *Identifier:
+		c := *e
+		return fn(&c)
+	case *LiteralExpr:
+		c := *e
+		return fn(&c)
+	case *CommentExpr:
+		c := *e
+		return fn(&c)
+	case *BadExpr:
+		c := *e
+		return fn(&c)
+	default:
+		return fn(expr)
+	}
+}
+
+// rewriteAll rewrites each of the expressions, and returns them in a new slice
+func rewriteAll(exprs []Expr, fn func(Expr) Expr) []Expr {
+	if exprs == nil {
+		return nil
+	}
+
+	rewritten := make([]Expr, len(exprs))
+	for i, expr := range exprs {
+		rewritten[i] = Rewrite(expr, fn)
+	}
+
+	return rewritten
+}
+
 // SyntacticAnalyzer defines the expected behavior of a code parser. The syntactic analyzer should be able to
 // evaluate the logic and construction of the source code, and is location-aware. Its main responsibility is to
 // organize the code into an ordered AST.
@@ -286,6 +737,65 @@ type SyntacticAnalyzer interface {
 	GetFilename() string
 }
 
+// ignorePrefix starts the comments that are ignore directives
+const ignorePrefix = "maqui:ignore"
+
+// IgnoreDirective is a comment like "// maqui:ignore unused" that suppresses the warnings of the statement following
+// it. The kinds of the warnings to suppress are listed after the directive, separated by spaces. If none is listed, all
+// the warnings of the statement are suppressed.
+type IgnoreDirective struct {
+	// Location points to the comment of the directive
+	Location *Location
+	// Kinds holds the kinds of the warnings suppressed, or nil if all are
+	Kinds []string
+	// Start and End delimit the source code of the statement the directive applies to
+	Start, End uint64
+}
+
+// Suppresses returns true if the directive applies to the warning
+func (d IgnoreDirective) Suppresses(w Warning) bool {
+	loc := w.GetLocation()
+	if loc == nil || loc.Start < d.Start || loc.Start >= d.End {
+		return false
+	}
+
+	// The statements of different files overlap in their offsets
+	if d.Location != nil && d.Location.File != loc.File {
+		return false
+	}
+
+	if len(d.Kinds) == 0 {
+		return true
+	}
+
+	for _, kind := range d.Kinds {
+		if kind == w.Kind() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIgnoreDirective returns the directive held by the comment, or nil if the comment is not a directive
+func parseIgnoreDirective(comment Token) *IgnoreDirective {
+	text := strings.TrimSpace(comment.Value)
+	if !strings.HasPrefix(text, ignorePrefix) {
+		return nil
+	}
+
+	rest := strings.TrimPrefix(text, ignorePrefix)
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		// Another word that starts like the directive
+		return nil
+	}
+
+	return &IgnoreDirective{
+		Location: comment.Loc,
+		Kinds:    strings.Fields(rest),
+	}
+}
+
 // Parser is the default syntactic analyzer for Maqui. It uses recursive decent to generate an AST.
 type Parser struct {
 	// filename is the name of the file used to create this parser
@@ -294,11 +804,39 @@ type Parser struct {
 	tokenizer Tokenizer
 	// output is the buffer where the processed expressions are stored
 	output chan Expr
-	// buf holds the next token coming from the tokenizer. It might be empty and populated only when needed. It's used
-	// to keep peeked tokens without having to roll back the stream.
-	buf *Token
+	// buf holds the next token coming from the tokenizer while buffered is set. It's populated only when needed, and
+	// used to keep peeked tokens without having to roll back the stream. It's held by value, so peeking doesn't
+	// allocate.
+	buf Token
+	// buffered is true while buf holds a token
+	buffered bool
+	// ended holds the error token sent by the tokenizer, if any. An error ends the stream, so no more tokens are read
+	// after it.
+	ended *Token
+	// keepComments makes the parser output the comments as *CommentExpr instead of discarding them
+	keepComments bool
+	// comments holds the comments skipped over by next that are still waiting to be output as statements
+	comments []Token
+	// pendingIgnores holds the ignore directives waiting for the statement they apply to
+	pendingIgnores []*IgnoreDirective
+	// ignores holds the ignore directives already bound to their statement
+	ignores []*IgnoreDirective
+	// depth is the current nesting level of the expressions and blocks being parsed
+	depth int
+	// blocks is the number of blocks enclosing the statement being parsed, counted from the body of the innermost
+	// function. It's 0 outside any function, and 1 at the top level of a function body.
+	blocks int
+	// limit is the most top-level statements RunContext parses, or 0 if there's no limit
+	limit int
 }
 
+// ErrStatementLimit is returned by [Parser.RunContext] when it stops at the statement limit before the end of the file
+var ErrStatementLimit = errors.New("statement limit reached")
+
+// maxNestingDepth is the deepest expressions and blocks can be nested before the parser gives up on them, so
+// pathological input can't overflow the stack of the recursive decent.
+const maxNestingDepth = 1000
+
 // NewParser creates a Parses with the provided tokenizer as the token provider. It sets the filename of Parser to the
 // filename of the tokenizer.
 func NewParser(tokenizer Tokenizer) *Parser {
@@ -325,12 +863,30 @@ func (p *Parser) GetFilename() string {
 	return p.filename
 }
 
+// PreserveComments sets whether the line comments should be kept. When enabled, each comment is output as a standalone
+// *CommentExpr statement, placed before the statement that follows it in the source. Comments are discarded by
+// default. It should be called before Do or Run.
+func (p *Parser) PreserveComments(preserve bool) {
+	p.keepComments = preserve
+}
+
+// SetStatementLimit caps the number of top-level statements parsed by RunContext, so huge files can be previewed with a
+// bounded amount of work. A limit of 0, the default, parses the whole file.
+func (p *Parser) SetStatementLimit(limit int) {
+	p.limit = limit
+}
+
+// Ignores returns the ignore directives found in the comments. It should only be called once the parser is done.
+func (p *Parser) Ignores() []*IgnoreDirective {
+	return p.ignores
+}
+
 // Do runs the parser asynchronously and starts putting the resulting expressions in the buffer. It will also start the
 // token provider.
 func (p *Parser) Do() {
 	go p.tokenizer.Do()
 
-	for p.peek().Typ != TokenEOF {
+	for p.peek().Typ != TokenEOF || len(p.comments) != 0 {
 		p.output <- p.statement()
 	}
 
@@ -346,50 +902,113 @@ func (p *Parser) Run() *AST {
 		Filename: p.GetFilename(),
 	}
 
-	for p.peek().Typ != TokenEOF {
+	for p.peek().Typ != TokenEOF || len(p.comments) != 0 {
 		ast.Statements = append(ast.Statements, &AnnotatedExpr{
 			Expr: p.statement(),
 		})
 	}
 
+	ast.Ignores = p.ignores
 	return ast
 }
 
+// RunContext runs the parser synchronously like Run, but stops between top-level statements once the context is done or
+// the statement limit is reached. The statements parsed so far are returned either way, along with the error of the
+// context or [ErrStatementLimit]. The rest of the tokens are drained in the background, so the tokenizer can finish.
+func (p *Parser) RunContext(ctx context.Context) (*AST, error) {
+	go p.tokenizer.Do()
+
+	ast := &AST{
+		Filename: p.GetFilename(),
+	}
+
+	var err error
+	for p.peek().Typ != TokenEOF || len(p.comments) != 0 {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if p.limit != 0 && len(ast.Statements) >= p.limit {
+			err = ErrStatementLimit
+			break
+		}
+
+		ast.Statements = append(ast.Statements, &AnnotatedExpr{
+			Expr: p.statement(),
+		})
+	}
+
+	if err != nil && (!p.buffered || p.buf.Typ != TokenEOF) {
+		go drain(p.tokenizer)
+	}
+
+	ast.Ignores = p.ignores
+	return ast, err
+}
+
+// drain consumes the tokens the tokenizer has left, up to the end of file, without parsing them
+func drain(tokenizer Tokenizer) {
+	for tok := tokenizer.Get(); tok.Typ != TokenEOF; tok = tokenizer.Get() {
+	}
+}
+
 // peek fetches a coppy of the next token without consuming it. Internally it uses the buffer (buf) of the Parser. If
 // the buffer already has a token it will be returned. If the buffer is empty the next token is fetched and stored in
 // the buffer.
 func (p *Parser) peek() Token {
-	if p.buf == nil {
-		temp := p.next()
-		p.buf = &temp
+	if !p.buffered {
+		p.buf = p.next()
+		p.buffered = true
 	}
 
-	return *p.buf
+	return p.buf
 }
 
 // next gets the next token in the stream and moves the position by one. Internally it will first check the buffer (buf)
 // if it contains a token that token will be returned and the buffer will be emptied. If the buffer is empty a new
 // token is fetched from the tokenizer.
 func (p *Parser) next() Token {
-	if p.buf != nil {
+	if p.buffered {
 		if p.buf.Typ == TokenEOF {
 			// If the token is EOF don't clear the buffer
-			return *p.buf
+			return p.buf
 		}
 
-		temp := p.buf
-		p.buf = nil
+		p.buffered = false
+		return p.buf
+	}
 
-		return *temp
+	if p.ended != nil {
+		// Nothing is read after an error, so the parser stops even if the tokenizer never sends the end of the file
+		p.buf, p.buffered = Token{Typ: TokenEOF, Loc: p.ended.Loc}, true
+		return p.buf
 	}
 
 	tok := p.tokenizer.Get()
+	if tok.isEmpty() {
+		// A closed stream only returns empty tokens, so it's taken as the end of the file
+		tok.Typ = TokenEOF
+	}
+
+	if tok.Typ == TokenError {
+		p.ended = &tok
+	}
+
 	if !tok.isValid() {
 		// If a token is invalid (such as Error or EOF) keep it buffered since no more valid tokens are expected
-		p.buf = &tok
+		p.buf, p.buffered = tok, true
 	}
 
 	if tok.isComment() {
+		if d := parseIgnoreDirective(tok); d != nil {
+			p.pendingIgnores = append(p.pendingIgnores, d)
+		}
+
+		if p.keepComments {
+			// Keep the comment until it can be output as a statement
+			p.comments = append(p.comments, tok)
+		}
+
 		// Skip comments
 		return p.next()
 	}
@@ -432,15 +1051,80 @@ func (p *Parser) errorf(l *Location, format string, args ...interface{}) Expr {
 }
 
 // statement is the entry point for parsing. It will first try to resolve the token type to find out what parsing branch
-// to take. If not able, it will use recursive decent to build the tree for the expression.
+// to take. If not able, it will use recursive decent to build the tree for the expression. The ignore directives found
+// before the statement are bound to it.
 func (p *Parser) statement() Expr {
-	switch tok := p.peek(); tok.Typ {
+	tok := p.peek()
+	if len(p.comments) != 0 {
+		// Pending comments come before the statement that was peeked
+		return p.comment()
+	}
+
+	ignores := p.pendingIgnores
+	p.pendingIgnores = nil
+
+	expr := p.statementExpr(tok)
+
+	if len(ignores) != 0 {
+		// The statement spans up to the token that follows it
+		end := uint64(math.MaxUint64)
+		if next := p.peek(); next.Loc != nil {
+			end = next.Loc.Start
+		}
+
+		for _, d := range ignores {
+			if tok.Loc != nil {
+				d.Start = tok.Loc.Start
+			}
+
+			d.End = end
+		}
+
+		p.ignores = append(p.ignores, ignores...)
+	}
+
+	return expr
+}
+
+// statementExpr parses the statement that starts with the token
+func (p *Parser) statementExpr(tok Token) Expr {
+	switch tok.Typ {
 	case TokenFunc:
 		return p.funcDecl()
+	case TokenExport:
+		return p.exportDecl()
+	case TokenExtern:
+		return p.externDecl()
+	case TokenImport:
+		return p.importDecl()
+	case TokenReturn:
+		return p.returnStmt()
+	case TokenDefer:
+		return p.deferStmt()
 	case TokenIf:
 		return p.ifBranch()
+	case TokenOpenCurly:
+		return p.block()
 	default:
-		return p.expr()
+		expr := p.expr()
+
+		// A list of names can only start a statement
+		if id, isIdentifier := expr.(*Identifier); isIdentifier && p.check(TokenComma) {
+			return p.multiVarDecl(id)
+		}
+
+		return expr
+	}
+}
+
+// comment pops the oldest pending comment and returns it as a *CommentExpr
+func (p *Parser) comment() Expr {
+	tok := p.comments[0]
+	p.comments = p.comments[1:]
+
+	return &CommentExpr{
+		Location: tok.Loc,
+		Text:     tok.Value,
 	}
 }
 
@@ -448,24 +1132,288 @@ func (p *Parser) statement() Expr {
 func (p *Parser) funcDecl() Expr {
 	start := p.next().Loc // func keyword
 
+	if p.check(TokenOpenParentheses) {
+		// A function literal starting a statement, which is usually called right away
+		return p.calls(p.funcLitSignature(start))
+	}
+
+	name := p.next()
+	if name.Typ != TokenIdentifier {
+		return p.errorf(name.Loc, "expected function name")
+	}
+
+	// TODO: Allow arguments
+	if bad := p.emptyParams("bad function declaration"); bad != nil {
+		return bad
+	}
+
+	decl := &FuncDecl{
+		Location: start,
+		Name:     name.Value,
+	}
+
+	if p.check(TokenOpenParentheses) {
+		results, bad := p.namedResults()
+		if bad != nil {
+			return bad
+		}
+
+		decl.Results = results
+	}
+
+	decl.Body = p.blockStmt()
+	return decl
+}
+
+// funcLit builds an anonymous function (*FuncLit) expression. If it fails a *BadExpr will be returned.
+func (p *Parser) funcLit() Expr {
+	start := p.next().Loc // func keyword
+
+	return p.funcLitSignature(start)
+}
+
+// funcLitSignature builds a function literal (*FuncLit) whose func keyword was already consumed at the start location.
+// If it fails a *BadExpr will be returned.
+func (p *Parser) funcLitSignature(start *Location) Expr {
+	if bad := p.emptyParams("bad function literal"); bad != nil {
+		return bad
+	}
+
+	lit := &FuncLit{
+		Location: start,
+	}
+
+	if p.check(TokenOpenParentheses) {
+		results, bad := p.namedResults()
+		if bad != nil {
+			return bad
+		}
+
+		lit.Results = results
+	}
+
+	// The body of the literal is a function of its own, so its blocks are counted from 0 again
+	blocks := p.blocks
+	p.blocks = 0
+	lit.Body = p.blockStmt()
+	p.blocks = blocks
+
+	return lit
+}
+
+// emptyParams consumes the parameter list of a function, which can only be empty for now. If it's malformed, a *BadExpr
+// with the message is returned, spanning from the opening parenthesis to the offending token.
+func (p *Parser) emptyParams(msg string) Expr {
+	open := p.next()
+	if open.Typ != TokenOpenParentheses {
+		return p.errorf(open.Loc, msg)
+	}
+
+	if closer := p.next(); closer.Typ != TokenCloseParentheses {
+		return p.errorf(span(open.Loc, closer.Loc), msg)
+	}
+
+	return nil
+}
+
+// span returns a location covering from the start of one location up to the end of the other. If either is missing, or
+// they are in different files, the first one is returned as is.
+func span(from, to *Location) *Location {
+	if from == nil || to == nil || from.File != to.File || to.End < from.Start {
+		return from
+	}
+
+	return &Location{
+		Start:   from.Start,
+		End:     to.End,
+		File:    from.File,
+		Line:    from.Line,
+		NewLine: from.NewLine,
+	}
+}
+
+// namedResults parses the named results of a function declaration or literal, as in (result int). Only a single result
+// is allowed. If it fails a *BadExpr will be returned, spanning from the opening parenthesis to the offending token.
+func (p *Parser) namedResults() ([]*Param, Expr) {
+	open := p.next() // Opening parenthesis
+
+	var results []*Param
+	for !p.check(TokenCloseParentheses) {
+		if len(results) != 0 {
+			return nil, p.errorf(span(open.Loc, p.peek().Loc), "functions can only have one result")
+		}
+
+		resultName := p.next()
+		if resultName.Typ != TokenIdentifier {
+			return nil, p.errorf(span(open.Loc, resultName.Loc), "bad result in function declaration")
+		}
+
+		resultType := p.next()
+		if resultType.Typ != TokenIdentifier {
+			return nil, p.errorf(span(open.Loc, resultType.Loc), "bad result in function declaration")
+		}
+
+		results = append(results, &Param{
+			Location: resultName.Loc,
+			Name:     resultName.Value,
+			Type:     resultType.Value,
+		})
+	}
+
+	p.next() // Closing parenthesis
+
+	return results, nil
+}
+
+// returnStmt builds a return statement (*ReturnExpr), along with its value if any. Returns are only allowed inside
+// functions. If it fails a *BadExpr will be returned.
+func (p *Parser) returnStmt() Expr {
+	tok := p.next() // return keyword
+
+	if p.blocks == 0 {
+		return p.errorf(tok.Loc, "return outside of a function")
+	}
+
+	ret := &ReturnExpr{
+		Location: tok.Loc,
+	}
+
+	// The statements are not separated, so anything that can start an expression on the same line is taken as the
+	// returned value
+	next := p.peek()
+	if !startsExpr(next.Typ) || (next.Loc != nil && next.Loc.NewLine) {
+		return ret
+	}
+
+	ret.Value = p.expr()
+	if _, isDecl := ret.Value.(*VariableDecl); isDecl {
+		return p.errorf(ret.Value.GetLocation(), "unexpected declaration after return")
+	}
+
+	return ret
+}
+
+// startsExpr returns true if a token of the type can be the first of an expression
+func startsExpr(typ TokenType) bool {
+	switch typ {
+	case TokenNumber, TokenString, TokenInterpolatedString, TokenBool, TokenIdentifier, TokenFunc, TokenOpenParentheses,
+		TokenMinus, TokenTilde:
+		return true
+	}
+
+	return false
+}
+
+// deferStmt builds a deferred call (*DeferExpr). Defers are only allowed at the top level of a function body, so they
+// always run once the function returns. If it fails a *BadExpr will be returned.
+func (p *Parser) deferStmt() Expr {
+	tok := p.next() // defer keyword
+	blocks := p.blocks
+
+	// The deferred expression is parsed even if the defer is misplaced, so parsing resumes after it
+	call := p.expr()
+
+	switch {
+	case blocks == 0:
+		return p.errorf(tok.Loc, "defer outside of a function")
+	case blocks > 1:
+		return p.errorf(tok.Loc, "defer must be at the top level of the function body")
+	}
+
+	return &DeferExpr{
+		Location: tok.Loc,
+		Call:     call,
+	}
+}
+
+// exportDecl builds a function declaration (*FuncDecl) marked as exported. If it fails a *BadExpr will be returned.
+func (p *Parser) exportDecl() Expr {
+	start := p.next().Loc // export keyword
+
+	if !p.check(TokenFunc) {
+		return p.errorf(start, "expected function declaration after export")
+	}
+
+	decl := p.funcDecl()
+	if f, ok := decl.(*FuncDecl); ok {
+		f.Exported = true
+	}
+
+	return decl
+}
+
+// externDecl builds an external function declaration (*ExternDecl). The return type is optional, and it's only taken
+// when the identifier following the parameters names a type. If it fails a *BadExpr will be returned.
+func (p *Parser) externDecl() Expr {
+	start := p.next().Loc // extern keyword
+
+	if !p.consume(TokenFunc) {
+		return p.errorf(start, "expected function declaration after extern")
+	}
+
 	name := p.expect(TokenIdentifier)
 	if name == nil {
 		return p.errorf(start, "expected function name")
 	}
 
-	// TODO: Allow arguments
-	if !p.consume(TokenOpenParentheses) || !p.consume(TokenCloseParentheses) {
-		return p.errorf(start, "bad function declaration")
+	if !p.consume(TokenOpenParentheses) {
+		return p.errorf(start, "bad extern declaration")
 	}
 
-	return &FuncDecl{
+	decl := &ExternDecl{
 		Location: start,
 		Name:     name.Value,
-		Body:     p.blockStmt(),
 	}
+
+	for !p.check(TokenCloseParentheses) {
+		if len(decl.Params) != 0 && !p.consume(TokenComma) {
+			return p.errorf(start, "expected ',' between parameters")
+		}
+
+		paramName := p.expect(TokenIdentifier)
+		paramType := p.expect(TokenIdentifier)
+		if paramName == nil || paramType == nil {
+			return p.errorf(start, "bad parameter in extern declaration")
+		}
+
+		decl.Params = append(decl.Params, &Param{
+			Location: paramName.Loc,
+			Name:     paramName.Value,
+			Type:     paramType.Value,
+		})
+	}
+
+	p.next() // Closing parenthesis
+
+	if tok := p.peek(); tok.Typ == TokenIdentifier && isBasicType(tok.Value) {
+		decl.Returns = append(decl.Returns, p.next().Value)
+	}
+
+	return decl
 }
 
-// ifBranch builds an *IfExpr from the stream. If it fails a *BadExpr will be returned.
+// importDecl builds an import declaration (*ImportDecl). Imports are only allowed at the top level of the file. If it
+// fails a *BadExpr will be returned.
+func (p *Parser) importDecl() Expr {
+	start := p.next().Loc // import keyword
+
+	path := p.expect(TokenString)
+	if path == nil {
+		return p.errorf(start, "expected the path of the imported file")
+	}
+
+	if p.depth != 0 {
+		return p.errorf(start, "imports are only allowed at the top level")
+	}
+
+	return &ImportDecl{
+		Location: start,
+		Path:     path.Value,
+	}
+}
+
+// ifBranch builds an *IfExpr from the stream, including its chain of else if branches. If it fails a *BadExpr will be
+// returned.
 func (p *Parser) ifBranch() Expr {
 	ifKw := p.expect(TokenIf)
 	if ifKw == nil {
@@ -488,19 +1436,47 @@ func (p *Parser) ifBranch() Expr {
 	}
 
 	p.next() // Skip else
+
+	// An else if is chained as an if nested inside the else branch
+	if p.check(TokenIf) {
+		expr.Else = []Expr{p.ifBranch()}
+		return expr
+	}
+
 	expr.Else = p.blockStmt()
 	return expr
 }
 
+// block builds a bare *BlockExpr from the stream. If the block is malformed, a *BadExpr will be placed inside its body.
+func (p *Parser) block() Expr {
+	return &BlockExpr{
+		Location: p.peek().Loc,
+		Body:     p.blockStmt(),
+	}
+}
+
 // blockStmt parses a list of statements. If it fails a *BadExpr will be placed inside the returned slice, but it might
 // have valid Expr inside.
 func (p *Parser) blockStmt() []Expr {
-	if tok := p.expect(TokenOpenCurly); tok == nil {
-		return []Expr{p.errorf(nil, "invalid blocks statement")}
+	if p.depth >= maxNestingDepth {
+		tok := p.next() // Skip the token so the parser always moves forward
+		return []Expr{p.errorf(tok.Loc, "blocks statement too deeply nested")}
+	}
+
+	p.depth++
+	p.blocks++
+	defer func() {
+		p.depth--
+		p.blocks--
+	}()
+
+	open := p.next()
+	if open.Typ != TokenOpenCurly {
+		return []Expr{p.errorf(open.Loc, "invalid blocks statement")}
 	}
 
 	var exprs []Expr
-	for tok := p.peek(); tok.isValid() && tok.Typ != TokenCloseCurly; tok = p.peek() {
+	for tok := p.peek(); len(p.comments) != 0 || (tok.isValid() && tok.Typ != TokenCloseCurly); tok = p.peek() {
 		exprs = append(exprs, p.statement())
 	}
 
@@ -510,26 +1486,27 @@ func (p *Parser) blockStmt() []Expr {
 	case TokenError:
 		return append(exprs, p.errorf(closer.Loc, "invalid blocks statement"))
 	case TokenEOF:
-		return append(exprs, p.errorf(closer.Loc, "unclosed blocks statement"))
+		// The end of the file is not where the mistake is, so the error points at the brace left open
+		return append(exprs, p.errorf(open.Loc, "unclosed blocks statement"))
 	default:
-		return append(exprs, p.errorf(closer.Loc, "unexpected token in blocks statement"))
+		return append(exprs, p.errorf(closer.Loc, "unexpected %s token in blocks statement", closer.Typ))
 	}
 }
 
 // expr parses an expression using recursive decent. The expression might be a *BadExpr if a invalid token is found.
 func (p *Parser) expr() Expr {
-	expr := p.additiveExpr()
+	if p.depth >= maxNestingDepth {
+		tok := p.next() // Skip the token so the parser always moves forward
+		return p.errorf(tok.Loc, "expression too deeply nested")
+	}
 
-	id, ok := expr.(*Identifier)
-	if ok {
-		tok := p.peek()
-		if tok.Typ == TokenDeclaration {
-			return p.varDeclExpr(id)
-		}
+	p.depth++
+	defer func() { p.depth-- }()
 
-		if tok.Typ == TokenOpenParentheses {
-			return p.funcCall(id)
-		}
+	expr := p.conditionalExpr()
+
+	if id, ok := expr.(*Identifier); ok && p.check(TokenDeclaration) {
+		return p.varDeclExpr(id)
 	}
 
 	return expr
@@ -545,20 +1522,64 @@ func (p *Parser) varDeclExpr(id *Identifier) Expr {
 	p.next() // Skip :=
 
 	return &VariableDecl{
-		Name:  id.Name,
-		Value: p.expr(),
+		Location: id.Location,
+		Name:     id.Name,
+		Value:    p.expr(),
+	}
+}
+
+// multiVarDecl builds a declaration of several variables (*MultiVariableDecl), as in a, b := 1, 2, starting from the
+// identifier of the first name. If it fails a *BadExpr will be returned.
+func (p *Parser) multiVarDecl(first *Identifier) Expr {
+	decl := &MultiVariableDecl{
+		Location: first.Location,
+		Names:    []string{first.Name},
+	}
+
+	for p.check(TokenComma) {
+		p.next() // Skip the comma
+
+		name := p.expect(TokenIdentifier)
+		if name == nil {
+			return p.errorf(first.Location, "expected a variable name after the comma")
+		}
+
+		decl.Names = append(decl.Names, name.Value)
+	}
+
+	if !p.consume(TokenDeclaration) {
+		return p.errorf(first.Location, "expected := after the variable names")
+	}
+
+	for {
+		decl.Values = append(decl.Values, p.expr())
+
+		if !p.check(TokenComma) {
+			return decl
+		}
+
+		p.next() // Skip the comma
 	}
 }
 
-// funcCall will try to parse a function call (*FuncCall). If an invalid token is found a *BadExpr will be returned
-// containing an error description.
-func (p *Parser) funcCall(id *Identifier) Expr {
+// funcCall will try to parse a call (*FuncCall) to the callee expression. The last argument can be followed by a
+// trailing comma, as in f(1, 2,). If an invalid token is found a *BadExpr will be returned containing an error
+// description.
+func (p *Parser) funcCall(callee Expr) Expr {
 	if !p.consume(TokenOpenParentheses) {
-		return p.errorf(nil, "bad function call")
+		return p.errorf(callee.GetLocation(), "bad function call")
 	}
 
 	var args []Expr
 	for tok := p.peek(); tok.isValid() && tok.Typ != TokenCloseParentheses; tok = p.peek() {
+		if tok.Typ == TokenComma {
+			// A comma without an argument before it, as in f(,) or f(1,,). The call goes on after it, so it's still
+			// closed as usual.
+			p.next()
+			args = append(args, p.errorf(tok.Loc, "expected an argument before ','"))
+			continue
+		}
+
 		args = append(args, p.expr())
 
 		if !p.check(TokenComma) {
@@ -569,12 +1590,38 @@ func (p *Parser) funcCall(id *Identifier) Expr {
 	}
 
 	if !p.consume(TokenCloseParentheses) {
-		return p.errorf(nil, "bad function call")
+		return p.errorf(callee.GetLocation(), "bad function call")
 	}
 
 	return &FuncCall{
-		Name: id.Name,
-		Args: args,
+		Location: callee.GetLocation(),
+		Callee:   callee,
+		Args:     args,
+	}
+}
+
+// conditionalExpr will parse a conditional expression if found, or decent otherwise. Conditional expressions bind
+// looser than any other operator, and nest to the right, so a ? b : c ? d : e is a ? b : (c ? d : e).
+func (p *Parser) conditionalExpr() Expr {
+	cond := p.additiveExpr()
+
+	tok := p.peek()
+	if tok.Typ != TokenQuestion {
+		return cond
+	}
+
+	p.next() // Skip ?
+
+	consequent := p.conditionalExpr()
+	if !p.consume(TokenColon) {
+		return p.errorf(tok.Loc, "expected ':' in conditional expression")
+	}
+
+	return &ConditionalExpr{
+		Location:    cond.GetLocation(),
+		Condition:   cond,
+		Consequent:  consequent,
+		Alternative: p.conditionalExpr(),
 	}
 }
 
@@ -583,11 +1630,12 @@ func (p *Parser) additiveExpr() Expr {
 	lhs := p.multiplicativeExpr()
 
 	for true {
-		if tok := p.peek(); tok.Typ == TokenPlus || tok.Typ == TokenMinus {
-			// Chained operands (for example 1 * 3 + 1). Go over the operand and nest
+		if tok := p.peek(); tok.Typ == TokenPlus || tok.Typ == TokenMinus || tok.Typ == TokenPipe || tok.Typ == TokenCaret {
+			// Chained operands (for example 1 * 3 + 1). Go over the operand and nest the previous operands to the left,
+			// so 1 - 2 - 3 is (1 - 2) - 3
 			p.next()
 
-			rhs := p.additiveExpr()
+			rhs := p.multiplicativeExpr()
 			lhs = &BinaryExpr{
 				Location:  tok.Loc,
 				Operation: BinaryOp(tok.Value),
@@ -609,11 +1657,12 @@ func (p *Parser) multiplicativeExpr() Expr {
 	lhs := p.booleanExpr()
 
 	for true {
-		if tok := p.peek(); tok.Typ == TokenMulti || tok.Typ == TokenDiv {
-			// Chained operands (for example 1 / 3 * 1). Go over the operand and nest
+		if tok := p.peek(); isMultiplicativeOp(tok.Typ) {
+			// Chained operands (for example 1 / 3 * 1). Go over the operand and nest the previous operands to the left,
+			// so 8 / 4 / 2 is (8 / 4) / 2
 			p.next()
 
-			rhs := p.multiplicativeExpr()
+			rhs := p.booleanExpr()
 			lhs = &BinaryExpr{
 				Location:  lhs.GetLocation(),
 				Operation: BinaryOp(tok.Value),
@@ -630,16 +1679,28 @@ func (p *Parser) multiplicativeExpr() Expr {
 	return lhs // Unreachable
 }
 
+// isMultiplicativeOp returns true if the token is an operator with the precedence of the multiplication. As in Go, the
+// bitwise and and the shifts bind as tight as the multiplication, while the bitwise or and exclusive or bind as the
+// addition.
+func isMultiplicativeOp(typ TokenType) bool {
+	switch typ {
+	case TokenMulti, TokenDiv, TokenAmpersand, TokenShiftLeft, TokenShiftRight:
+		return true
+	default:
+		return false
+	}
+}
+
 // booleanExpr will parse a boolean expression if found, or decent otherwise
 func (p *Parser) booleanExpr() Expr {
 	lhs := p.unaryExpr()
 
 	for true {
 		if tok := p.peek(); tok.Typ == TokenBooleanEquals {
-			// Chained operands (for example 1 == 3 == 1). Go over the operand and nest
+			// Chained operands (for example 1 == 3 == 1) nest to the left, so (1 == 3) == 1
 			p.next()
 
-			rhs := p.booleanExpr()
+			rhs := p.unaryExpr()
 			lhs = &BooleanExpr{
 				Location:  lhs.GetLocation(),
 				Operation: BooleanOp(tok.Value),
@@ -660,6 +1721,11 @@ func (p *Parser) booleanExpr() Expr {
 func (p *Parser) unaryExpr() Expr {
 	if p.check(TokenMinus) { // Unary negative
 		tok := p.next()
+		if p.check(TokenNumber) {
+			// Negated numbers are folded into a single negative literal, so that the smallest integers, such as
+			// -2147483648, are typed by their own value and never overflow while being negated.
+			return p.negativeLiteral(tok)
+		}
 
 		return &UnaryExpr{
 			Location:  tok.Loc,
@@ -668,20 +1734,45 @@ func (p *Parser) unaryExpr() Expr {
 		}
 	}
 
+	if p.check(TokenTilde) { // Bitwise not
+		tok := p.next()
+
+		return &UnaryExpr{
+			Location:  tok.Loc,
+			Operation: UnaryBitwiseNot,
+			Operand:   p.primary(),
+		}
+	}
+
 	return p.primary()
 }
 
 // primary will parse a primary expression if found, or decent otherwise. Primary expressions are identifiers, literals,
-// or parenthesised expressions.
+// function literals or parenthesised expressions, and the calls to them.
 func (p *Parser) primary() Expr {
+	var expr Expr
 	switch tok := p.peek(); tok.Typ {
 	case TokenOpenParentheses:
-		return p.parenthesisedExpression()
+		expr = p.parenthesisedExpression()
 	case TokenIdentifier:
-		return p.identifier()
+		expr = p.identifier()
+	case TokenFunc:
+		expr = p.funcLit()
+	default:
+		return p.literal()
+	}
+
+	return p.calls(expr)
+}
+
+// calls parses the calls made to the expression, if any. Calls bind tighter than any operator, and can be chained, as in
+// f()(), so each call is made to the result of the previous one.
+func (p *Parser) calls(expr Expr) Expr {
+	for isValidExpr(expr) && p.check(TokenOpenParentheses) {
+		expr = p.funcCall(expr)
 	}
 
-	return p.literal()
+	return expr
 }
 
 // parenthesisedExpression unwraps a parenthesised expression and returns the contained expression. If the expression
@@ -692,6 +1783,10 @@ func (p *Parser) parenthesisedExpression() Expr {
 	}
 
 	exp := p.expr()
+	if _, isBad := exp.(*BadExpr); isBad {
+		// Keep the error of the inner expression
+		return exp
+	}
 
 	if tok := p.next(); tok.Typ != TokenCloseParentheses {
 		return p.errorf(tok.Loc, "expected closing parenthesis")
@@ -700,29 +1795,66 @@ func (p *Parser) parenthesisedExpression() Expr {
 	return exp
 }
 
-// identifier returns an identifier expression (*Identifier). If the next expression is not an identifier a *BadExpr is
-// returned.
+// identifier returns an identifier expression (*Identifier). A name qualified by a module (module.name) is returned as
+// a single identifier. If the next expression is not an identifier a *BadExpr is returned.
 func (p *Parser) identifier() Expr {
 	tok := p.next()
 	if tok.Typ != TokenIdentifier {
 		return p.errorf(tok.Loc, "expected an identifier")
 	}
 
+	if !p.check(TokenDot) {
+		return &Identifier{
+			Location: tok.Loc,
+			Name:     tok.Value,
+		}
+	}
+
+	p.next() // Skip the dot
+
+	name := p.expect(TokenIdentifier)
+	if name == nil {
+		return p.errorf(tok.Loc, "expected a name after '%s.'", tok.Value)
+	}
+
+	loc := tok.Loc
+	if tok.Loc != nil && name.Loc != nil {
+		loc = &Location{
+			Start:   tok.Loc.Start,
+			End:     name.Loc.End,
+			File:    tok.Loc.File,
+			Line:    tok.Loc.Line,
+			NewLine: tok.Loc.NewLine,
+		}
+	}
+
 	return &Identifier{
-		Location: tok.Loc,
-		Name:     tok.Value,
+		Location: loc,
+		Name:     tok.Value + "." + name.Value,
 	}
 }
 
-// literal parses a literal, either a string or numeric literal and returns a *LiteralExpr. If no literal is found a
+// literal parses a literal, either a string, numeric or boolean literal and returns a *LiteralExpr. If no literal is found a
 // *BadExpr is returned.
 func (p *Parser) literal() Expr {
 	switch tok := p.peek(); tok.Typ {
 	case TokenNumber:
+		p.next()
+
+		v, err := parseNumber(tok.Value)
+		if errors.Is(err, strconv.ErrRange) {
+			return p.errorf(tok.Loc, "number out of range: %s", tok.Value)
+		}
+
+		if err != nil {
+			return p.errorf(tok.Loc, "invalid number: %s", tok.Value)
+		}
+
 		return &LiteralExpr{
 			Location: tok.Loc,
 			Typ:      LiteralNumber,
-			Value:    p.next().Value,
+			Value:    tok.Value,
+			Number:   v,
 		}
 	case TokenString:
 		return &LiteralExpr{
@@ -730,8 +1862,150 @@ func (p *Parser) literal() Expr {
 			Typ:      LiteralString,
 			Value:    p.next().Value,
 		}
+	case TokenBool:
+		return &LiteralExpr{
+			Location: tok.Loc,
+			Typ:      LiteralBool,
+			Value:    p.next().Value,
+		}
+	case TokenInterpolatedString:
+		return p.interpolatedString()
 	default:
 		p.next() // Skip errored token
 		return p.errorf(tok.Loc, "invalid symbol '%s'", tok.Value)
 	}
 }
+
+// negativeLiteral parses the number following a minus sign as a single negative literal expression
+func (p *Parser) negativeLiteral(minus Token) Expr {
+	tok := p.next()
+	loc := span(minus.Loc, tok.Loc)
+
+	v, err := parseNumber("-" + tok.Value)
+	if errors.Is(err, strconv.ErrRange) {
+		return p.errorf(loc, "number out of range: -%s", tok.Value)
+	}
+
+	if err != nil {
+		return p.errorf(loc, "invalid number: -%s", tok.Value)
+	}
+
+	return &LiteralExpr{
+		Location: loc,
+		Typ:      LiteralNumber,
+		Value:    "-" + tok.Value,
+		Number:   v,
+	}
+}
+
+// interpolatedString builds an *InterpolatedString from the stream. The expressions inside the interpolations are
+// parsed by a nested parser. If any interpolation is not a valid expression a *BadExpr will be returned.
+func (p *Parser) interpolatedString() Expr {
+	tok := p.next()
+
+	// The content of the string starts right after the opening double-quote
+	var offset uint64
+	if tok.Loc != nil {
+		offset = tok.Loc.End - uint64(len(tok.Value)) - 1
+	}
+
+	expr := &InterpolatedString{
+		Location: tok.Loc,
+	}
+
+	rest := tok.Value
+	for rest != "" {
+		start := interpolationStart(rest)
+		if start == -1 {
+			start = len(rest)
+		}
+
+		if start != 0 {
+			expr.Parts = append(expr.Parts, &LiteralExpr{
+				Location: tok.Loc,
+				Typ:      LiteralString,
+				Value:    unescapeString(rest[:start]),
+			})
+		}
+
+		if start == len(rest) {
+			break
+		}
+
+		closer := strings.IndexRune(rest[start:], '}')
+		if closer == -1 {
+			return p.errorf(tok.Loc, "unclosed interpolation")
+		}
+
+		end := start + closer
+		src := rest[start+2 : end]
+
+		part := p.interpolation(src, offset+uint64(len(tok.Value)-len(rest)+start+2), tok.Loc)
+		if !isValidExpr(part) {
+			return part
+		}
+
+		expr.Parts = append(expr.Parts, part)
+		rest = rest[end+1:]
+	}
+
+	return expr
+}
+
+// interpolationStart returns the index of the first interpolation (${) of the verbatim content of a string, skipping
+// the escaped characters, or -1 if it has none
+func interpolationStart(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+
+		if strings.HasPrefix(s[i:], "${") {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// interpolation parses the source of an interpolation into an expression. The offset is the position of the source
+// inside the file, used to locate the parsed expressions. If the source is not a single valid expression a *BadExpr is
+// returned.
+func (p *Parser) interpolation(src string, offset uint64, loc *Location) Expr {
+	toks, err := NewLexerFromReader(strings.NewReader(src)).Run()
+	if err != nil {
+		return p.errorf(loc, "invalid interpolation: %s", err)
+	}
+
+	for i := range toks {
+		toks[i].Loc.File = p.filename
+		toks[i].Loc.Start += offset
+		toks[i].Loc.End += offset
+	}
+
+	ast := NewParser(NewTokenStream(p.filename, toks)).Run()
+	if len(ast.Statements) != 1 {
+		return p.errorf(loc, "invalid interpolation: expected a single expression")
+	}
+
+	var bad Expr
+	Inspect(ast.Statements[0].Expr, func(expr Expr) bool {
+		if !isValidExpr(expr) && bad == nil {
+			bad = expr
+		}
+
+		return bad == nil
+	})
+
+	if bad != nil {
+		return bad
+	}
+
+	switch e := ast.Statements[0].Expr.(type) {
+	case *Identifier, *LiteralExpr, *BinaryExpr, *BooleanExpr, *UnaryExpr, *ConditionalExpr, *FuncCall:
+		return e
+	default:
+		return p.errorf(loc, "invalid interpolation: expected an expression")
+	}
+}
@@ -1,9 +1,13 @@
 package maqui
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.maqui.dev/internal/test"
 )
 
 type LexerMocker struct {
@@ -37,466 +41,1440 @@ func (b *LexerMocker) GetFilename() string {
 	return "testing"
 }
 
-func TestParser(t *testing.T) {
-	cases := []struct {
-		name   string
-		data   []Token
-		fail   bool
-		expect []Expr
-	}{
-		{
-			"FunctionDefinition",
-			[]Token{
-				{TokenFunc, "func", nil},
-				{TokenIdentifier, "main", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenCloseParentheses, ")", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-			false,
-			[]Expr{
-				&FuncDecl{
-					Name: "main",
-					Body: nil,
-				},
-			},
-		},
-		{
-			"Comment",
-			[]Token{
-				{TokenLineComment, "this is a comment", nil},
-			},
-			false,
-			nil,
-		},
-		{
-			"FunctionDefinitionWithComment",
-			[]Token{
-				{TokenFunc, "func", nil},
-				{TokenIdentifier, "main", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenCloseParentheses, ")", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenLineComment, " this is a comment ", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-			false,
-			[]Expr{
-				&FuncDecl{
-					Name: "main",
-					Body: nil,
-				},
-			},
-		},
-		{
-			"UnicodeIdentifier",
-			[]Token{
-				{TokenIdentifier, "únicódeShouldBeVàlid", nil},
-				{TokenDeclaration, ":=", nil},
-				{TokenNumber, "1", nil},
-			},
-			false,
-			[]Expr{
-				&VariableDecl{
-					Name: "únicódeShouldBeVàlid",
-					Value: &LiteralExpr{
-						Typ:   LiteralNumber,
-						Value: "1",
-					},
+// parserCases holds the table used by both the parser tests and as the seed corpus of the parser fuzz target.
+var parserCases = []struct {
+	name   string
+	data   []Token
+	fail   bool
+	expect []Expr
+}{
+	{
+		"FunctionDefinition",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "main",
+				Body: nil,
+			},
+		},
+	},
+	{
+		"Comment",
+		[]Token{
+			{TokenLineComment, "this is a comment", nil},
+		},
+		false,
+		nil,
+	},
+	{
+		"FunctionDefinitionWithComment",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenLineComment, " this is a comment ", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "main",
+				Body: nil,
+			},
+		},
+	},
+	{
+		"ExportedFunction",
+		[]Token{
+			{TokenExport, "export", nil},
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name:     "foo",
+				Exported: true,
+			},
+		},
+	},
+	{
+		"ExportNotFunction",
+		[]Token{
+			{TokenExport, "export", nil},
+			{TokenIdentifier, "x", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"ExternDeclaration",
+		[]Token{
+			{TokenExtern, "extern", nil},
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "puts", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "s", nil},
+			{TokenIdentifier, "string", nil},
+			{TokenComma, ",", nil},
+			{TokenIdentifier, "n", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenIdentifier, "puts", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenString, "foo", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&ExternDecl{
+				Name: "puts",
+				Params: []*Param{
+					{Name: "s", Type: "string"},
+					{Name: "n", Type: "int"},
+				},
+				Returns: []string{"int"},
+			},
+			&FuncCall{
+				Callee: &Identifier{Name: "puts"},
+				Args: []Expr{
+					&LiteralExpr{Typ: LiteralString, Value: "foo"},
 				},
 			},
 		},
-		{
-			"FunctionDefinitionMissingArgs",
-			[]Token{
-				{TokenFunc, "func", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenCloseCurly, "}", nil},
+	},
+	{
+		"ExternWithoutReturn",
+		[]Token{
+			{TokenExtern, "extern", nil},
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "abort", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+		},
+		false,
+		[]Expr{
+			&ExternDecl{
+				Name: "abort",
 			},
-			true,
-			nil,
+			&VariableDecl{
+				Name:  "x",
+				Value: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+			},
+		},
+	},
+	{
+		"ExternMissingParamType",
+		[]Token{
+			{TokenExtern, "extern", nil},
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "puts", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "s", nil},
+			{TokenCloseParentheses, ")", nil},
 		},
-		{
-			"VarString",
-			[]Token{
-				{TokenIdentifier, "varDeclExpr", nil},
-				{TokenDeclaration, ":=", nil},
-				{TokenString, "string", nil},
+		true,
+		nil,
+	},
+	{
+		"Import",
+		[]Token{
+			{TokenImport, "import", nil},
+			{TokenString, "util.mq", nil},
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenIdentifier, "util", nil},
+			{TokenDot, ".", nil},
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "util", nil},
+			{TokenDot, ".", nil},
+			{TokenIdentifier, "bar", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&ImportDecl{
+				Path: "util.mq",
 			},
-			false,
-			[]Expr{
-				&VariableDecl{
-					Name: "varDeclExpr",
-					Value: &LiteralExpr{
-						Typ:   LiteralString,
-						Value: "string",
+			&FuncDecl{
+				Name: "main",
+				Body: []Expr{
+					&FuncCall{
+						Callee: &Identifier{Name: "util.foo"},
+						Args: []Expr{
+							&Identifier{Name: "util.bar"},
+						},
 					},
 				},
 			},
 		},
-		{
-			"FunctionCall",
-			[]Token{
-				{TokenIdentifier, "foo", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenCloseParentheses, ")", nil},
+	},
+	{
+		"ImportWithoutPath",
+		[]Token{
+			{TokenImport, "import", nil},
+			{TokenIdentifier, "util", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"NestedImport",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenImport, "import", nil},
+			{TokenString, "util.mq", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "main",
+				Body: []Expr{
+					&BadExpr{Error: "imports are only allowed at the top level"},
+				},
 			},
-			false,
-			[]Expr{
-				&FuncCall{
-					Name: "foo",
-					Args: nil,
+		},
+	},
+	{
+		"QualifiedWithoutName",
+		[]Token{
+			{TokenIdentifier, "util", nil},
+			{TokenDot, ".", nil},
+			{TokenNumber, "1", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"NamedResult",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "answer", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "result", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenIdentifier, "result", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "42", nil},
+			{TokenReturn, "return", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "answer",
+				Results: []*Param{
+					{Name: "result", Type: "int"},
+				},
+				Body: []Expr{
+					&VariableDecl{
+						Name:  "result",
+						Value: &LiteralExpr{Typ: LiteralNumber, Value: "42"},
+					},
+					&ReturnExpr{},
 				},
 			},
 		},
-		{
-			"FunctionCallWithArgs",
-			[]Token{
-				{TokenIdentifier, "foo", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenString, "arg1", nil},
-				{TokenComma, ",", nil},
-				{TokenNumber, "2", nil},
-				{TokenCloseParentheses, ")", nil},
+	},
+	{
+		"TwoResults",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "a", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"ReturnValue",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "one", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenReturn, "return", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenIdentifier, "x", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "one",
+				Body: []Expr{
+					&ReturnExpr{
+						Value: &BinaryExpr{
+							Operation: BinaryAddition,
+							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+							Op2:       &Identifier{Name: "x"},
+						},
+					},
+				},
 			},
-			false,
-			[]Expr{
-				&FuncCall{
-					Name: "foo",
-					Args: []Expr{
-						&LiteralExpr{Typ: LiteralString, Value: "arg1"},
-						&LiteralExpr{Typ: LiteralNumber, Value: "2"},
+		},
+	},
+	{
+		"ReturnBeforeNewLine",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenReturn, "return", nil},
+			{TokenIdentifier, "println", &Location{NewLine: true}},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "f",
+				Body: []Expr{
+					&ReturnExpr{},
+					&FuncCall{
+						Location: &Location{NewLine: true},
+						Callee:   &Identifier{Location: &Location{NewLine: true}, Name: "println"},
+						Args: []Expr{
+							&LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						},
 					},
 				},
 			},
 		},
-		{
-			"FunctionCallWithExpression",
-			[]Token{
-				{TokenIdentifier, "foo", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "2", nil},
-				{TokenCloseParentheses, ")", nil},
+	},
+	{
+		"ReturnDeclaration",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenReturn, "return", nil},
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "f",
+				Body: []Expr{
+					&BadExpr{Error: "unexpected declaration after return"},
+				},
 			},
-			false,
-			[]Expr{
-				&FuncCall{
-					Name: "foo",
-					Args: []Expr{
-						&BinaryExpr{
-							Operation: BinaryAddition,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+		},
+	},
+	{
+		"ReturnOutsideFunction",
+		[]Token{
+			{TokenReturn, "return", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"Defer",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenDefer, "defer", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "main",
+				Body: []Expr{
+					&DeferExpr{
+						Call: &FuncCall{
+							Callee: &Identifier{Name: "print"},
+							Args: []Expr{
+								&LiteralExpr{Typ: LiteralNumber, Value: "1"},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"DeferOutsideFunction",
+		[]Token{
+			{TokenDefer, "defer", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"NestedDefer",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenIf, "if", nil},
+			{TokenBool, "true", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenDefer, "defer", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "main",
+				Body: []Expr{
+					&IfExpr{
+						Condition: &LiteralExpr{Typ: LiteralBool, Value: "true"},
+						Consequent: []Expr{
+							&BadExpr{Error: "defer must be at the top level of the function body"},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		"DeferInFuncLiteral",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenIdentifier, "main", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenIdentifier, "f", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenFunc, "func", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenDefer, "defer", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenReturn, "return", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&FuncDecl{
+				Name: "main",
+				Body: []Expr{
+					&VariableDecl{
+						Name: "f",
+						Value: &FuncLit{
+							Body: []Expr{
+								&DeferExpr{Call: &FuncCall{Callee: &Identifier{Name: "print"}}},
+								&ReturnExpr{},
+							},
 						},
 					},
 				},
 			},
 		},
-		{
-			"FunctionCallInvalidExpression",
-			[]Token{
-				{TokenIdentifier, "foo", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenNumber, "1", nil},
-				{TokenNumber, "2", nil},
-				{TokenCloseParentheses, ")", nil},
+	},
+	{
+		"BoolVariable",
+		[]Token{
+			{TokenIdentifier, "b", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenBool, "true", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name:  "b",
+				Value: &LiteralExpr{Typ: LiteralBool, Value: "true"},
+			},
+		},
+	},
+	{
+		"UnicodeIdentifier",
+		[]Token{
+			{TokenIdentifier, "únicódeShouldBeVàlid", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name: "únicódeShouldBeVàlid",
+				Value: &LiteralExpr{
+					Typ:   LiteralNumber,
+					Value: "1",
+				},
+			},
+		},
+	},
+	{
+		"FunctionDefinitionMissingArgs",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"VarString",
+		[]Token{
+			{TokenIdentifier, "varDeclExpr", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenString, "string", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name: "varDeclExpr",
+				Value: &LiteralExpr{
+					Typ:   LiteralString,
+					Value: "string",
+				},
+			},
+		},
+	},
+	{
+		"FunctionCall",
+		[]Token{
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&FuncCall{
+				Callee: &Identifier{Name: "foo"},
+				Args:   nil,
+			},
+		},
+	},
+	{
+		"FunctionCallWithArgs",
+		[]Token{
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenString, "arg1", nil},
+			{TokenComma, ",", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&FuncCall{
+				Callee: &Identifier{Name: "foo"},
+				Args: []Expr{
+					&LiteralExpr{Typ: LiteralString, Value: "arg1"},
+					&LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
+			},
+		},
+	},
+	{
+		"FunctionCallWithExpression",
+		[]Token{
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&FuncCall{
+				Callee: &Identifier{Name: "foo"},
+				Args: []Expr{
+					&BinaryExpr{
+						Operation: BinaryAddition,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+					},
+				},
+			},
+		},
+	},
+	{
+		"FunctionCallInvalidExpression",
+		[]Token{
+			{TokenIdentifier, "foo", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"ThreeWaySum",
+		[]Token{
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+			{TokenMulti, "*", nil},
+			{TokenNumber, "3", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinaryAddition,
+				Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				Op2: &BinaryExpr{
+					Operation: BinaryMultiplication,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+				},
 			},
-			true,
-			nil,
 		},
-		{
-			"ThreeWaySum",
-			[]Token{
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "2", nil},
-				{TokenMulti, "*", nil},
-				{TokenNumber, "3", nil},
+	},
+	{
+		"MixedOperators",
+		[]Token{
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenMulti, "*", nil},
+			{TokenNumber, "2", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinaryAddition,
+				Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				Op2: &BinaryExpr{
+					Operation: BinaryMultiplication,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
 			},
-			false,
-			[]Expr{
-				&BinaryExpr{
+		},
+	},
+	{
+		"ParenthesisedExpression",
+		[]Token{
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenMulti, "*", nil},
+			{TokenNumber, "2", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinaryMultiplication,
+				Op1: &BinaryExpr{
 					Operation: BinaryAddition,
 					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-					Op2: &BinaryExpr{
-						Operation: BinaryMultiplication,
-						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+				},
+				Op2: &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+			},
+		},
+	},
+	{
+		"UnaryNegative",
+		[]Token{
+			{TokenMinus, "-", nil},
+			{TokenIdentifier, "x", nil},
+		},
+		false,
+		[]Expr{
+			&UnaryExpr{
+				Operation: UnaryNegative,
+				Operand:   &Identifier{Name: "x"},
+			},
+		},
+	},
+	{
+		"NegativeLiteral",
+		[]Token{
+			{TokenMinus, "-", nil},
+			{TokenNumber, "2", nil},
+		},
+		false,
+		[]Expr{
+			&LiteralExpr{Typ: LiteralNumber, Value: "-2"},
+		},
+	},
+	{
+		"NegativeLiteralMinInt64",
+		[]Token{
+			{TokenMinus, "-", nil},
+			{TokenNumber, "9223372036854775808", nil},
+		},
+		false,
+		[]Expr{
+			&LiteralExpr{Typ: LiteralNumber, Value: "-9223372036854775808"},
+		},
+	},
+	{
+		"LeftAssociativeSubtraction",
+		[]Token{
+			{TokenNumber, "1", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "2", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "3", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinarySubtraction,
+				Op1: &BinaryExpr{
+					Operation: BinarySubtraction,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
+				Op2: &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+			},
+		},
+	},
+	{
+		"LeftAssociativeDivision",
+		[]Token{
+			{TokenNumber, "8", nil},
+			{TokenDiv, "/", nil},
+			{TokenNumber, "4", nil},
+			{TokenMulti, "*", nil},
+			{TokenNumber, "2", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinaryMultiplication,
+				Op1: &BinaryExpr{
+					Operation: BinaryDivision,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "8"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "4"},
+				},
+				Op2: &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+			},
+		},
+	},
+	{
+		"BitwisePrecedence",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenAmpersand, "&", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenPipe, "|", nil},
+			{TokenIdentifier, "c", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+			{TokenShiftLeft, "<<", nil},
+			{TokenNumber, "4", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinaryAddition,
+				Op1: &BinaryExpr{
+					Operation: BinaryOr,
+					Op1: &BinaryExpr{
+						Operation: BinaryAnd,
+						Op1:       &Identifier{Name: "a"},
+						Op2:       &Identifier{Name: "b"},
 					},
+					Op2: &Identifier{Name: "c"},
+				},
+				Op2: &BinaryExpr{
+					Operation: BinaryShiftLeft,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "4"},
 				},
 			},
 		},
-		{
-			"MixedOperators",
-			[]Token{
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenMulti, "*", nil},
-				{TokenNumber, "2", nil},
+	},
+	{
+		"BitwiseNot",
+		[]Token{
+			{TokenTilde, "~", nil},
+			{TokenNumber, "5", nil},
+			{TokenAmpersand, "&", nil},
+			{TokenIdentifier, "x", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Operation: BinaryAnd,
+				Op1: &UnaryExpr{
+					Operation: UnaryBitwiseNot,
+					Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "5"},
+				},
+				Op2: &Identifier{Name: "x"},
 			},
-			false,
-			[]Expr{
-				&BinaryExpr{
+		},
+	},
+	{
+		"Conditional",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenBooleanEquals, "==", nil},
+			{TokenNumber, "1", nil},
+			{TokenQuestion, "?", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+			{TokenColon, ":", nil},
+			{TokenNumber, "3", nil},
+		},
+		false,
+		[]Expr{
+			&ConditionalExpr{
+				Condition: &BooleanExpr{
+					Operation: BooleanEquals,
+					Op1:       &Identifier{Name: "a"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				},
+				Consequent: &BinaryExpr{
 					Operation: BinaryAddition,
 					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-					Op2: &BinaryExpr{
-						Operation: BinaryMultiplication,
-						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
-						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
+				Alternative: &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+			},
+		},
+	},
+	{
+		"NestedConditional",
+		[]Token{
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenIdentifier, "a", nil},
+			{TokenQuestion, "?", nil},
+			{TokenNumber, "1", nil},
+			{TokenColon, ":", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenQuestion, "?", nil},
+			{TokenNumber, "2", nil},
+			{TokenColon, ":", nil},
+			{TokenNumber, "3", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name: "x",
+				Value: &ConditionalExpr{
+					Condition:  &Identifier{Name: "a"},
+					Consequent: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					Alternative: &ConditionalExpr{
+						Condition:   &Identifier{Name: "b"},
+						Consequent:  &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						Alternative: &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+					},
+				},
+			},
+		},
+	},
+	{
+		"ConditionalMissingColon",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenQuestion, "?", nil},
+			{TokenNumber, "1", nil},
+			{TokenNumber, "2", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"BareBlock",
+		[]Token{
+			{TokenOpenCurly, "{", nil},
+			{TokenIdentifier, "x", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenIdentifier, "x", nil},
+		},
+		false,
+		[]Expr{
+			&BlockExpr{
+				Body: []Expr{
+					&VariableDecl{
+						Name:  "x",
+						Value: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
 					},
 				},
 			},
+			&Identifier{Name: "x"},
+		},
+	},
+	{
+		"UnclosedBareBlock",
+		[]Token{
+			{TokenOpenCurly, "{", nil},
+			{TokenIdentifier, "x", nil},
 		},
-		{
-			"ParenthesisedExpression",
-			[]Token{
-				{TokenOpenParentheses, "(", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenCloseParentheses, ")", nil},
-				{TokenMulti, "*", nil},
-				{TokenNumber, "2", nil},
+		false,
+		[]Expr{
+			&BlockExpr{
+				Body: []Expr{
+					&Identifier{Name: "x"},
+					&BadExpr{Error: "unclosed blocks statement"},
+				},
 			},
-			false,
-			[]Expr{
-				&BinaryExpr{
-					Operation: BinaryMultiplication,
-					Op1: &BinaryExpr{
-						Operation: BinaryAddition,
-						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+		},
+	},
+	{
+		"IfElse",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "2", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "3", nil},
+			{TokenNumber, "2", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "1", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "2", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&IfExpr{
+				Condition: &BinaryExpr{
+					Operation: BinaryAddition,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				},
+				Consequent: []Expr{
+					&BinaryExpr{
+						Operation: BinarySubtraction,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
 						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
 					},
-					Op2: &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-				},
-			},
-		},
-		{
-			"UnaryNegative",
-			[]Token{
-				{TokenMinus, "-", nil},
-				{TokenNumber, "2", nil},
-			},
-			false,
-			[]Expr{
-				&UnaryExpr{
-					Operation: UnaryNegative,
-					Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-				},
-			},
-		},
-		{
-			"IfElse",
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "1", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "2", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "3", nil},
-				{TokenNumber, "2", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenCloseCurly, "}", nil},
-				{TokenElse, "else", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "1", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "2", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "2", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-			false,
-			[]Expr{
-				&IfExpr{
-					Condition: &BinaryExpr{
+					&BinaryExpr{
 						Operation: BinaryAddition,
-						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
 					},
-					Consequent: []Expr{
-						&BinaryExpr{
-							Operation: BinarySubtraction,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
-						},
-						&BinaryExpr{
-							Operation: BinaryAddition,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
-						},
+				},
+				Else: []Expr{
+					&BinaryExpr{
+						Operation: BinarySubtraction,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
 					},
-					Else: []Expr{
-						&BinaryExpr{
-							Operation: BinarySubtraction,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-						},
-						&BinaryExpr{
-							Operation: BinaryAddition,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-						},
+					&BinaryExpr{
+						Operation: BinaryAddition,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
 					},
 				},
 			},
 		},
-		{
-			"If",
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "1", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "2", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "3", nil},
-				{TokenNumber, "2", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-			false,
-			[]Expr{
-				&IfExpr{
-					Condition: &BinaryExpr{
-						Operation: BinaryAddition,
-						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-					},
-					Consequent: []Expr{
-						&BinaryExpr{
-							Operation: BinarySubtraction,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
-						},
-						&BinaryExpr{
-							Operation: BinaryAddition,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
-						},
+	},
+	{
+		"If",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "2", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "3", nil},
+			{TokenNumber, "2", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&IfExpr{
+				Condition: &BinaryExpr{
+					Operation: BinaryAddition,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				},
+				Consequent: []Expr{
+					&BinaryExpr{
+						Operation: BinarySubtraction,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
 					},
-					Else: nil,
-				},
-			},
-		},
-		{
-			"IfNoCondition",
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "2", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "3", nil},
-				{TokenNumber, "2", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenCloseCurly, "}", nil},
-				{TokenElse, "else", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "1", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "2", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "2", nil},
-				{TokenCloseCurly, "}", nil},
-			},
-			true,
-			nil,
-		},
-		{
-			"IfNoBody",
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "1", nil},
-			},
-			true,
-			nil,
-		},
-		{
-			"IfWithExprAfterwards",
-			[]Token{
-				{TokenIf, "if", nil},
-				{TokenNumber, "1", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "1", nil},
-				{TokenOpenCurly, "{", nil},
-				{TokenNumber, "2", nil},
-				{TokenMinus, "-", nil},
-				{TokenNumber, "3", nil},
-				{TokenNumber, "2", nil},
-				{TokenPlus, "+", nil},
-				{TokenNumber, "3", nil},
-				{TokenCloseCurly, "}", nil},
-				{TokenIdentifier, "print", nil},
-				{TokenOpenParentheses, "(", nil},
-				{TokenNumber, "1", nil},
-				{TokenCloseParentheses, ")", nil},
-			},
-			false,
-			[]Expr{
-				&IfExpr{
-					Condition: &BinaryExpr{
+					&BinaryExpr{
 						Operation: BinaryAddition,
-						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
-						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
 					},
-					Consequent: []Expr{
-						&BinaryExpr{
-							Operation: BinarySubtraction,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
-						},
-						&BinaryExpr{
-							Operation: BinaryAddition,
-							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
-							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+				},
+				Else: nil,
+			},
+		},
+	},
+	{
+		"ElseIfChain",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenIdentifier, "a", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenIf, "if", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenIf, "if", nil},
+			{TokenIdentifier, "c", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "4", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&IfExpr{
+				Condition:  &Identifier{Name: "a"},
+				Consequent: []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "1"}},
+				Else: []Expr{
+					&IfExpr{
+						Condition:  &Identifier{Name: "b"},
+						Consequent: []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "2"}},
+						Else: []Expr{
+							&IfExpr{
+								Condition:  &Identifier{Name: "c"},
+								Consequent: []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "3"}},
+								Else:       []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "4"}},
+							},
 						},
 					},
-					Else: nil,
-				},
-				&FuncCall{
-					Name: "print",
-					Args: []Expr{
-						&LiteralExpr{
-							Typ:   LiteralNumber,
-							Value: "1",
-						},
+				},
+			},
+		},
+	},
+	{
+		"ElseIfNoBody",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenIdentifier, "a", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenIf, "if", nil},
+			{TokenIdentifier, "b", nil},
+		},
+		false,
+		[]Expr{
+			&IfExpr{
+				Condition: &Identifier{Name: "a"},
+				Else:      []Expr{&BadExpr{Error: "expected a code blocks after if statement"}},
+			},
+		},
+	},
+	{
+		"FuncLiteral",
+		[]Token{
+			{TokenIdentifier, "f", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenFunc, "func", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name: "f",
+				Value: &FuncLit{
+					Body: []Expr{
+						&FuncCall{Callee: &Identifier{Name: "print"}, Args: []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "1"}}},
 					},
 				},
 			},
+			&FuncCall{Callee: &Identifier{Name: "f"}},
 		},
-		{
-			"SimpleEquals",
-			[]Token{
-				{TokenNumber, "1", nil},
-				{TokenBooleanEquals, "==", nil},
-				{TokenNumber, "1", nil},
+	},
+	{
+		"FuncLiteralResults",
+		[]Token{
+			{TokenIdentifier, "f", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenFunc, "func", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenIdentifier, "r", nil},
+			{TokenIdentifier, "int", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name: "f",
+				Value: &FuncLit{
+					Results: []*Param{{Name: "r", Type: "int"}},
+				},
 			},
-			false,
-			[]Expr{
-				&BooleanExpr{
-					Operation: BooleanEquals,
+		},
+	},
+	{
+		"ChainedCallOperand",
+		[]Token{
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+		},
+		false,
+		[]Expr{
+			&BinaryExpr{
+				Op1: &FuncCall{
+					Callee: &FuncCall{Callee: &Identifier{Name: "f"}},
+					Args:   []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "1"}},
+				},
+				Operation: BinaryAddition,
+				Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+			},
+		},
+	},
+	{
+		"TrailingComma",
+		[]Token{
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenComma, ",", nil},
+			{TokenNumber, "2", nil},
+			{TokenComma, ",", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&FuncCall{
+				Callee: &Identifier{Name: "f"},
+				Args: []Expr{
+					&LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					&LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
+			},
+		},
+	},
+	{
+		"MissingArgument",
+		[]Token{
+			{TokenIdentifier, "f", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenComma, ",", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&FuncCall{
+				Callee: &Identifier{Name: "f"},
+				Args: []Expr{
+					&BadExpr{Error: "expected an argument before ','"},
+				},
+			},
+		},
+	},
+	{
+		"CalledFuncLiteral",
+		[]Token{
+			{TokenFunc, "func", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&FuncCall{Callee: &FuncLit{}},
+		},
+	},
+	{
+		"FuncLiteralNoParentheses",
+		[]Token{
+			{TokenIdentifier, "f", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenFunc, "func", nil},
+		},
+		false,
+		[]Expr{
+			&VariableDecl{
+				Name:  "f",
+				Value: &BadExpr{Error: "bad function literal"},
+			},
+		},
+	},
+	{
+		"IfNoCondition",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "2", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "3", nil},
+			{TokenNumber, "2", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenElse, "else", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "1", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "2", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+			{TokenCloseCurly, "}", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"IfNoBody",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"IfWithExprAfterwards",
+		[]Token{
+			{TokenIf, "if", nil},
+			{TokenNumber, "1", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "1", nil},
+			{TokenOpenCurly, "{", nil},
+			{TokenNumber, "2", nil},
+			{TokenMinus, "-", nil},
+			{TokenNumber, "3", nil},
+			{TokenNumber, "2", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "3", nil},
+			{TokenCloseCurly, "}", nil},
+			{TokenIdentifier, "print", nil},
+			{TokenOpenParentheses, "(", nil},
+			{TokenNumber, "1", nil},
+			{TokenCloseParentheses, ")", nil},
+		},
+		false,
+		[]Expr{
+			&IfExpr{
+				Condition: &BinaryExpr{
+					Operation: BinaryAddition,
 					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
 					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
 				},
+				Consequent: []Expr{
+					&BinaryExpr{
+						Operation: BinarySubtraction,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+					},
+					&BinaryExpr{
+						Operation: BinaryAddition,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "3"},
+					},
+				},
+				Else: nil,
+			},
+			&FuncCall{
+				Callee: &Identifier{Name: "print"},
+				Args: []Expr{
+					&LiteralExpr{
+						Typ:   LiteralNumber,
+						Value: "1",
+					},
+				},
 			},
 		},
-	}
+	},
+	{
+		"SimpleEquals",
+		[]Token{
+			{TokenNumber, "1", nil},
+			{TokenBooleanEquals, "==", nil},
+			{TokenNumber, "1", nil},
+		},
+		false,
+		[]Expr{
+			&BooleanExpr{
+				Operation: BooleanEquals,
+				Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+			},
+		},
+	},
+	{
+		"MultiVariableDecl",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenComma, ",", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+			{TokenComma, ",", nil},
+			{TokenIdentifier, "x", nil},
+			{TokenPlus, "+", nil},
+			{TokenNumber, "2", nil},
+		},
+		false,
+		[]Expr{
+			&MultiVariableDecl{
+				Names: []string{"a", "b"},
+				Values: []Expr{
+					&LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					&BinaryExpr{
+						Operation: BinaryAddition,
+						Op1:       &Identifier{Name: "x"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+					},
+				},
+			},
+		},
+	},
+	{
+		// The count is checked by the semantic analysis
+		"MultiVariableDeclCountMismatch",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenComma, ",", nil},
+			{TokenIdentifier, "b", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+		},
+		false,
+		[]Expr{
+			&MultiVariableDecl{
+				Names:  []string{"a", "b"},
+				Values: []Expr{&LiteralExpr{Typ: LiteralNumber, Value: "1"}},
+			},
+		},
+	},
+	{
+		"MultiVariableDeclMissingName",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenComma, ",", nil},
+			{TokenDeclaration, ":=", nil},
+			{TokenNumber, "1", nil},
+		},
+		true,
+		nil,
+	},
+	{
+		"MultiVariableDeclMissingDeclaration",
+		[]Token{
+			{TokenIdentifier, "a", nil},
+			{TokenComma, ",", nil},
+			{TokenIdentifier, "b", nil},
+		},
+		true,
+		nil,
+	},
+}
 
-	for _, c := range cases {
+func TestParser(t *testing.T) {
+	for _, c := range parserCases {
 		t.Run(c.name, func(t *testing.T) {
 			tokenizer := NewLexerMocker(c.data)
 			p := NewParser(tokenizer)
@@ -504,6 +1482,17 @@ func TestParser(t *testing.T) {
 			got := p.Run()
 			expect := &AST{Filename: p.GetFilename()}
 
+			// The parsed values of the numbers are checked by TestParserNumbers
+			for _, stmt := range got.Statements {
+				Inspect(stmt, func(expr Expr) bool {
+					if lit, isLiteral := expr.(*LiteralExpr); isLiteral {
+						lit.Number = nil
+					}
+
+					return true
+				})
+			}
+
 			for _, e := range c.expect {
 				expect.Statements = append(expect.Statements, &AnnotatedExpr{
 					Expr: e,
@@ -530,3 +1519,523 @@ func TestParser(t *testing.T) {
 		})
 	}
 }
+
+func TestParserInterpolation(t *testing.T) {
+	ast := NewParser(NewLexerFromReader(strings.NewReader("s := \"x is ${x + 1}!\""))).Run()
+
+	// The interpolated expression is located inside the file
+	bin := ast.Statements[0].Expr.(*VariableDecl).Value.(*InterpolatedString).Parts[1]
+	assert.Equal(t, uint64(17), bin.(*BinaryExpr).Op2.(*LiteralExpr).Location.End-1)
+
+	assert.Equal(t, []Expr{
+		&VariableDecl{
+			Name: "s",
+			Value: &InterpolatedString{
+				Parts: []Expr{
+					&LiteralExpr{Typ: LiteralString, Value: "x is "},
+					&BinaryExpr{
+						Operation: BinaryAddition,
+						Op1:       &Identifier{Name: "x"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1", Number: int64(1)},
+					},
+					&LiteralExpr{Typ: LiteralString, Value: "!"},
+				},
+			},
+		},
+	}, stripLocations(ast))
+
+	// The escape sequences of the text are replaced, and an escaped interpolation is part of the text
+	ast = NewParser(NewLexerFromReader(strings.NewReader(`"\"${x}\" \${y}"`))).Run()
+	assert.Equal(t, []Expr{
+		&InterpolatedString{
+			Parts: []Expr{
+				&LiteralExpr{Typ: LiteralString, Value: `"`},
+				&Identifier{Name: "x"},
+				&LiteralExpr{Typ: LiteralString, Value: `" ${y}`},
+			},
+		},
+	}, stripLocations(ast))
+
+	for _, src := range []string{`"${}"`, `"${x := 1}"`, `"${1 +}"`, `"${@}"`} {
+		ast := NewParser(NewLexerFromReader(strings.NewReader(src))).Run()
+		assert.IsType(t, &BadExpr{}, ast.Statements[0].Expr, src)
+	}
+}
+
+func TestParserNumbers(t *testing.T) {
+	cases := []struct {
+		name   string
+		value  string
+		expect any
+		err    string
+	}{
+		{"Integer", "42", int64(42), ""},
+		{"Float", "2.50", 2.5, ""},
+		{"MaxInt64", "9223372036854775807", int64(9223372036854775807), ""},
+		{"Overflow", "9223372036854775808", nil, "number out of range: 9223372036854775808"},
+		{"Malformed", "1.2.3", nil, "invalid number: 1.2.3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast := NewParser(NewLexerMocker([]Token{{TokenNumber, c.value, nil}})).Run()
+			if !assert.Len(t, ast.Statements, 1) {
+				return
+			}
+
+			if c.err != "" {
+				assert.Equal(t, &BadExpr{Error: c.err}, ast.Statements[0].Expr)
+				return
+			}
+
+			assert.Equal(t, &LiteralExpr{Typ: LiteralNumber, Value: c.value, Number: c.expect}, ast.Statements[0].Expr)
+		})
+	}
+}
+
+func TestParserNestingDepth(t *testing.T) {
+	cases := []struct {
+		name   string
+		tok    Token
+		expect string
+	}{
+		{"Parentheses", Token{TokenOpenParentheses, "(", nil}, "expression too deeply nested"},
+		{"Blocks", Token{TokenOpenCurly, "{", nil}, "blocks statement too deeply nested"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			toks := make([]Token, 100000)
+			for i := range toks {
+				toks[i] = c.tok
+			}
+
+			ast := NewParser(NewLexerMocker(toks)).Run()
+
+			var bad *BadExpr
+			Inspect(ast.Statements[0], func(expr Expr) bool {
+				if e, isBad := expr.(*BadExpr); isBad && bad == nil {
+					bad = e
+				}
+
+				return bad == nil
+			})
+
+			if assert.NotNil(t, bad) {
+				assert.Equal(t, c.expect, bad.Error)
+			}
+		})
+	}
+}
+
+func TestParserRunContext(t *testing.T) {
+	src := "a := 1\nb := 2\nc := 3"
+
+	cases := []struct {
+		name   string
+		limit  int
+		cancel bool
+		expect []string
+		err    error
+	}{
+		{"NoLimit", 0, false, []string{"a", "b", "c"}, nil},
+		{"Limit", 2, false, []string{"a", "b"}, ErrStatementLimit},
+		{"LimitAtEnd", 3, false, []string{"a", "b", "c"}, nil},
+		{"Cancelled", 0, true, nil, context.Canceled},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if c.cancel {
+				cancel()
+			}
+
+			p := NewParser(NewLexerFromReader(strings.NewReader(src)))
+			p.SetStatementLimit(c.limit)
+
+			ast, err := p.RunContext(ctx)
+			assert.Equal(t, c.err, err)
+
+			var names []string
+			for _, stmt := range ast.Statements {
+				names = append(names, stmt.Expr.(*VariableDecl).Name)
+			}
+
+			assert.Equal(t, c.expect, names)
+		})
+	}
+}
+
+func TestParserErrorLocations(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+		start  uint64
+		end    uint64
+	}{
+		{"UnclosedBody", "func main() {\nx := 1", "unclosed blocks statement", 12, 13},
+		{"UnclosedNestedBlock", "func main() {\nif true {\nx := 1\n}", "unclosed blocks statement", 12, 13},
+		{"MissingBody", "func main() x", "invalid blocks statement", 12, 13},
+		{"MissingName", "func 1() {}", "expected function name", 5, 6},
+		{"MissingParentheses", "func main {}", "bad function declaration", 10, 11},
+		{"UnclosedParameters", "func main( {}", "bad function declaration", 9, 12},
+		{"BadResult", "func f() (r 1) {}", "bad result in function declaration", 9, 13},
+		{"SecondResult", "func f() (a int b int) {}", "functions can only have one result", 9, 17},
+		{"UnclosedLiteralParameters", "x := func(1", "bad function literal", 9, 11},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast := NewParser(NewLexerFromReader(strings.NewReader(c.src))).Run()
+
+			var bad *BadExpr
+			for _, stmt := range ast.Statements {
+				Inspect(stmt.Expr, func(expr Expr) bool {
+					if e, isBad := expr.(*BadExpr); isBad && bad == nil {
+						bad = e
+					}
+
+					return bad == nil
+				})
+			}
+
+			if assert.NotNil(t, bad) {
+				assert.Equal(t, c.expect, bad.Error)
+				assert.Equal(t, &Location{Start: c.start, End: c.end}, bad.Location)
+			}
+		})
+	}
+}
+
+// endlessStream is a tokenizer that never sends the end of the file. Once its tokens are over, it keeps returning the
+// zero Token, like a closed channel would.
+type endlessStream struct {
+	toks []Token
+}
+
+func (s *endlessStream) Do() {}
+
+func (s *endlessStream) Get() Token {
+	if len(s.toks) == 0 {
+		return Token{}
+	}
+
+	tok := s.toks[0]
+	s.toks = s.toks[1:]
+
+	return tok
+}
+
+func (s *endlessStream) GetFilename() string {
+	return "testing"
+}
+
+func TestParserTerminates(t *testing.T) {
+	cases := []struct {
+		name       string
+		toks       []Token
+		statements int
+	}{
+		{"Empty", nil, 0},
+		{"NoEOF", []Token{{TokenIdentifier, "x", nil}, {TokenDeclaration, ":=", nil}, {TokenNumber, "1", nil}}, 1},
+		{"ErrorInsideBlock", []Token{{TokenFunc, "func", nil}, {TokenIdentifier, "main", nil}, {TokenOpenParentheses, "(", nil},
+			{TokenCloseParentheses, ")", nil}, {TokenOpenCurly, "{", nil}, {TokenError, "invalid symbol '@'", nil}}, 1},
+		{"ErrorAfterStatement", []Token{{TokenNumber, "1", nil}, {TokenError, "invalid symbol '@'", nil},
+			{TokenNumber, "2", nil}}, 2},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			done := make(chan *AST)
+			go func() {
+				done <- NewParser(&endlessStream{toks: c.toks}).Run()
+			}()
+
+			select {
+			case ast := <-done:
+				assert.Len(t, ast.Statements, c.statements)
+			case <-time.After(5 * time.Second):
+				t.Fatal("parser did not terminate")
+			}
+
+			// The asynchronous parser ends its stream too
+			p := NewParser(&endlessStream{toks: c.toks})
+			go p.Do()
+
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case expr := <-p.Chan():
+					if _, isEOS := expr.(*EOS); !isEOS {
+						continue
+					}
+				case <-timeout:
+					t.Fatal("asynchronous parser did not terminate")
+				}
+
+				break
+			}
+		})
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	one := &LiteralExpr{Typ: LiteralNumber, Value: "1"}
+	tree := &VariableDecl{
+		Name: "x",
+		Value: &BinaryExpr{
+			Operation: BinaryAddition,
+			Op1:       one,
+			Op2: &UnaryExpr{
+				Operation: UnaryNegative,
+				Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+			},
+		},
+	}
+
+	got := Rewrite(tree, func(expr Expr) Expr {
+		if lit, ok := expr.(*LiteralExpr); ok && lit.Value == "1" {
+			return &LiteralExpr{Typ: LiteralNumber, Value: "2"}
+		}
+
+		return expr
+	})
+
+	assert.Equal(t, &VariableDecl{
+		Name: "x",
+		Value: &BinaryExpr{
+			Operation: BinaryAddition,
+			Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+			Op2: &UnaryExpr{
+				Operation: UnaryNegative,
+				Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+			},
+		},
+	}, got)
+
+	// The original tree is left untouched
+	assert.Equal(t, "1", one.Value)
+	assert.Same(t, one, tree.Value.(*BinaryExpr).Op1)
+
+	// Parents receive their already rewritten children
+	var sum *BinaryExpr
+	Rewrite(tree, func(expr Expr) Expr {
+		if e, ok := expr.(*BinaryExpr); ok {
+			sum = e
+		}
+
+		if lit, ok := expr.(*LiteralExpr); ok {
+			return &LiteralExpr{Typ: lit.Typ, Value: lit.Value + "0"}
+		}
+
+		return expr
+	})
+
+	if assert.NotNil(t, sum) {
+		assert.Equal(t, "10", sum.Op1.(*LiteralExpr).Value)
+	}
+}
+
+func TestParserPreserveComments(t *testing.T) {
+	toks := []Token{
+		{TokenLineComment, " first", nil},
+		{TokenFunc, "func", nil},
+		{TokenIdentifier, "main", nil},
+		{TokenOpenParentheses, "(", nil},
+		{TokenCloseParentheses, ")", nil},
+		{TokenOpenCurly, "{", nil},
+		{TokenIdentifier, "x", nil},
+		{TokenDeclaration, ":=", nil},
+		{TokenNumber, "1", nil},
+		{TokenLineComment, " second", nil},
+		{TokenCloseCurly, "}", nil},
+		{TokenLineComment, " third", nil},
+	}
+
+	p := NewParser(NewLexerMocker(toks))
+	p.PreserveComments(true)
+
+	assert.Equal(t, []*AnnotatedExpr{
+		{Expr: &CommentExpr{Text: " first"}},
+		{Expr: &FuncDecl{
+			Name: "main",
+			Body: []Expr{
+				&VariableDecl{
+					Name:  "x",
+					Value: &LiteralExpr{Typ: LiteralNumber, Value: "1", Number: int64(1)},
+				},
+				&CommentExpr{Text: " second"},
+			},
+		}},
+		{Expr: &CommentExpr{Text: " third"}},
+	}, p.Run().Statements)
+
+	// Comments are discarded by default
+	ast := NewParser(NewLexerMocker(toks)).Run()
+	if assert.Len(t, ast.Statements, 1) {
+		assert.IsType(t, &FuncDecl{}, ast.Statements[0].Expr)
+	}
+}
+
+// fuzzTokens is the alphabet used by the parser fuzz target. Every fuzzed byte is mapped to one of these tokens.
+var fuzzTokens = []Token{
+	{TokenError, "error", nil},
+	{TokenEOF, "", nil},
+	{TokenNumber, "1", nil},
+	{TokenString, "string", nil},
+	{TokenBool, "true", nil},
+	{TokenIdentifier, "foo", nil},
+	{TokenFunc, "func", nil},
+	{TokenPlus, "+", nil},
+	{TokenMinus, "-", nil},
+	{TokenMulti, "*", nil},
+	{TokenDiv, "/", nil},
+	{TokenDeclaration, ":=", nil},
+	{TokenLineComment, "comment", nil},
+	{TokenOpenParentheses, "(", nil},
+	{TokenCloseParentheses, ")", nil},
+	{TokenOpenCurly, "{", nil},
+	{TokenCloseCurly, "}", nil},
+	{TokenComma, ",", nil},
+	{TokenIf, "if", nil},
+	{TokenElse, "else", nil},
+	{TokenExport, "export", nil},
+	{TokenExtern, "extern", nil},
+	{TokenBooleanEquals, "==", nil},
+	{TokenQuestion, "?", nil},
+	{TokenColon, ":", nil},
+	{TokenInterpolatedString, "foo ${foo}", nil},
+	{TokenAmpersand, "&", nil},
+	{TokenPipe, "|", nil},
+	{TokenCaret, "^", nil},
+	{TokenShiftLeft, "<<", nil},
+	{TokenShiftRight, ">>", nil},
+	{TokenTilde, "~", nil},
+	{TokenImport, "import", nil},
+	{TokenDot, ".", nil},
+	{TokenReturn, "return", nil},
+	{TokenDefer, "defer", nil},
+}
+
+// encodeFuzzTokens maps a token slice into the byte representation understood by the parser fuzz target.
+func encodeFuzzTokens(toks []Token) []byte {
+	var data []byte
+	for _, tok := range toks {
+		for i, fuzzTok := range fuzzTokens {
+			if fuzzTok.Typ == tok.Typ {
+				data = append(data, byte(i))
+				break
+			}
+		}
+	}
+
+	return data
+}
+
+// decodeFuzzTokens maps fuzzed bytes into a token slice drawn from fuzzTokens.
+func decodeFuzzTokens(data []byte) []Token {
+	toks := make([]Token, len(data))
+	for i, b := range data {
+		toks[i] = fuzzTokens[int(b)%len(fuzzTokens)]
+	}
+
+	return toks
+}
+
+// assertWellFormed walks an expression tree and asserts no node is missing and no end-of-stream marker leaked into it.
+func assertWellFormed(t *testing.T, expr Expr) {
+	if !assert.NotNil(t, expr) {
+		return
+	}
+
+	switch e := expr.(type) {
+	case *EOS:
+		assert.Fail(t, "unexpected end-of-stream inside the AST")
+	case *FuncDecl:
+		for _, child := range e.Body {
+			assertWellFormed(t, child)
+		}
+	case *VariableDecl:
+		assertWellFormed(t, e.Value)
+	case *FuncCall:
+		for _, arg := range e.Args {
+			assertWellFormed(t, arg)
+		}
+	case *BinaryExpr:
+		assertWellFormed(t, e.Op1)
+		assertWellFormed(t, e.Op2)
+	case *BooleanExpr:
+		assertWellFormed(t, e.Op1)
+		assertWellFormed(t, e.Op2)
+	case *UnaryExpr:
+		assertWellFormed(t, e.Operand)
+	case *IfExpr:
+		assertWellFormed(t, e.Condition)
+		for _, child := range e.Consequent {
+			assertWellFormed(t, child)
+		}
+
+		for _, child := range e.Else {
+			assertWellFormed(t, child)
+		}
+	}
+}
+
+func FuzzParser(f *testing.F) {
+	for _, c := range parserCases {
+		f.Add(encodeFuzzTokens(c.data))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		done := make(chan *AST)
+		go func() {
+			done <- NewParser(NewLexerMocker(decodeFuzzTokens(data))).Run()
+		}()
+
+		select {
+		case ast := <-done:
+			for _, stmt := range ast.Statements {
+				assertWellFormed(t, stmt.Expr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("parser did not terminate for tokens %v", decodeFuzzTokens(data))
+		}
+	})
+}
+
+// Use a package-level variable to avoid compiler optimisation
+var benchAST *AST
+
+func benchmarkParser(size int, b *testing.B) {
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		// Setup
+		b.StopTimer()
+		data := test.GetRandomTokens(size)
+		p := NewParser(NewLexerFromReader(strings.NewReader(data)))
+		b.StartTimer()
+
+		benchAST = p.Run()
+	}
+}
+
+func BenchmarkParser100(b *testing.B) {
+	benchmarkParser(100, b)
+}
+
+func BenchmarkParser1000(b *testing.B) {
+	benchmarkParser(1000, b)
+}
+
+func BenchmarkParser10000(b *testing.B) {
+	benchmarkParser(10000, b)
+}
+
+func BenchmarkParser100000(b *testing.B) {
+	benchmarkParser(100000, b)
+}
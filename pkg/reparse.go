@@ -0,0 +1,296 @@
+package maqui
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"unicode"
+)
+
+// IncrementalParser parses a file keeping track of where each top-level statement starts, so after an edit only the
+// statements around it are lexed and parsed again, instead of the whole file. It's meant for editors, which parse the
+// file on every change. The statements after the edit are kept, with their locations moved to match the new source.
+type IncrementalParser struct {
+	// filename is the name of the parsed file
+	filename string
+	// src holds the current source of the file
+	src []byte
+	// stmts holds the top-level statements of the file, in source order
+	stmts []*parsedStatement
+}
+
+// parsedStatement is a top-level statement kept by the IncrementalParser.
+type parsedStatement struct {
+	// expr is the parsed statement
+	expr Expr
+	// start is the offset of the first token of the statement, including the comments right before it. The statement
+	// spans up to the start of the next one.
+	start uint64
+	// first is the offset of the first token of the statement that is not a comment
+	first uint64
+	// ignores holds the ignore directives bound to the statement
+	ignores []*IgnoreDirective
+}
+
+// NewIncrementalParser creates an IncrementalParser and parses the whole source of the file.
+func NewIncrementalParser(filename string, src []byte) *IncrementalParser {
+	p := &IncrementalParser{
+		filename: filename,
+		src:      src,
+	}
+
+	p.stmts = p.parse(0, uint64(len(src)), uint64(len(src)))
+	return p
+}
+
+// AST returns the syntax tree of the current source. Like the one returned by [Parser.Run], it holds no types.
+func (p *IncrementalParser) AST() *AST {
+	ast := &AST{
+		Filename: p.filename,
+	}
+
+	for _, stmt := range p.stmts {
+		ast.Statements = append(ast.Statements, &AnnotatedExpr{
+			Expr: stmt.expr,
+		})
+
+		ast.Ignores = append(ast.Ignores, stmt.ignores...)
+	}
+
+	return ast
+}
+
+// Edit replaces the bytes between start and end of the source with text, and parses again the top-level statements
+// spanning over the edited bytes, along with the ones right before and after them. If the edit moves the bounds of the
+// statements that follow, like by removing the closing brace of a function, the whole file is parsed again instead. An
+// error is returned if the range is out of the source.
+func (p *IncrementalParser) Edit(start, end uint64, text []byte) error {
+	if start > end || end > uint64(len(p.src)) {
+		return fmt.Errorf("edit [%d:%d] is out of the source, which is %d bytes long", start, end, len(p.src))
+	}
+
+	src := make([]byte, 0, uint64(len(p.src))-(end-start)+uint64(len(text)))
+	src = append(src, p.src[:start]...)
+	src = append(src, text...)
+	src = append(src, p.src[end:]...)
+
+	delta := int64(len(text)) - int64(end-start)
+	p.src = src
+
+	// The edited statements are the one the edit starts in, up to the one it ends in. An edit that ends right where a
+	// statement starts is included too, since it can join the tokens around it.
+	first := 0
+	for first+1 < len(p.stmts) && p.stmts[first+1].start <= start {
+		first++
+	}
+
+	next := first + 1
+	for next < len(p.stmts) && p.stmts[next].start <= end {
+		next++
+	}
+
+	// The parser looks one token ahead, so the statement before the edited ones might now end differently. The ignore
+	// directives found inside a statement are bound to the one after it, so that one can't be parsed on its own.
+	if first > 0 {
+		first--
+	}
+
+	for first > 0 && p.stmts[first].hasOuterIgnores() {
+		first--
+	}
+
+	for next < len(p.stmts) && p.stmts[next].hasOuterIgnores() {
+		next++
+	}
+
+	regionStart := uint64(0)
+	if first != 0 {
+		// The region of the first statement starts at the beginning of the source, so the header is lexed too
+		regionStart = p.stmts[first].start
+	}
+
+	if next == len(p.stmts) {
+		stmts := p.parse(regionStart, uint64(len(src)), uint64(len(src)))
+		p.stmts = append(p.stmts[:first:first], p.reuse(first, stmts)...)
+		return nil
+	}
+
+	// The statement after the edited ones is parsed too, to check they still end where it starts. It's kept as it was,
+	// since it's parsed the same as long as it starts at the same token.
+	kept := p.stmts[next]
+	kept.shift(delta)
+
+	regionEnd, follow := uint64(len(src)), uint64(len(src))
+	if next+1 < len(p.stmts) {
+		regionEnd = uint64(int64(p.stmts[next+1].start) + delta)
+		follow = uint64(int64(p.stmts[next+1].first) + delta)
+	}
+
+	stmts := p.parse(regionStart, regionEnd, follow)
+
+	bound := -1
+	for i, stmt := range stmts {
+		if stmt.start == kept.start && stmt.first == kept.first && !stmt.hasOuterIgnores() {
+			bound = i
+			break
+		}
+	}
+
+	if bound == -1 {
+		p.stmts = p.parse(0, uint64(len(src)), uint64(len(src)))
+		return nil
+	}
+
+	for _, stmt := range p.stmts[next+1:] {
+		stmt.shift(delta)
+	}
+
+	// The kept statements are copied into a new slice, so the old one isn't overwritten while reading from it
+	p.stmts = append(append(p.stmts[:first:first], p.reuse(first, stmts[:bound])...), p.stmts[next:]...)
+
+	return nil
+}
+
+// reuse replaces the first of the statements parsed again by the old one at the index, if they are the same. The
+// statement before the edited ones is only parsed again to find where it ends, so it's usually unchanged.
+func (p *IncrementalParser) reuse(index int, stmts []*parsedStatement) []*parsedStatement {
+	if len(stmts) == 0 {
+		return stmts
+	}
+
+	old, stmt := p.stmts[index], stmts[0]
+	if old.start == stmt.start && old.first == stmt.first && reflect.DeepEqual(old.expr, stmt.expr) &&
+		reflect.DeepEqual(old.ignores, stmt.ignores) {
+		stmts[0] = old
+	}
+
+	return stmts
+}
+
+// parse lexes and parses the top-level statements between the start and end offsets of the source. The end of the region
+// is reported at the follow offset, where the token after it starts, unless it's the end of the source.
+func (p *IncrementalParser) parse(start, end, follow uint64) []*parsedStatement {
+	l := NewLexerFromBytes(p.src[start:end])
+	l.filename = p.filename
+	l.newLine = precededByNewLine(p.src[:start])
+	go l.Do()
+
+	var toks []Token
+	for tok := range l.Chan() {
+		switch {
+		case tok.Typ == TokenEOF && end != uint64(len(p.src)):
+			tok.Loc = &Location{
+				Start: follow,
+				End:   follow,
+				File:  p.filename,
+			}
+		case tok.Loc != nil:
+			tok.Loc.Start += start
+			tok.Loc.End += start
+		}
+
+		toks = append(toks, tok)
+	}
+
+	parser := NewParser(NewTokenStream(p.filename, toks))
+
+	var stmts []*parsedStatement
+	i := 0
+	for parser.peek().Typ != TokenEOF {
+		// The comments right before the statement belong to it, since its ignore directives are bound to it
+		first := parser.peek().Loc
+		for toks[i].Loc != first {
+			i++
+		}
+
+		begin := i
+		for begin > 0 && toks[begin-1].isComment() {
+			begin--
+		}
+
+		stmt := &parsedStatement{
+			start: toks[begin].Loc.Start,
+			first: first.Start,
+		}
+
+		bound := len(parser.ignores)
+		stmt.expr = parser.statement()
+		stmt.ignores = parser.ignores[bound:]
+
+		stmts = append(stmts, stmt)
+	}
+
+	return stmts
+}
+
+// precededByNewLine returns true if the source ends in a new-line, ignoring the whitespace after it. A region lexed on
+// its own starts with the tokens that follow it, which are on a new line as if the whole source was lexed.
+func precededByNewLine(src []byte) bool {
+	for i := len(src) - 1; i >= 0 && unicode.IsSpace(rune(src[i])); i-- {
+		if src[i] == '\n' {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasOuterIgnores returns true if an ignore directive bound to the statement comes from a comment before its start,
+// inside the previous statement
+func (s *parsedStatement) hasOuterIgnores() bool {
+	for _, d := range s.ignores {
+		if d.Location.Start < s.start {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shift moves the statement, and all the locations inside it, by delta bytes
+func (s *parsedStatement) shift(delta int64) {
+	moved := make(map[*Location]bool)
+	move := func(loc *Location) {
+		if loc == nil || moved[loc] {
+			return
+		}
+
+		moved[loc] = true
+		loc.Start = uint64(int64(loc.Start) + delta)
+		loc.End = uint64(int64(loc.End) + delta)
+	}
+
+	Inspect(s.expr, func(expr Expr) bool {
+		move(expr.GetLocation())
+
+		// The parameters are not expressions, so they are not inspected
+		switch e := expr.(type) {
+		case *FuncDecl:
+			for _, result := range e.Results {
+				move(result.Location)
+			}
+		case *FuncLit:
+			for _, result := range e.Results {
+				move(result.Location)
+			}
+		case *ExternDecl:
+			for _, param := range e.Params {
+				move(param.Location)
+			}
+		}
+
+		return true
+	})
+
+	for _, d := range s.ignores {
+		move(d.Location)
+
+		d.Start = uint64(int64(d.Start) + delta)
+		if d.End != math.MaxUint64 {
+			d.End = uint64(int64(d.End) + delta)
+		}
+	}
+
+	s.start = uint64(int64(s.start) + delta)
+	s.first = uint64(int64(s.first) + delta)
+}
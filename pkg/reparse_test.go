@@ -0,0 +1,72 @@
+package maqui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseSource(src string) *AST {
+	l := NewLexerFromBytes([]byte(src))
+	l.filename = "main.mq"
+
+	return NewParser(l).Run()
+}
+
+func TestIncrementalParser(t *testing.T) {
+	src := "func a() {\nx := 1\n}\n\n// maqui:ignore unused\nfunc b() {\ny := 2\n}\n\nfunc c() {\nprint(3)\n}\n"
+
+	p := NewIncrementalParser("main.mq", []byte(src))
+	before := p.AST()
+	assert.Equal(t, parseSource(src), before)
+
+	// Only the statement holding the edit is parsed again
+	start := uint64(strings.Index(src, "2"))
+	assert.NoError(t, p.Edit(start, start+1, []byte("20 + 2")))
+
+	src = src[:start] + "20 + 2" + src[start+1:]
+
+	after := p.AST()
+	assert.Equal(t, parseSource(src), after)
+
+	assert.Same(t, before.Statements[0].Expr, after.Statements[0].Expr)
+	assert.NotSame(t, before.Statements[1].Expr, after.Statements[1].Expr)
+	assert.Same(t, before.Statements[2].Expr, after.Statements[2].Expr)
+}
+
+func TestIncrementalParserEdits(t *testing.T) {
+	src := "func a() {\nx := 1\n}\nfunc b() {\ny := 2\n}\nz := 3\n"
+
+	cases := []struct {
+		name       string
+		start, end int
+		text       string
+	}{
+		{"Insert", 0, 0, "w := 0\n"},
+		{"Delete", 0, len("func a() {\nx := 1\n}\n"), ""},
+		{"Append", len(src), len(src), "v := 4\n"},
+		{"MissingBrace", strings.Index(src, "}"), strings.Index(src, "}") + 1, ""},
+		{"JoinedTokens", strings.LastIndex(src, "\n") - 1, strings.LastIndex(src, "\n") - 1, "x"},
+		{"JoinedStatements", strings.Index(src, "}\nfunc b") + 1, strings.Index(src, "}\nfunc b") + 2, ""},
+		{"Unterminated", strings.Index(src, "2"), strings.Index(src, "2"), "\""},
+		{"Whole", 0, len(src), "func main() {}"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p := NewIncrementalParser("main.mq", []byte(src))
+			assert.NoError(t, p.Edit(uint64(c.start), uint64(c.end), []byte(c.text)))
+
+			// The result always matches parsing the edited file from scratch
+			assert.Equal(t, parseSource(src[:c.start]+c.text+src[c.end:]), p.AST())
+		})
+	}
+}
+
+func TestIncrementalParserOutOfSource(t *testing.T) {
+	p := NewIncrementalParser("main.mq", []byte("x := 1"))
+
+	assert.EqualError(t, p.Edit(2, 10, nil), "edit [2:10] is out of the source, which is 6 bytes long")
+	assert.EqualError(t, p.Edit(3, 2, nil), "edit [3:2] is out of the source, which is 6 bytes long")
+}
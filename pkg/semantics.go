@@ -1,15 +1,20 @@
 package maqui
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sort"
 	"strings"
+	"text/tabwriter"
 )
 
 // SemanticAnalyser defines the expected behavior of a semantic analyzer. The semantic analyzer should use context-aware
 // strategies to build a symbol table and resolve reference in the code.
 type SemanticAnalyser interface {
 	// DefineInto does a full but shallow pass over the expressions and brings the file definitions inside the provided scope.
-	// It won't delve into nested definitions like functions.
+	// It won't delve into nested definitions like functions. It must be called before Do, so the definitions are known
+	// regardless of their order in the file.
 	DefineInto(stab *SymbolTable)
 
 	// Do runs synchronously and returns the annotated AST produced
@@ -19,23 +24,44 @@ type SemanticAnalyser interface {
 // ContextAnalyzer is the default Maqui semantic analyser. It goes over the expressions provided by the Parses to build
 // an AST annotated with type data and symbol tables. A ContextAnalyzer is stateful and shouldn't be used for more than
 // one file.
+//
+// The expressions are read from the parser once, and cached. Each pass, DefineInto and then Do, goes over the full
+// cached stream from its start, so a pass is never affected by where the previous one stopped.
 type ContextAnalyzer struct {
 	// filename name of the file that provided the source for the expressions
 	filename string
 	// parser is the expression provider
 	parser SyntacticAnalyzer
 
-	// cache hold expressions already visited to be able to go over them again when needed
+	// cache hold all the expressions of the parser, to be able to go over them again on each pass
 	cache []Expr
-	// live is true if the parser is providing expressions as the ContextAnalyzer goes forward. It starts as true
-	// and is set to false once the end of the end of the stream is reached. If live is set to false the ContextAnalyzer
-	// will feed from the cached expressions.
+	// live is true while the parser stream is not exhausted. It starts as true and is set to false once the end of the
+	// stream is reached and all the expressions are inside the cache.
 	live bool
 	// started is set to true once the underlying parser is ran.
 	started bool
-	// index holds the current position of the ContextAnalyzer, but will only be used once live is set to false and the
-	// ContextAnalyzer is working offline.
+	// index holds the position of the current pass inside the cache
 	index int
+	// diagnostics is an optional channel where the errors are sent as soon as they are found by Do
+	diagnostics chan<- CompileError
+	// loader loads the modules imported by the file. If nil, imports are reported as errors.
+	loader ModuleLoader
+	// importErrors holds the reason each unresolved import failed, to be reported by Do
+	importErrors map[*ImportDecl]error
+	// unexported holds the qualified names of the functions of the imported modules that are not exported
+	unexported map[string]bool
+	// results holds the types of the named results of the function being analyzed, mapped by name
+	results map[string]Type
+	// returned is the type of the values returned by the function being analyzed, or nil if it didn't return yet. It's
+	// void once the function returns without a value.
+	returned Type
+	// global is the scope of the top-level definitions of the file, where the body of the function literals is analyzed.
+	// It's set by Do.
+	global *SymbolTable
+	// topLevelExprs is true if bare expressions are allowed at the top level of the file
+	topLevelExprs bool
+	// types records the type resolved for each expression, if set
+	types map[Expr]Type
 }
 
 // NewContextAnalyser creates a *ContextAnalyzer that takes expressions from the parser.
@@ -47,31 +73,308 @@ func NewContextAnalyser(parser SyntacticAnalyzer) *ContextAnalyzer {
 	}
 }
 
+// ReportTo sets a channel where Do sends each error as soon as it's found, besides collecting it inside the AST. The
+// channel is not closed by the ContextAnalyzer.
+func (c *ContextAnalyzer) ReportTo(diagnostics chan<- CompileError) {
+	c.diagnostics = diagnostics
+}
+
+// AllowTopLevelExpressions sets whether bare expressions, like 1 + 1 or a function call, are allowed at the top level
+// of the file. They are rejected by default, since only declarations have an effect outside of a function, but a REPL
+// evaluates them.
+func (c *ContextAnalyzer) AllowTopLevelExpressions(allow bool) {
+	c.topLevelExprs = allow
+}
+
+// SetModuleLoader sets the loader used to resolve the imports of the file. The paths of the imports are taken relative
+// to the directory of the file.
+func (c *ContextAnalyzer) SetModuleLoader(loader ModuleLoader) {
+	c.loader = loader
+}
+
 // DefineInto does a full but shallow pass over the expressions and brings the file definitions inside the provided scope.
-// It won't delve into nested definitions like functions.
+// It won't delve into nested definitions like functions. The functions of the imported modules are brought in as well,
+// qualified by the name of their module.
+//
+// The variables are resolved once all the other definitions are known, so they can refer to any function, and to the
+// variables declared after them. No errors are reported for them, as they are reported once the variables are analyzed
+// by Do. The same goes for the results of the functions without named results, which are inferred from their returns.
 func (c *ContextAnalyzer) DefineInto(scope *SymbolTable) {
-	c.reset()
+	c.rewind()
 
-	for {
-		expr := c.get()
-		if !isValidExpr(expr) {
-			break
+	var vars []*VariableDecl
+	var funcs []*FuncDecl
+	for expr := c.get(); expr != nil; expr = c.get() {
+		if e, isVarDef := expr.(*VariableDecl); isVarDef {
+			vars = append(vars, e)
 		}
 
-		if e, isVarDef := expr.(*VariableDecl); isVarDef {
-			scope.Add(e.Name, c.resolve(scope, e.Value))
+		if e, isMultiVarDef := expr.(*MultiVariableDecl); isMultiVarDef {
+			for i := 0; i < len(e.Names) && i < len(e.Values); i++ {
+				vars = append(vars, &VariableDecl{Location: e.Location, Name: e.Names[i], Value: e.Values[i]})
+			}
 		}
 
 		if e, isFuncDef := expr.(*FuncDecl); isFuncDef {
 			c.addFunction(scope, e)
+			funcs = append(funcs, e)
+		}
+
+		if e, isExternDef := expr.(*ExternDecl); isExternDef {
+			c.addExtern(scope, e)
+		}
+
+		if e, isImport := expr.(*ImportDecl); isImport {
+			c.importModule(scope, e)
+		}
+	}
+
+	c.inferResults(scope, funcs)
+	c.defineVariables(scope, vars)
+
+	// The functions are inferred again once the variables are known, since they might return them
+	c.inferResults(scope, funcs)
+}
+
+// inferResults infers the results of the functions without named results from the values they return, and updates
+// their types inside the scope. The functions a body calls are inferred before it, regardless of their order in the
+// file. Functions calling each other in a cycle are inferred in the order they are found.
+func (c *ContextAnalyzer) inferResults(scope *SymbolTable, funcs []*FuncDecl) {
+	byName := make(map[string]*FuncDecl)
+	for _, f := range funcs {
+		if len(f.Results) == 0 {
+			byName[f.Name] = f
+		}
+	}
+
+	done := make(map[*FuncDecl]bool)
+	visiting := make(map[*FuncDecl]bool)
+
+	var infer func(f *FuncDecl)
+	infer = func(f *FuncDecl) {
+		if done[f] || visiting[f] {
+			return
+		}
+
+		visiting[f] = true
+		for _, stmt := range f.Body {
+			Inspect(stmt, func(expr Expr) bool {
+				if id, isIdentifier := expr.(*Identifier); isIdentifier && byName[id.Name] != nil {
+					infer(byName[id.Name])
+				}
+
+				return true
+			})
+		}
+		visiting[f] = false
+
+		// The errors are reported by Do
+		f.InferredResult = c.analyzeBody(scope.Copy(), nil, f.Body)
+		c.addFunction(scope, f)
+
+		done[f] = true
+	}
+
+	for _, f := range funcs {
+		if byName[f.Name] == f {
+			infer(f)
+		}
+	}
+}
+
+// defineVariables resolves the types of the top-level variables and adds them to the scope. The variables a value
+// refers to are resolved before it, regardless of their order in the file. Variables that refer to each other in a cycle
+// can't be resolved, and are reported instead.
+func (c *ContextAnalyzer) defineVariables(scope *SymbolTable, vars []*VariableDecl) {
+	byName := make(map[string][]*VariableDecl)
+	for _, v := range vars {
+		if v.Name != blankIdentifier {
+			byName[v.Name] = append(byName[v.Name], v)
+		}
+	}
+
+	done := make(map[*VariableDecl]bool)
+	visiting := make(map[*VariableDecl]bool)
+
+	var define func(v *VariableDecl)
+	define = func(v *VariableDecl) {
+		if visiting[v] {
+			scope.AddError(&InitializationCycleError{
+				Loc:  v.GetLocation(),
+				Name: v.Name,
+			})
+		}
+
+		if done[v] || visiting[v] {
+			return
+		}
+
+		visiting[v] = true
+		references(v.Value, nil, func(id *Identifier) {
+			for _, dep := range byName[id.Name] {
+				define(dep)
+			}
+		})
+		visiting[v] = false
+
+		// The errors are reported by Do
+		errs := len(scope.Errors)
+		t := c.resolve(scope, v.Value)
+		scope.Errors = scope.Errors[:errs]
+
+		if v.Name != blankIdentifier {
+			scope.Add(v.Name, t)
+		}
+
+		done[v] = true
+	}
+
+	for _, v := range vars {
+		define(v)
+	}
+}
+
+// references calls fn for each identifier of the expression that refers to a definition outside of it. The variables
+// and named results of a function literal shadow the outer definitions of the same name, so the identifiers referring
+// to them are skipped, as are the names in shadowed.
+func references(expr Expr, shadowed map[string]bool, fn func(id *Identifier)) {
+	Inspect(expr, func(expr Expr) bool {
+		switch e := expr.(type) {
+		case *Identifier:
+			if !shadowed[e.Name] {
+				fn(e)
+			}
+		case *FuncLit:
+			inner := shadowing(shadowed)
+			for _, result := range e.Results {
+				inner[result.Name] = true
+			}
+
+			bodyReferences(e.Body, inner, fn)
+			return false
+		}
+
+		return true
+	})
+}
+
+// bodyReferences calls fn for each identifier of the statements that refers to a definition outside of them, as
+// described by [references]. A declared variable shadows the outer definitions from the statement that declares it
+// on, up to the end of its block.
+func bodyReferences(body []Expr, shadowed map[string]bool, fn func(id *Identifier)) {
+	for _, stmt := range body {
+		switch e := stmt.(type) {
+		case *VariableDecl:
+			references(e.Value, shadowed, fn)
+			shadowed[e.Name] = true
+		case *MultiVariableDecl:
+			for _, value := range e.Values {
+				references(value, shadowed, fn)
+			}
+
+			for _, name := range e.Names {
+				shadowed[name] = true
+			}
+		case *IfExpr:
+			references(e.Condition, shadowed, fn)
+			bodyReferences(e.Consequent, shadowing(shadowed), fn)
+			bodyReferences(e.Else, shadowing(shadowed), fn)
+		case *BlockExpr:
+			bodyReferences(e.Body, shadowing(shadowed), fn)
+		default:
+			references(stmt, shadowed, fn)
+		}
+	}
+}
+
+// shadowing returns a copy of the shadowed names, to which the names declared inside a nested scope are added
+func shadowing(shadowed map[string]bool) map[string]bool {
+	inner := make(map[string]bool, len(shadowed))
+	for name := range shadowed {
+		inner[name] = true
+	}
+
+	return inner
+}
+
+// importModule loads the module of the import and adds its exported functions to the scope, qualified by the module
+// name. If the module can't be loaded, the error is kept until the import is analyzed.
+func (c *ContextAnalyzer) importModule(scope *SymbolTable, e *ImportDecl) {
+	if c.loader == nil {
+		c.importFailed(e, errors.New("imports are not supported"))
+		return
+	}
+
+	path := e.Path
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(c.filename), path)
+	}
+
+	mod, err := c.loader.Load(path)
+	if err != nil {
+		c.importFailed(e, err)
+		return
+	}
+
+	e.Module = mod
+	for _, stmt := range mod.AST.Statements {
+		f, isFunc := stmt.Expr.(*FuncDecl)
+		if !isFunc {
+			continue
+		}
+
+		name := mod.Name + "." + f.Name
+		if !f.Exported {
+			if c.unexported == nil {
+				c.unexported = make(map[string]bool)
+			}
+
+			c.unexported[name] = true
+			continue
+		}
+
+		scope.Add(name, mod.AST.Global.Get(f.Name))
+	}
+}
+
+// undefined returns the error for a name missing from the symbol table. Functions of imported modules that are not
+// exported are reported as such instead of as undefined, and so is the blank identifier, which is never defined.
+func (c *ContextAnalyzer) undefined(stab *SymbolTable, name string, loc *Location) CompileError {
+	if name == blankIdentifier {
+		return &BlankIdentifierError{
+			Loc: loc,
 		}
 	}
+
+	if c.unexported[name] {
+		return &UnexportedSymbolError{
+			Loc:  loc,
+			Name: name,
+		}
+	}
+
+	return &UndefinedError{
+		Loc:        loc,
+		Name:       name,
+		Suggestion: stab.Suggest(name),
+	}
+}
+
+// importFailed keeps the reason an import couldn't be resolved
+func (c *ContextAnalyzer) importFailed(e *ImportDecl, err error) {
+	if c.importErrors == nil {
+		c.importErrors = make(map[*ImportDecl]error)
+	}
+
+	c.importErrors[e] = err
 }
 
 // Do takes in a global symbol table and builds an annotated *AST. It delves into nested definitions and builds the
-// corresponding symbol tables as well.
+// corresponding symbol tables as well. The errors of the AST are sorted by their location in the source. The global
+// symbol table is expected to hold the definitions brought in by DefineInto.
 func (c *ContextAnalyzer) Do(global *SymbolTable) *AST {
-	c.reset()
+	c.rewind()
+	c.global = global
 
 	ast := &AST{
 		Global:   global,
@@ -81,17 +384,31 @@ func (c *ContextAnalyzer) Do(global *SymbolTable) *AST {
 	for {
 		expr := c.get()
 		if expr == nil {
+			c.reportBadExprs(ast)
+			sortErrors(ast.Errors)
+
+			// The directives are complete once the parser is done
+			if p, ok := c.parser.(interface{ Ignores() []*IgnoreDirective }); ok {
+				ast.Ignores = p.Ignores()
+			}
+
 			return ast
 		}
 
 		if bad, ok := expr.(*BadExpr); ok {
-			ast.Errors = append(ast.Errors, &BadExprError{
+			c.report(ast, &BadExprError{
 				Loc:  expr.GetLocation(),
 				Expr: bad,
 			})
 			continue
 		}
 
+		if !c.topLevelExprs && !isDeclaration(expr) {
+			c.report(ast, &TopLevelExpressionError{
+				Loc: expr.GetLocation(),
+			})
+		}
+
 		stab := c.analyze(*ast.Global.Copy(), expr)
 		ast.Statements = append(ast.Statements, &AnnotatedExpr{
 			Stab: stab.Copy(),
@@ -109,33 +426,121 @@ func (c *ContextAnalyzer) Do(global *SymbolTable) *AST {
 			}
 
 			if !isDuplicate {
-				ast.Errors = append(ast.Errors, err)
+				c.report(ast, err)
 			}
 		}
 	}
 }
 
-// get fetches the next available expression. If the ContextAnalyzer is running on live mode (that is, the first run) it
-// will fetch the expressions directly from the parser and store them in cache. Once the parser stream is exhausted the
-// ContextAnalyzer can be reset to use the cache in an offline way to go over the expressions again.
-func (c *ContextAnalyzer) get() Expr {
-	if c.live {
-		if !c.started {
-			go c.parser.Do()
-			c.started = true
+// reportBadExprs walks the whole AST and reports every bad expression that the analysis didn't reach, such as the
+// ones nested in the arguments of a call that failed to resolve, so that no parse error is silently dropped
+func (c *ContextAnalyzer) reportBadExprs(ast *AST) {
+	reported := make(map[*BadExpr]bool)
+	for _, err := range ast.Errors {
+		if bad, ok := err.(*BadExprError); ok {
+			reported[bad.Expr] = true
 		}
+	}
 
-		expr := c.parser.Get()
-		_, ok := expr.(*EOS)
-		if ok {
-			c.live = false
+	for _, stmt := range ast.Statements {
+		Inspect(stmt.Expr, func(e Expr) bool {
+			bad, ok := e.(*BadExpr)
+			if !ok || reported[bad] {
+				return true
+			}
+
+			reported[bad] = true
+			c.report(ast, &BadExprError{
+				Loc:  bad.GetLocation(),
+				Expr: bad,
+			})
+
+			return true
+		})
+	}
+}
+
+// TypeOf returns the type resolved for an expression of the AST, or nil if the expression is not part of the AST or
+// its type couldn't be resolved. Variable declarations have the type of their variable. The type is resolved within the
+// scope the expression is found in, so the statement holding it is analyzed again, without reporting any errors.
+func (ast *AST) TypeOf(expr Expr) Type {
+	for _, stmt := range ast.Statements {
+		found := false
+		Inspect(stmt.Expr, func(e Expr) bool {
+			found = found || e == expr
+			return !found
+		})
+
+		if !found {
+			continue
+		}
+
+		t := ast.resolvedType(stmt.Expr, expr)
+		if _, failed := t.(*TypeErr); failed {
 			return nil
 		}
 
-		c.cache = append(c.cache, expr)
-		return expr
+		return t
+	}
+
+	return nil
+}
+
+// resolvedType analyzes the statement again, and returns the type resolved for the expression inside it
+func (ast *AST) resolvedType(stmt, expr Expr) Type {
+	if decl, isVarDef := expr.(*VariableDecl); isVarDef {
+		return decl.ResolvedType
+	}
+
+	c := &ContextAnalyzer{
+		filename: ast.Filename,
+		types:    make(map[Expr]Type),
+		global:   ast.Global,
+	}
+
+	c.analyze(*ast.Global.Copy(), stmt)
+	return c.types[expr]
+}
+
+// isDeclaration returns true if the expression is allowed at the top level of a file: a declaration, an import or a
+// comment
+func isDeclaration(expr Expr) bool {
+	switch expr.(type) {
+	case *VariableDecl, *MultiVariableDecl, *FuncDecl, *ExternDecl, *ImportDecl, *CommentExpr:
+		return true
 	}
 
+	return false
+}
+
+// sortErrors sorts the errors by their location, first by file and then by position inside the file. Errors without a
+// location are placed last. Errors with the same location keep their order.
+func sortErrors(errs []CompileError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		l1, l2 := errs[i].GetLocation(), errs[j].GetLocation()
+		if l1 == nil || l2 == nil {
+			return l2 == nil && l1 != nil
+		}
+
+		if l1.File != l2.File {
+			return l1.File < l2.File
+		}
+
+		return l1.Start < l2.Start
+	})
+}
+
+// report adds the error to the AST, and sends it to the diagnostics channel if one is set
+func (c *ContextAnalyzer) report(ast *AST, err CompileError) {
+	ast.Errors = append(ast.Errors, err)
+
+	if c.diagnostics != nil {
+		c.diagnostics <- err
+	}
+}
+
+// get fetches the next expression of the current pass, or nil once the pass is over. A pass must be started by rewind.
+func (c *ContextAnalyzer) get() Expr {
 	if c.index >= len(c.cache) {
 		return nil
 	}
@@ -145,8 +550,24 @@ func (c *ContextAnalyzer) get() Expr {
 	return expr
 }
 
-// reset sets the position (index) to the start
-func (c *ContextAnalyzer) reset() {
+// rewind starts a new pass from the first expression. The first time it's called, it runs the parser and reads its full
+// stream into the cache.
+func (c *ContextAnalyzer) rewind() {
+	if !c.started {
+		go c.parser.Do()
+		c.started = true
+	}
+
+	for c.live {
+		expr := c.parser.Get()
+		if _, ok := expr.(*EOS); ok {
+			c.live = false
+			break
+		}
+
+		c.cache = append(c.cache, expr)
+	}
+
 	c.index = 0
 }
 
@@ -164,64 +585,254 @@ func (c *ContextAnalyzer) analyze(stab SymbolTable, expr Expr) SymbolTable {
 		return stab
 	case *FuncDecl:
 		c.addFunction(&stab, e)
-		for _, child := range e.Body {
-			stab.Import(c.analyze(stab, child))
-		}
+		e.InferredResult = c.analyzeBody(&stab, e.Results, e.Body)
 
 		return stab
-	case *VariableDecl:
-		t := c.resolve(&stab, e.Value)
-		stab.Add(e.Name, t)
-		e.ResolvedType = t
-	case *FuncCall:
+	case *ExternDecl:
+		c.checkExtern(&stab, e)
 		if stab.Get(e.Name) == nil {
-			stab.AddError(&UndefinedError{
+			// Top-level declarations are already defined by DefineInto
+			c.addExtern(&stab, e)
+		}
+	case *ImportDecl:
+		if err, failed := c.importErrors[e]; failed {
+			stab.AddError(&ImportError{
 				Loc:  e.GetLocation(),
-				Name: e.Name,
+				Path: e.Path,
+				Err:  err.Error(),
 			})
+		}
+	case *VariableDecl:
+		e.ResolvedType = c.declare(&stab, e.Name, e.Value, c.resolveValue(&stab, e.Value), e.GetLocation())
+	case *MultiVariableDecl:
+		// All the values are resolved before any of the variables is declared
+		types := make([]Type, len(e.Values))
+		for i, value := range e.Values {
+			types[i] = c.resolveValue(&stab, value)
+		}
 
-			break
+		if len(e.Names) != len(e.Values) {
+			stab.AddError(&AssignmentCountError{
+				Loc:    e.GetLocation(),
+				Names:  len(e.Names),
+				Values: len(e.Values),
+			})
 		}
 
-		for _, arg := range e.Args {
-			e.ResolvedTypes = append(e.ResolvedTypes, c.resolve(&stab, arg))
-			// TODO See if arguments match
+		e.ResolvedTypes = make([]Type, len(e.Names))
+		for i, name := range e.Names {
+			if i >= len(e.Values) {
+				// Declared anyway, so its uses are not reported as undefined
+				e.ResolvedTypes[i] = c.declare(&stab, name, nil, &TypeErr{TypeErrIncompatible}, e.GetLocation())
+				continue
+			}
+
+			e.ResolvedTypes[i] = c.declare(&stab, name, e.Values[i], types[i], e.GetLocation())
 		}
+	case *FuncCall:
+		c.resolve(&stab, e)
 
-	case *IfExpr:
-		// TODO: Check if the condition is evaluable
-		// TODO: Add test cases
-		_ = c.resolve(&stab, e.Condition)
+	case *DeferExpr:
+		if _, isCall := e.Call.(*FuncCall); !isCall {
+			if _, isBad := e.Call.(*BadExpr); !isBad {
+				stab.AddError(&DeferNotCallError{
+					Loc: e.Call.GetLocation(),
+				})
 
-		for _, child := range e.Consequent {
-			stab.Import(c.analyze(stab, child))
+				break
+			}
 		}
 
-		for _, child := range e.Else {
-			stab.Import(c.analyze(stab, child))
+		c.resolve(&stab, e.Call)
+
+	case *IfExpr:
+		cond := c.resolveValue(&stab, e.Condition)
+		if !c.isErrorType(cond) && !cond.Equals(&BasicType{"bool"}) {
+			stab.AddError(&ConditionTypeError{
+				Loc:  e.GetLocation(),
+				Type: cond,
+			})
 		}
 
+		stab.Errors = append(stab.Errors, c.analyzeBlock(stab, e.Consequent)...)
+		stab.Errors = append(stab.Errors, c.analyzeBlock(stab, e.Else)...)
+
+	case *BlockExpr:
+		stab.Errors = append(stab.Errors, c.analyzeBlock(stab, e.Body)...)
+
 	case *Identifier:
 		if stab.Get(e.Name) == nil {
-			stab.AddError(&UndefinedError{
-				Loc:  e.GetLocation(),
-				Name: e.Name,
-			})
+			stab.AddError(c.undefined(&stab, e.Name, e.GetLocation()))
 		}
 	case *BinaryExpr:
 		c.resolve(&stab, e)
 
+	case *BooleanExpr:
+		c.resolve(&stab, e)
+
 	case *UnaryExpr:
 		c.resolve(&stab, e)
+
+	case *ConditionalExpr:
+		c.resolve(&stab, e)
+
+	case *InterpolatedString:
+		c.resolve(&stab, e)
+
+	case *FuncLit:
+		c.resolve(&stab, e)
+
+	case *ReturnExpr:
+		c.checkReturn(&stab, e)
 	}
 
 	return stab
 }
 
+// declare adds a variable of the resolved type t to the symbol table, and returns the type it was declared with. A
+// named result keeps its type, so it can be returned, and assigning it a value of another type is reported. The value
+// of the blank identifier is discarded, so it's never added.
+func (c *ContextAnalyzer) declare(stab *SymbolTable, name string, value Expr, t Type, loc *Location) Type {
+	if rt, isResult := c.results[name]; isResult && !c.isErrorType(t) && !t.Equals(rt) && !c.isLiteralOf(value, rt) {
+		stab.AddError(&IncompatibleTypesError{
+			Loc:   loc,
+			Type1: rt,
+			Type2: t,
+		})
+
+		t = rt
+	}
+
+	if name != blankIdentifier {
+		stab.Add(name, t)
+	}
+
+	return t
+}
+
+// incompatibleComparison returns the error for a comparison between two operands of different types. If one of the
+// operands is itself a comparison, like in 1 == 2 == 3, the comparisons were most likely meant to be chained, so a
+// *ChainedComparisonError is returned instead of an *IncompatibleTypesError.
+func (c *ContextAnalyzer) incompatibleComparison(expr *BooleanExpr, t1, t2 Type) CompileError {
+	if _, isComparison := expr.Op1.(*BooleanExpr); isComparison {
+		return &ChainedComparisonError{
+			Loc:  expr.GetLocation(),
+			Type: t2,
+		}
+	}
+
+	if _, isComparison := expr.Op2.(*BooleanExpr); isComparison {
+		return &ChainedComparisonError{
+			Loc:  expr.GetLocation(),
+			Type: t1,
+		}
+	}
+
+	return &IncompatibleTypesError{
+		Loc:   expr.GetLocation(),
+		Type1: t1,
+		Type2: t2,
+	}
+}
+
+// analyzeBody analyzes the body of a function inside the symbol table, declaring its named results first. If the
+// function has no named results, the type of the values it returns is returned, or nil if it returns no value.
+func (c *ContextAnalyzer) analyzeBody(stab *SymbolTable, results []*Param, body []Expr) *BasicType {
+	prevResults, prevReturned := c.results, c.returned
+	c.results = make(map[string]Type)
+	c.returned = nil
+	for _, result := range results {
+		if !isBasicType(result.Type) {
+			stab.AddError(&UndefinedError{
+				Loc:  result.Location,
+				Name: result.Type,
+			})
+		}
+
+		c.results[result.Name] = &BasicType{result.Type}
+		stab.Add(result.Name, &BasicType{result.Type})
+
+		if c.returned == nil {
+			c.returned = &BasicType{result.Type}
+		}
+	}
+
+	for _, child := range body {
+		stab.Import(c.analyze(*stab, child))
+	}
+
+	returned := c.returned
+	c.results, c.returned = prevResults, prevReturned
+
+	if t, isBasic := returned.(*BasicType); isBasic && len(results) == 0 && !t.Equals(&BasicType{"void"}) {
+		return t
+	}
+
+	return nil
+}
+
+// checkReturn checks the value of a return against the ones returned before by the same function, or against its
+// named result. A bare return returns the named results, so it's only checked in functions without them.
+func (c *ContextAnalyzer) checkReturn(stab *SymbolTable, e *ReturnExpr) {
+	var t Type = &BasicType{"void"}
+	if e.Value != nil {
+		t = c.resolveValue(stab, e.Value)
+		if c.isErrorType(t) {
+			// Error already logged by the type resolution
+			return
+		}
+
+		if _, isBasic := t.(*BasicType); !isBasic {
+			stab.AddError(&ReturnTypeError{
+				Loc:  e.Value.GetLocation(),
+				Type: t,
+			})
+
+			return
+		}
+	} else if len(c.results) != 0 {
+		return
+	}
+
+	if c.returned == nil {
+		c.returned = t
+		return
+	}
+
+	if !t.Equals(c.returned) && !c.isLiteralOf(e.Value, c.returned) {
+		stab.AddError(&ReturnMismatchError{
+			Loc:  e.GetLocation(),
+			Want: c.returned,
+			Got:  t,
+		})
+	}
+}
+
+// analyzeBlock analyzes the statements of a nested block inside a child scope of the symbol table, so the definitions
+// of the block don't leak into the enclosing scope. The errors found inside the block are returned.
+func (c *ContextAnalyzer) analyzeBlock(stab SymbolTable, exprs []Expr) []CompileError {
+	scope := stab.Copy()
+	for _, child := range exprs {
+		scope.Import(c.analyze(*scope, child))
+	}
+
+	return scope.Errors[len(stab.Errors):]
+}
+
 // resolve will try to resolve the type of an expression. It takes in the context's symbol table and it might be used
 // to get other definition's types. If an error or an unexpected expression is encountered, an error will be added to
 // the symbol table and a *TypeErr will be returned.
 func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
+	t := c.resolveExpr(stab, expr)
+	if c.types != nil {
+		c.types[expr] = t
+	}
+
+	return t
+}
+
+// resolveExpr resolves the type of an expression as described by resolve, without recording it
+func (c *ContextAnalyzer) resolveExpr(stab *SymbolTable, expr Expr) Type {
 	switch e := expr.(type) {
 	case *BadExpr:
 		stab.AddError(&BadExprError{
@@ -234,15 +845,105 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 			return t
 		}
 
-		stab.AddError(&UndefinedError{
-			Loc:  e.GetLocation(),
-			Name: e.Name,
-		})
+		stab.AddError(c.undefined(stab, e.Name, e.GetLocation()))
 
 		return &TypeErr{TypeErrUndefined}
+	case *FuncCall:
+		t := c.resolve(stab, e.Callee)
+
+		// The arguments are resolved even if the function is undefined, so errors nested inside them are reported
+		var argTypes []Type
+		for _, arg := range e.Args {
+			argTypes = append(argTypes, c.resolveValue(stab, arg))
+			// TODO See if arguments match
+		}
+
+		e.ResolvedTypes = argTypes
+
+		f, isFunc := t.(*FuncType)
+		if !isFunc {
+			if c.isErrorType(t) {
+				// Error already logged by the type resolution of the variable
+				return t
+			}
+
+			stab.AddError(&NotCallableError{
+				Loc:  e.GetLocation(),
+				Name: e.calleeName(),
+				Type: t,
+			})
+
+			return &TypeErr{TypeErrNotCallable}
+		}
+
+		// The condition of the assert builtin is checked like the one of an if, unless the builtin is shadowed
+		if f == builtins["assert"].typ {
+			if len(argTypes) != 1 {
+				stab.AddError(&ArgumentCountError{
+					Loc:  e.GetLocation(),
+					Name: e.calleeName(),
+					Want: 1,
+					Got:  len(argTypes),
+				})
+			} else if !c.isErrorType(argTypes[0]) && !argTypes[0].Equals(&BasicType{"bool"}) {
+				stab.AddError(&ConditionTypeError{
+					Loc:  e.Args[0].GetLocation(),
+					Type: argTypes[0],
+				})
+			}
+		}
+
+		switch len(f.Returns) {
+		case 0:
+			return &BasicType{"void"}
+		case 1:
+			return f.Returns[0]
+		}
 	case *BinaryExpr:
-		t1 := c.resolve(stab, e.Op1)
-		t2 := c.resolve(stab, e.Op2)
+		t1 := c.resolveValue(stab, e.Op1)
+		t2 := c.resolveValue(stab, e.Op2)
+
+		if c.isErrorType(t1) {
+			// Error already logged by the type resolution
+			return t1
+		}
+
+		if c.isErrorType(t2) {
+			// Error already logged by the type resolution
+			return t2
+		}
+
+		// Number literals are untyped, so they adopt the numeric type of the other operand if their value fits in it
+		if c.isLiteralOf(e.Op1, t2) {
+			t1 = t2
+		} else if c.isLiteralOf(e.Op2, t1) {
+			t2 = t1
+		}
+
+		if !t1.Equals(t2) {
+			stab.AddError(&IncompatibleTypesError{
+				Loc:   e.GetLocation(),
+				Type1: t1,
+				Type2: t2,
+			})
+
+			return &TypeErr{TypeErrIncompatible}
+		}
+
+		if !c.isOpDefined(t1, e.Operation) {
+			stab.AddError(&UndefinedOperationError{
+				Loc:  e.GetLocation(),
+				Type: t1,
+				Op:   e.Operation,
+			})
+
+			return &TypeErr{TypeErrBadOp}
+		}
+
+		return t1
+	case *BooleanExpr:
+		t1 := c.resolveValue(stab, e.Op1)
+		t2 := c.resolveValue(stab, e.Op2)
 
 		if c.isErrorType(t1) {
 			// Error already logged by the type resolution
@@ -254,6 +955,47 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 			return t2
 		}
 
+		if c.isLiteralOf(e.Op1, t2) {
+			t1 = t2
+		} else if c.isLiteralOf(e.Op2, t1) {
+			t2 = t1
+		}
+
+		// Functions of the same signature are comparable too, by identity
+		if !t1.Equals(t2) {
+			stab.AddError(c.incompatibleComparison(e, t1, t2))
+			return &TypeErr{TypeErrIncompatible}
+		}
+
+		return &BasicType{"bool"}
+	case *ConditionalExpr:
+		cond := c.resolveValue(stab, e.Condition)
+		if !c.isErrorType(cond) && !cond.Equals(&BasicType{"bool"}) {
+			stab.AddError(&ConditionTypeError{
+				Loc:  e.GetLocation(),
+				Type: cond,
+			})
+		}
+
+		t1 := c.resolveValue(stab, e.Consequent)
+		t2 := c.resolveValue(stab, e.Alternative)
+
+		if c.isErrorType(t1) {
+			// Error already logged by the type resolution
+			return t1
+		}
+
+		if c.isErrorType(t2) {
+			// Error already logged by the type resolution
+			return t2
+		}
+
+		if c.isLiteralOf(e.Consequent, t2) {
+			t1 = t2
+		} else if c.isLiteralOf(e.Alternative, t1) {
+			t2 = t1
+		}
+
 		if !t1.Equals(t2) {
 			stab.AddError(&IncompatibleTypesError{
 				Loc:   e.GetLocation(),
@@ -261,22 +1003,51 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 				Type2: t2,
 			})
 
-			return &TypeErr{TypeErrIncompatible}
+			return &TypeErr{TypeErrIncompatible}
+		}
+
+		return t1
+	case *InterpolatedString:
+		for _, part := range e.Parts {
+			t := c.resolveValue(stab, part)
+			if c.isErrorType(t) {
+				// Error already logged by the type resolution
+				return t
+			}
+
+			if basic, isBasic := t.(*BasicType); !isBasic || !isBasicType(basic.Typ) {
+				stab.AddError(&InterpolationTypeError{
+					Loc:  part.GetLocation(),
+					Type: t,
+				})
+
+				return &TypeErr{TypeErrIncompatible}
+			}
+		}
+
+		return &BasicType{"string"}
+	case *FuncLit:
+		// The literal doesn't capture the variables of the enclosing function, so its body only sees the top-level
+		// definitions. Top-level variables are resolved before Do sets them, inside their own scope.
+		scope := stab.Copy()
+		if c.global != nil {
+			scope = c.global.Copy()
 		}
 
-		if !c.isOpDefined(t1, e.Operation) {
-			stab.AddError(&UndefinedOperationError{
-				Loc:  e.GetLocation(),
-				Type: t1,
-				Op:   e.Operation,
-			})
+		scope.Errors = nil
+		e.InferredResult = c.analyzeBody(scope, e.Results, e.Body)
+		stab.Errors = append(stab.Errors, scope.Errors...)
 
-			return &TypeErr{TypeErrBadOp}
+		return funcType(e.Results, e.InferredResult)
+	case *UnaryExpr:
+		t := c.resolveValue(stab, e.Operand)
+		if c.isErrorType(t) {
+			// Error already logged by the type resolution
+			return t
 		}
 
-		return t1
-	case *UnaryExpr:
-		if t, isBasicType := c.resolve(stab, e.Operand).(*BasicType); isBasicType && t.Typ != "int" {
+		isFloat := t.Equals(&BasicType{"float"})
+		if !c.isIntegerType(t) && (!isFloat || e.Operation == UnaryBitwiseNot) {
 			stab.AddError(&UndefinedUnitaryError{
 				Loc:  e.GetLocation(),
 				Type: t,
@@ -284,15 +1055,26 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 			})
 
 			return &TypeErr{TypeErrBadOp}
-		} else {
-			return t
 		}
 
+		return t
+
 	case *LiteralExpr:
 		switch e.Typ {
 		case LiteralString:
 			return &BasicType{"string"}
+		case LiteralBool:
+			return &BasicType{"bool"}
 		case LiteralNumber:
+			if isFloatLiteral(e.Value) {
+				return &BasicType{"float"}
+			}
+
+			if !fitsInt(e, intSizes["int"]) {
+				// Numbers too big for an int get widened
+				return &BasicType{"int64"}
+			}
+
 			return &BasicType{"int"}
 		default:
 			return &TypeErr{"unimplemented"} // TODO Log error
@@ -302,14 +1084,88 @@ func (c *ContextAnalyzer) resolve(stab *SymbolTable, expr Expr) Type {
 	return &TypeErr{"unknown"}
 }
 
+// resolveValue resolves the type of an expression used as a value, like an operand or the value of a variable. Calls to
+// functions without results (void) have no value, so a *VoidInExpressionError is reported for them.
+func (c *ContextAnalyzer) resolveValue(stab *SymbolTable, expr Expr) Type {
+	t := c.resolve(stab, expr)
+	if !t.Equals(&BasicType{"void"}) {
+		return t
+	}
+
+	name := ""
+	if call, isCall := expr.(*FuncCall); isCall {
+		name = call.calleeName()
+	}
+
+	stab.AddError(&VoidInExpressionError{
+		Loc:  expr.GetLocation(),
+		Name: name,
+	})
+
+	return &TypeErr{TypeErrVoid}
+}
+
 // addFunction is a shorthand to create a *FuncType entry inside the system table
 func (c *ContextAnalyzer) addFunction(stab *SymbolTable, e *FuncDecl) {
+	stab.Add(e.Name, funcType(e.Results, e.InferredResult))
+}
+
+// funcType returns the type of a function with the named results. A function without named results returns the
+// inferred result, if any.
+func funcType(results []*Param, inferred *BasicType) *FuncType {
+	entry := &FuncType{}
+	// TODO Add arguments
+
+	for _, result := range results {
+		entry.Returns = append(entry.Returns, &BasicType{result.Type})
+	}
+
+	if len(results) == 0 && inferred != nil {
+		entry.Returns = append(entry.Returns, inferred)
+	}
+
+	return entry
+}
+
+// addExtern is a shorthand to create the *FuncType entry of an external function inside the symbol table. The types of
+// the function are not checked, see checkExtern.
+func (c *ContextAnalyzer) addExtern(stab *SymbolTable, e *ExternDecl) {
 	entry := &FuncType{}
-	// TODO Add arguments and returns
+	for _, param := range e.Params {
+		entry.Args = append(entry.Args, &ArgumentType{
+			Name: param.Name,
+			Type: &BasicType{param.Type},
+		})
+	}
+
+	for _, ret := range e.Returns {
+		entry.Returns = append(entry.Returns, &BasicType{ret})
+	}
 
 	stab.Add(e.Name, entry)
 }
 
+// checkExtern reports the parameters and results of an external function whose types are unknown as undefined
+func (c *ContextAnalyzer) checkExtern(stab *SymbolTable, e *ExternDecl) {
+	for _, param := range e.Params {
+		if !isBasicType(param.Type) {
+			stab.AddError(&UndefinedError{
+				Loc:  param.Location,
+				Name: param.Type,
+			})
+		}
+	}
+
+	for _, ret := range e.Returns {
+		if !isBasicType(ret) {
+			stab.AddError(&UndefinedError{
+				Loc:  e.Location,
+				Name: ret,
+			})
+		}
+	}
+}
+
 // isOpDefined returns true if an operation is defined for the type. For example, subtraction is defined for numbers
 // (1-2), but not for strings ("foo"-"bar").
 func (c *ContextAnalyzer) isOpDefined(t Type, op BinaryOp) bool {
@@ -317,15 +1173,84 @@ func (c *ContextAnalyzer) isOpDefined(t Type, op BinaryOp) bool {
 		return false
 	}
 
+	if isBitwiseOp(op) {
+		return c.isIntegerType(t)
+	}
+
 	if t, isBasic := t.(*BasicType); isBasic {
 		if t.Typ == "string" && op != BinaryAddition {
 			return false
 		}
+
+		if t.Typ == "bool" {
+			return false
+		}
 	}
 
 	return true
 }
 
+// isBitwiseOp returns true if the operation works over the bits of integers
+func isBitwiseOp(op BinaryOp) bool {
+	switch op {
+	case BinaryAnd, BinaryOr, BinaryXor, BinaryShiftLeft, BinaryShiftRight:
+		return true
+	default:
+		return false
+	}
+}
+
+// isIntegerType returns true if the provided type is one of the integer types, and false otherwise
+func (c *ContextAnalyzer) isIntegerType(t Type) bool {
+	if t, isBasic := t.(*BasicType); isBasic {
+		_, isInt := intSizes[t.Typ]
+		return isInt
+	}
+
+	return false
+}
+
+// isLiteralOf returns true if the expression is a number literal and its value fits in the provided numeric type.
+// Integer literals fit in floats, but float literals never fit in integers.
+func (c *ContextAnalyzer) isLiteralOf(expr Expr, t Type) bool {
+	lit, isLiteral := expr.(*LiteralExpr)
+	if !isLiteral || lit.Typ != LiteralNumber || isFloatLiteral(lit.Value) {
+		return false
+	}
+
+	if t.Equals(&BasicType{"float"}) {
+		return true
+	}
+
+	if !c.isIntegerType(t) {
+		return false
+	}
+
+	return fitsInt(lit, intSizes[t.(*BasicType).Typ])
+}
+
+// fitsInt returns true if the integer literal fits in a signed integer of the given size in bits
+func fitsInt(lit *LiteralExpr, bits int) bool {
+	v, err := lit.number()
+	n, isInt := v.(int64)
+	if err != nil || !isInt {
+		return false
+	}
+
+	limit := int64(1) << (bits - 1)
+	return bits >= 64 || (n >= -limit && n < limit)
+}
+
+// isFloatLiteral returns true if the value of a number literal describes a floating point number
+func isFloatLiteral(value string) bool {
+	value = strings.TrimPrefix(value, "-")
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		return strings.ContainsAny(value, "pP")
+	}
+
+	return strings.ContainsAny(value, ".eE")
+}
+
 // isErrorType returns true if the provided type is a *TypeErr, and false otherwise
 func (c *ContextAnalyzer) isErrorType(t Type) bool {
 	if _, isErr := t.(*TypeErr); isErr {
@@ -335,6 +1260,18 @@ func (c *ContextAnalyzer) isErrorType(t Type) bool {
 	return false
 }
 
+// isBasicType returns true if the name is one of the builtin basic types
+func isBasicType(name string) bool {
+	_, isInt := intSizes[name]
+	return isInt || name == "float" || name == "string" || name == "bool"
+}
+
+// intSizes maps the name of each integer type to its size in bits
+var intSizes = map[string]int{
+	"int":   32,
+	"int64": 64,
+}
+
 // Type defines the behavior of type. It should at a minimum be stringable and comparable.
 type Type interface {
 	fmt.Stringer
@@ -357,6 +1294,10 @@ const (
 	// TypeErrBadOp occurs when a binary operation is attempted between operands of same type that have an undefined
 	// operation. For example "foo"-"bar".
 	TypeErrBadOp = "bad op"
+	// TypeErrVoid occurs when a call to a function without results is used as a value
+	TypeErrVoid = "void"
+	// TypeErrNotCallable occurs when a value that is not a function is called
+	TypeErrNotCallable = "not callable"
 )
 
 func (t *TypeErr) String() string {
@@ -401,18 +1342,22 @@ func (t *BasicType) Equals(t2 Type) bool {
 	return false
 }
 
+// ArgumentType is a parameter of a function. Its name documents the parameter, but it's not part of the type of the
+// function, so functions that only differ in the names of their parameters have the same type.
 type ArgumentType struct {
 	Name string
 	Type Type
 }
 
+// String returns the type of the argument, without its name
 func (t *ArgumentType) String() string {
 	return t.Type.String()
 }
 
+// Equals returns true if the other argument has the same type, no matter its name
 func (t *ArgumentType) Equals(t2 Type) bool {
 	if typ, ok := t2.(*ArgumentType); ok {
-		return t.Name == typ.Name && t.Type.Equals(typ.Type)
+		return t.Type.Equals(typ.Type)
 	}
 
 	return false
@@ -434,7 +1379,11 @@ func (t *FuncType) String() string {
 			str.WriteString(", ")
 		}
 	}
-	str.WriteString(") ")
+	str.WriteString(")")
+
+	if len(t.Returns) != 0 {
+		str.WriteString(" ")
+	}
 
 	for i, ret := range t.Returns {
 		str.WriteString(ret.String())
@@ -449,21 +1398,17 @@ func (t *FuncType) String() string {
 
 func (t *FuncType) Equals(t2 Type) bool {
 	if typ, ok := t2.(*FuncType); ok {
-		for i, arg := range t.Args {
-			if i >= len(typ.Args) {
-				return false
-			}
+		if len(t.Args) != len(typ.Args) || len(t.Returns) != len(typ.Returns) {
+			return false
+		}
 
+		for i, arg := range t.Args {
 			if !arg.Equals(typ.Args[i]) {
 				return false
 			}
 		}
 
 		for i, ret := range t.Returns {
-			if i >= len(typ.Returns) {
-				return false
-			}
-
 			if !ret.Equals(typ.Returns[i]) {
 				return false
 			}
@@ -475,8 +1420,12 @@ func (t *FuncType) Equals(t2 Type) bool {
 	return false
 }
 
+// CompileError is an error found in the source code while compiling it. Its string describes the error, prefixed by the
+// location where it was found.
 type CompileError interface {
 	fmt.Stringer
+	// GetLocation returns the location of the source code that caused the error. It might be nil if unknown.
+	GetLocation() *Location
 }
 
 type BadExprError struct {
@@ -488,15 +1437,31 @@ func (e BadExprError) String() string {
 	return fmt.Sprintf("%s bad expression: %s", e.Loc, e.Expr.Error)
 }
 
+// GetLocation returns the location of the source code that caused the error
+func (e BadExprError) GetLocation() *Location {
+	return e.Loc
+}
+
 type UndefinedError struct {
 	Loc  *Location
 	Name string
+	// Suggestion is an optional defined name close to the undefined one, that might have been meant instead
+	Suggestion string
 }
 
 func (e UndefinedError) String() string {
+	if e.Suggestion != "" {
+		return fmt.Sprintf("%s undefined: %s (did you mean '%s'?)", e.Loc, e.Name, e.Suggestion)
+	}
+
 	return fmt.Sprintf("%s undefined: %s", e.Loc, e.Name)
 }
 
+// GetLocation returns the location of the source code that caused the error
+func (e UndefinedError) GetLocation() *Location {
+	return e.Loc
+}
+
 type IncompatibleTypesError struct {
 	Loc   *Location
 	Type1 Type
@@ -507,6 +1472,42 @@ func (e IncompatibleTypesError) String() string {
 	return fmt.Sprintf("%s incompatible types: '%s' and '%s'", e.Loc, e.Type1, e.Type2)
 }
 
+// GetLocation returns the location of the source code that caused the error
+func (e IncompatibleTypesError) GetLocation() *Location {
+	return e.Loc
+}
+
+type ChainedComparisonError struct {
+	Loc *Location
+	// Type is the type of the operand compared with the result of the other comparison
+	Type Type
+}
+
+func (e ChainedComparisonError) String() string {
+	return fmt.Sprintf("%s chained comparison: the result of a comparison is a 'bool' and can't be compared with '%s'",
+		e.Loc, e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e ChainedComparisonError) GetLocation() *Location {
+	return e.Loc
+}
+
+type VoidInExpressionError struct {
+	Loc *Location
+	// Name is the name of the called function
+	Name string
+}
+
+func (e VoidInExpressionError) String() string {
+	return fmt.Sprintf("%s void in expression: %s() has no result and can't be used as a value", e.Loc, e.Name)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e VoidInExpressionError) GetLocation() *Location {
+	return e.Loc
+}
+
 type UndefinedOperationError struct {
 	Loc  *Location
 	Type Type
@@ -514,7 +1515,12 @@ type UndefinedOperationError struct {
 }
 
 func (e UndefinedOperationError) String() string {
-	return fmt.Sprintf("%s undefined operation: '%s' has no operand '%s'", e.Loc, e.Type, e.Op)
+	return fmt.Sprintf("%s undefined operation: %s (%s) is not defined for '%s'", e.Loc, e.Op, string(e.Op), e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e UndefinedOperationError) GetLocation() *Location {
+	return e.Loc
 }
 
 type UndefinedUnitaryError struct {
@@ -524,7 +1530,222 @@ type UndefinedUnitaryError struct {
 }
 
 func (e UndefinedUnitaryError) String() string {
-	return fmt.Sprintf("%s undefined operation: '%s' has no operand '%s'", e.Loc, e.Type, e.Op)
+	return fmt.Sprintf("%s undefined operation: %s (%s) is not defined for '%s'", e.Loc, e.Op, string(e.Op), e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e UndefinedUnitaryError) GetLocation() *Location {
+	return e.Loc
+}
+
+type ConditionTypeError struct {
+	Loc  *Location
+	Type Type
+}
+
+func (e ConditionTypeError) String() string {
+	return fmt.Sprintf("%s non-boolean condition: '%s' used as a condition", e.Loc, e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e ConditionTypeError) GetLocation() *Location {
+	return e.Loc
+}
+
+type DeferNotCallError struct {
+	Loc *Location
+}
+
+func (e DeferNotCallError) String() string {
+	return fmt.Sprintf("%s defer requires a function call", e.Loc)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e DeferNotCallError) GetLocation() *Location {
+	return e.Loc
+}
+
+type TopLevelExpressionError struct {
+	Loc *Location
+}
+
+func (e TopLevelExpressionError) String() string {
+	return fmt.Sprintf("%s top-level expression: only declarations are allowed outside of a function", e.Loc)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e TopLevelExpressionError) GetLocation() *Location {
+	return e.Loc
+}
+
+type BlankIdentifierError struct {
+	Loc *Location
+}
+
+func (e BlankIdentifierError) String() string {
+	return fmt.Sprintf("%s blank identifier: '_' can only be declared, and can't be used as a value", e.Loc)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e BlankIdentifierError) GetLocation() *Location {
+	return e.Loc
+}
+
+type NotCallableError struct {
+	Loc *Location
+	// Name is the name of the called value
+	Name string
+	// Type is the type of the called value
+	Type Type
+}
+
+func (e NotCallableError) String() string {
+	return fmt.Sprintf("%s not callable: '%s' of type '%s' is not a function", e.Loc, e.Name, e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e NotCallableError) GetLocation() *Location {
+	return e.Loc
+}
+
+type ArgumentCountError struct {
+	Loc *Location
+	// Name is the name of the called function
+	Name string
+	// Want is the number of arguments the function takes
+	Want int
+	// Got is the number of arguments it was called with
+	Got int
+}
+
+func (e ArgumentCountError) String() string {
+	arguments := "arguments"
+	if e.Want == 1 {
+		arguments = "argument"
+	}
+
+	return fmt.Sprintf("%s argument mismatch: %s() takes %d %s but %d were given", e.Loc, e.Name, e.Want, arguments,
+		e.Got)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e ArgumentCountError) GetLocation() *Location {
+	return e.Loc
+}
+
+type AssignmentCountError struct {
+	Loc *Location
+	// Names is the number of declared variables
+	Names int
+	// Values is the number of values assigned to them
+	Values int
+}
+
+func (e AssignmentCountError) String() string {
+	values := "values"
+	if e.Values == 1 {
+		values = "value"
+	}
+
+	return fmt.Sprintf("%s assignment mismatch: %d variables but %d %s", e.Loc, e.Names, e.Values, values)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e AssignmentCountError) GetLocation() *Location {
+	return e.Loc
+}
+
+type ReturnMismatchError struct {
+	Loc *Location
+	// Want is the type returned before by the function, or the type of its named result. It's void if the function
+	// returned no value.
+	Want Type
+	// Got is the type of the returned value, void for a bare return
+	Got Type
+}
+
+func (e ReturnMismatchError) String() string {
+	return fmt.Sprintf("%s return mismatch: returning '%s', but the function returns '%s'", e.Loc, e.Got, e.Want)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e ReturnMismatchError) GetLocation() *Location {
+	return e.Loc
+}
+
+type ReturnTypeError struct {
+	Loc *Location
+	// Type is the type of the returned value
+	Type Type
+}
+
+func (e ReturnTypeError) String() string {
+	return fmt.Sprintf("%s unsupported result: a value of type '%s' can't be returned", e.Loc, e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e ReturnTypeError) GetLocation() *Location {
+	return e.Loc
+}
+
+type InitializationCycleError struct {
+	Loc *Location
+	// Name is the name of the variable that depends on itself
+	Name string
+}
+
+func (e InitializationCycleError) String() string {
+	return fmt.Sprintf("%s initialization cycle: the value of '%s' refers to itself", e.Loc, e.Name)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e InitializationCycleError) GetLocation() *Location {
+	return e.Loc
+}
+
+type InterpolationTypeError struct {
+	Loc  *Location
+	Type Type
+}
+
+func (e InterpolationTypeError) String() string {
+	return fmt.Sprintf("%s invalid interpolation: '%s' can't be interpolated into a string", e.Loc, e.Type)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e InterpolationTypeError) GetLocation() *Location {
+	return e.Loc
+}
+
+type ImportError struct {
+	Loc  *Location
+	Path string
+	// Err describes why the module couldn't be imported
+	Err string
+}
+
+func (e ImportError) String() string {
+	return fmt.Sprintf("%s can't import \"%s\": %s", e.Loc, e.Path, e.Err)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e ImportError) GetLocation() *Location {
+	return e.Loc
+}
+
+type UnexportedSymbolError struct {
+	Loc *Location
+	// Name is the qualified name of the symbol (module.name)
+	Name string
+}
+
+func (e UnexportedSymbolError) String() string {
+	return fmt.Sprintf("%s unexported: %s is not exported by its module", e.Loc, e.Name)
+}
+
+// GetLocation returns the location of the source code that caused the error
+func (e UnexportedSymbolError) GetLocation() *Location {
+	return e.Loc
 }
 
 // SymbolTable keeps a list of definitions and types inside a code context. It also hold all related errors generated
@@ -536,22 +1757,15 @@ type SymbolTable struct {
 	Errors []CompileError
 }
 
-// NewGlobalSymbolTable crates a new symbol table with global definitions prepopulated
+// NewGlobalSymbolTable crates a new symbol table with global definitions prepopulated. The global definitions are the
+// builtin functions.
 func NewGlobalSymbolTable() *SymbolTable {
-	// TODO: Move the creation of global definitions elsewhere
-	return &SymbolTable{
-		Entries: map[string]Type{
-			"print": &FuncType{
-				Args: []*ArgumentType{
-					{
-						Name: "v",
-						Type: &AnyType{},
-					},
-				},
-				Returns: nil,
-			},
-		},
+	stab := NewSymbolTable()
+	for name, b := range builtins {
+		stab.Add(name, b.typ)
 	}
+
+	return stab
 }
 
 // NewSymbolTable creates a new empty symbol table
@@ -590,7 +1804,10 @@ func (t *SymbolTable) Import(t2 SymbolTable) {
 
 // Copy creates a new table and copies all entries and errors into it
 func (t *SymbolTable) Copy() *SymbolTable {
-	t2 := NewSymbolTable()
+	// Tables are copied for every statement, so the map is sized upfront instead of growing while it's filled
+	t2 := &SymbolTable{
+		Entries: make(map[string]Type, len(t.Entries)),
+	}
 
 	if t.Errors != nil {
 		t2.Errors = make([]CompileError, len(t.Errors))
@@ -604,6 +1821,83 @@ func (t *SymbolTable) Copy() *SymbolTable {
 	return t2
 }
 
+// Dump renders the table as a human-readable list of entries, one per line, with the name and type of each entry. The
+// entries are sorted by name.
+func (t *SymbolTable) Dump() string {
+	names := make([]string, 0, len(t.Entries))
+	for name := range t.Entries {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var str strings.Builder
+	w := tabwriter.NewWriter(&str, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(w, "%s\t%s\n", name, t.Entries[name])
+	}
+
+	_ = w.Flush()
+	return str.String()
+}
+
+// Suggest returns the name of the entry closest to the provided name, measured by their edit distance. It's meant to
+// point out typos, so an empty string is returned if no entry is close enough. Ties are broken alphabetically.
+func (t *SymbolTable) Suggest(name string) string {
+	// Allow one edit for every three characters, up to a maximum
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance > 3 {
+		maxDistance = 3
+	}
+
+	best, bestDistance := "", maxDistance+1
+	for entry := range t.Entries {
+		d := editDistance(name, entry)
+		if d < bestDistance || (d == bestDistance && entry < best) {
+			best, bestDistance = entry, d
+		}
+	}
+
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings, that is, the minimum number of single rune
+// insertions, deletions or substitutions needed to turn one into the other.
+func editDistance(a, b string) int {
+	r1, r2 := []rune(a), []rune(b)
+
+	prev := make([]int, len(r2)+1)
+	curr := make([]int, len(r2)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(r1); i++ {
+		curr[0] = i
+		for j := 1; j <= len(r2); j++ {
+			cost := 1
+			if r1[i-1] == r2[j-1] {
+				cost = 0
+			}
+
+			curr[j] = minInt(prev[j]+1, minInt(curr[j-1]+1, prev[j-1]+cost))
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(r2)]
+}
+
+// minInt returns the smallest of two integers
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
 // AddError adds a new error to the table's error list
 func (t *SymbolTable) AddError(err CompileError) {
 	t.Errors = append(t.Errors, err)
@@ -1,6 +1,8 @@
 package maqui
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,6 +39,30 @@ func (b *ParserMocker) GetFilename() string {
 	return "testing"
 }
 
+// analyze runs the context analysis over the source code, configuring the analyzer with the given options, and returns
+// the resulting AST along with the global scope
+func analyze(src string, options ...func(analyzer *ContextAnalyzer)) (*AST, *SymbolTable) {
+	analyzer := NewContextAnalyser(NewParser(NewLexerFromReader(strings.NewReader(src))))
+	for _, option := range options {
+		option(analyzer)
+	}
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+
+	return analyzer.Do(global), global
+}
+
+// errorMessages returns the messages of the errors found in the AST, without their locations
+func errorMessages(ast *AST) []string {
+	var errs []string
+	for _, err := range ast.Errors {
+		errs = append(errs, strings.SplitN(err.String(), " ", 2)[1])
+	}
+
+	return errs
+}
+
 func TestContextAnalyzer(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -176,8 +202,8 @@ func TestContextAnalyzer(t *testing.T) {
 					Body: []Expr{},
 				},
 				&FuncCall{
-					Name: "foo",
-					Args: []Expr{},
+					Callee: &Identifier{Name: "foo"},
+					Args:   []Expr{},
 				},
 			},
 			&AST{
@@ -195,8 +221,8 @@ func TestContextAnalyzer(t *testing.T) {
 					},
 					{
 						Expr: &FuncCall{
-							Name: "foo",
-							Args: []Expr{},
+							Callee: &Identifier{Name: "foo"},
+							Args:   []Expr{},
 						},
 						Stab: &SymbolTable{
 							Entries: map[string]Type{
@@ -217,16 +243,16 @@ func TestContextAnalyzer(t *testing.T) {
 			"FunctionCallUndefined",
 			[]Expr{
 				&FuncCall{
-					Name: "foo",
-					Args: []Expr{},
+					Callee: &Identifier{Name: "foo"},
+					Args:   []Expr{},
 				},
 			},
 			&AST{
 				Statements: []*AnnotatedExpr{
 					{
 						Expr: &FuncCall{
-							Name: "foo",
-							Args: []Expr{},
+							Callee: &Identifier{Name: "foo"},
+							Args:   []Expr{},
 						},
 						Stab: &SymbolTable{
 							Entries: map[string]Type{},
@@ -346,6 +372,77 @@ func TestContextAnalyzer(t *testing.T) {
 				Global: NewSymbolTable(),
 			},
 		},
+		{
+			"BitwiseNotString",
+			[]Expr{
+				&UnaryExpr{
+					Operation: UnaryBitwiseNot,
+					Operand:   &LiteralExpr{Typ: LiteralString, Value: "s"},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &UnaryExpr{
+							Operation: UnaryBitwiseNot,
+							Operand:   &LiteralExpr{Typ: LiteralString, Value: "s"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{},
+							Errors: []CompileError{
+								&UndefinedUnitaryError{
+									Type: &BasicType{"string"},
+									Op:   UnaryBitwiseNot,
+								},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedUnitaryError{
+						Type: &BasicType{"string"},
+						Op:   UnaryBitwiseNot,
+					},
+				},
+				Global: NewSymbolTable(),
+			},
+		},
+		{
+			"BitwiseNotInt",
+			[]Expr{
+				&VariableDecl{
+					Name: "x",
+					Value: &UnaryExpr{
+						Operation: UnaryBitwiseNot,
+						Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "5"},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &VariableDecl{
+							Name: "x",
+							Value: &UnaryExpr{
+								Operation: UnaryBitwiseNot,
+								Operand:   &LiteralExpr{Typ: LiteralNumber, Value: "5"},
+							},
+							ResolvedType: &BasicType{"int"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"x": &BasicType{"int"},
+							},
+						},
+					},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"x": &BasicType{"int"},
+					},
+				},
+			},
+		},
 		{
 			"StringSubtraction",
 			[]Expr{
@@ -395,6 +492,97 @@ func TestContextAnalyzer(t *testing.T) {
 				Global: NewGlobalSymbolTable(),
 			},
 		},
+		{
+			"FloatBitwiseAnd",
+			[]Expr{
+				&BinaryExpr{
+					Operation: BinaryAnd,
+					Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1.5"},
+					Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &BinaryExpr{
+							Operation: BinaryAnd,
+							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1.5"},
+							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{},
+							Errors: []CompileError{
+								&UndefinedOperationError{
+									Type: &BasicType{"float"},
+									Op:   BinaryAnd,
+								},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedOperationError{
+						Type: &BasicType{"float"},
+						Op:   BinaryAnd,
+					},
+				},
+				Global: NewGlobalSymbolTable(),
+			},
+		},
+		{
+			"IntBitwise",
+			[]Expr{
+				&VariableDecl{
+					Name: "x",
+					Value: &BinaryExpr{
+						Operation: BinaryOr,
+						Op1: &BinaryExpr{
+							Operation: BinaryAnd,
+							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+						},
+						Op2: &BinaryExpr{
+							Operation: BinaryShiftLeft,
+							Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+							Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "4"},
+						},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &VariableDecl{
+							Name: "x",
+							Value: &BinaryExpr{
+								Operation: BinaryOr,
+								Op1: &BinaryExpr{
+									Operation: BinaryAnd,
+									Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+									Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "2"},
+								},
+								Op2: &BinaryExpr{
+									Operation: BinaryShiftLeft,
+									Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+									Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "4"},
+								},
+							},
+							ResolvedType: &BasicType{"int"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"x": &BasicType{"int"},
+							},
+						},
+					},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"x": &BasicType{"int"},
+					},
+				},
+			},
+		},
 		{
 			"VarIntLiteralSum",
 			[]Expr{
@@ -541,119 +729,671 @@ func TestContextAnalyzer(t *testing.T) {
 				},
 			},
 		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			parser := NewParserMocker(c.data)
-			analyzer := NewContextAnalyser(parser)
-
-			c.expect.Filename = parser.GetFilename()
-
-			global := NewGlobalSymbolTable()
-			analyzer.DefineInto(global)
-			global.Errors = nil
-
-			// Bring global definitions into the expected global table
-			c.expect.Global.Import(*NewGlobalSymbolTable())
-			for _, ae := range c.expect.Statements {
-				ae.Stab.Import(*NewGlobalSymbolTable())
-			}
-
-			got := analyzer.Do(global)
-			if !assert.Equal(t, c.expect, got) {
-				assert.Fail(t, "Unexpected")
-			}
-		})
-	}
-}
-
-func TestTypeEquals(t *testing.T) {
-	tInt1 := &BasicType{"int"}
-	tInt2 := &BasicType{"int"}
-	tStr := &BasicType{"string"}
-
-	tFunc1 := &FuncType{
-		Args: []*ArgumentType{
-			{
-				Name: "arg1",
-				Type: tInt1,
-			},
-		},
-		Returns: []*BasicType{tStr},
-	}
-
-	tFunc2 := &FuncType{
-		Args: []*ArgumentType{
-			{
-				Name: "arg1",
-				Type: tInt1,
-			},
-		},
-		Returns: []*BasicType{tStr},
-	}
-
-	tFunc3 := &FuncType{
-		Args: []*ArgumentType{
-			{
-				Name: "arg1",
-				Type: tInt1,
-			},
-		},
-		Returns: []*BasicType{tInt1},
-	}
-
-	assert.True(t, tInt1.Equals(tInt2))
-	assert.True(t, tInt2.Equals(tInt1))
-	assert.False(t, tStr.Equals(tInt1))
-	assert.False(t, tInt1.Equals(tStr))
-	assert.False(t, tFunc1.Equals(tStr))
-	assert.True(t, tFunc1.Equals(tFunc2))
-	assert.True(t, tFunc2.Equals(tFunc1))
-	assert.False(t, tFunc2.Equals(tFunc3))
-	assert.False(t, tFunc1.Equals(tFunc3))
-}
-
-func TestTypeString(t *testing.T) {
-	tInt := &BasicType{"int"}
-	tFunc := &FuncType{
-		Args: []*ArgumentType{
-			{
-				Name: "arg1",
-				Type: &BasicType{"string"},
-			},
-			{
-				Name: "arg2",
-				Type: &BasicType{"int"},
-			},
-		},
-		Returns: []*BasicType{
-			{"string"},
-			{"int"},
-		},
-	}
-
-	assert.Equal(t, "int", tInt.String())
-	assert.Equal(t, "func(string, int) string, int", tFunc.String())
-}
-
-func TestStabCopy(t *testing.T) {
-	stab := &SymbolTable{
-		Entries: map[string]Type{
-			"foo": &BasicType{"int"},
-			"bar": &FuncType{
-				Args: []*ArgumentType{
-					{
-						Name: "arg1",
-						Type: &BasicType{"string"},
+		{
+			"VarInt64Literal",
+			[]Expr{
+				&VariableDecl{
+					Name: "x",
+					Value: &LiteralExpr{
+						Typ:   LiteralNumber,
+						Value: "5000000000",
 					},
 				},
-				Returns: []*BasicType{
-					{"string"},
-					{"int"},
+				&VariableDecl{
+					Name: "y",
+					Value: &BinaryExpr{
+						Operation: BinaryAddition,
+						Op1: &Identifier{
+							Name: "x",
+						},
+						Op2: &LiteralExpr{
+							Typ:   LiteralNumber,
+							Value: "1",
+						},
+					},
 				},
 			},
-		},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &VariableDecl{
+							Name: "x",
+							Value: &LiteralExpr{
+								Typ:   LiteralNumber,
+								Value: "5000000000",
+							},
+							ResolvedType: &BasicType{"int64"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"x": &BasicType{"int64"},
+								"y": &BasicType{"int64"},
+							},
+						},
+					},
+					{
+						Expr: &VariableDecl{
+							Name: "y",
+							Value: &BinaryExpr{
+								Operation: BinaryAddition,
+								Op1: &Identifier{
+									Name: "x",
+								},
+								Op2: &LiteralExpr{
+									Typ:   LiteralNumber,
+									Value: "1",
+								},
+							},
+							ResolvedType: &BasicType{"int64"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"x": &BasicType{"int64"},
+								"y": &BasicType{"int64"},
+							},
+						},
+					},
+				},
+				Errors: nil,
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"x": &BasicType{"int64"},
+						"y": &BasicType{"int64"},
+					},
+				},
+			},
+		},
+		{
+			"UntypedLiteralWidening",
+			[]Expr{
+				&VariableDecl{
+					Name: "x",
+					Value: &BinaryExpr{
+						Operation: BinaryAddition,
+						Op1: &LiteralExpr{
+							Typ:   LiteralNumber,
+							Value: "1",
+						},
+						Op2: &LiteralExpr{
+							Typ:   LiteralNumber,
+							Value: "5000000000",
+						},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &VariableDecl{
+							Name: "x",
+							Value: &BinaryExpr{
+								Operation: BinaryAddition,
+								Op1: &LiteralExpr{
+									Typ:   LiteralNumber,
+									Value: "1",
+								},
+								Op2: &LiteralExpr{
+									Typ:   LiteralNumber,
+									Value: "5000000000",
+								},
+							},
+							ResolvedType: &BasicType{"int64"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"x": &BasicType{"int64"},
+							},
+						},
+					},
+				},
+				Errors: nil,
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"x": &BasicType{"int64"},
+					},
+				},
+			},
+		},
+		{
+			"ExternCall",
+			[]Expr{
+				&ExternDecl{
+					Name:    "puts",
+					Params:  []*Param{{Name: "s", Type: "string"}},
+					Returns: []string{"int"},
+				},
+				&VariableDecl{
+					Name: "x",
+					Value: &FuncCall{
+						Callee: &Identifier{Name: "puts"},
+						Args:   []Expr{&LiteralExpr{Typ: LiteralString, Value: "hi"}},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &ExternDecl{
+							Name:    "puts",
+							Params:  []*Param{{Name: "s", Type: "string"}},
+							Returns: []string{"int"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"puts": &FuncType{
+									Args:    []*ArgumentType{{Name: "s", Type: &BasicType{"string"}}},
+									Returns: []*BasicType{{"int"}},
+								},
+								"x": &BasicType{"int"},
+							},
+						},
+					},
+					{
+						Expr: &VariableDecl{
+							Name: "x",
+							Value: &FuncCall{
+								Callee:        &Identifier{Name: "puts"},
+								Args:          []Expr{&LiteralExpr{Typ: LiteralString, Value: "hi"}},
+								ResolvedTypes: []Type{&BasicType{"string"}},
+							},
+							ResolvedType: &BasicType{"int"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"puts": &FuncType{
+									Args:    []*ArgumentType{{Name: "s", Type: &BasicType{"string"}}},
+									Returns: []*BasicType{{"int"}},
+								},
+								"x": &BasicType{"int"},
+							},
+						},
+					},
+				},
+				Errors: nil,
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"puts": &FuncType{
+							Args:    []*ArgumentType{{Name: "s", Type: &BasicType{"string"}}},
+							Returns: []*BasicType{{"int"}},
+						},
+						"x": &BasicType{"int"},
+					},
+				},
+			},
+		},
+		{
+			"NestedCallUndefined",
+			[]Expr{
+				&FuncCall{
+					Callee: &Identifier{Name: "print"},
+					Args:   []Expr{&FuncCall{Callee: &Identifier{Name: "undefinedFunc"}}},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &FuncCall{
+							Callee:        &Identifier{Name: "print"},
+							Args:          []Expr{&FuncCall{Callee: &Identifier{Name: "undefinedFunc"}}},
+							ResolvedTypes: []Type{&TypeErr{TypeErrUndefined}},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{},
+							Errors: []CompileError{
+								&UndefinedError{Name: "undefinedFunc"},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedError{Name: "undefinedFunc"},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{},
+				},
+			},
+		},
+		{
+			"BoolVariable",
+			[]Expr{
+				&VariableDecl{
+					Name: "b",
+					Value: &BooleanExpr{
+						Operation: BooleanEquals,
+						Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+					},
+				},
+				&BinaryExpr{
+					Operation: BinaryAddition,
+					Op1:       &Identifier{Name: "b"},
+					Op2:       &LiteralExpr{Typ: LiteralBool, Value: "true"},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &VariableDecl{
+							Name: "b",
+							Value: &BooleanExpr{
+								Operation: BooleanEquals,
+								Op1:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+								Op2:       &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+							},
+							ResolvedType: &BasicType{"bool"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"b": &BasicType{"bool"},
+							},
+						},
+					},
+					{
+						Expr: &BinaryExpr{
+							Operation: BinaryAddition,
+							Op1:       &Identifier{Name: "b"},
+							Op2:       &LiteralExpr{Typ: LiteralBool, Value: "true"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"b": &BasicType{"bool"},
+							},
+							Errors: []CompileError{
+								&UndefinedOperationError{
+									Type: &BasicType{"bool"},
+									Op:   BinaryAddition,
+								},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedOperationError{
+						Type: &BasicType{"bool"},
+						Op:   BinaryAddition,
+					},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"b": &BasicType{"bool"},
+					},
+				},
+			},
+		},
+		{
+			"IfBodyUndefined",
+			[]Expr{
+				&FuncDecl{
+					Name: "main",
+					Body: []Expr{
+						&IfExpr{
+							Condition: &LiteralExpr{Typ: LiteralBool, Value: "true"},
+							Consequent: []Expr{
+								&VariableDecl{
+									Name:  "x",
+									Value: &Identifier{Name: "y"},
+								},
+							},
+						},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &FuncDecl{
+							Name: "main",
+							Body: []Expr{
+								&IfExpr{
+									Condition: &LiteralExpr{Typ: LiteralBool, Value: "true"},
+									Consequent: []Expr{
+										&VariableDecl{
+											Name:         "x",
+											Value:        &Identifier{Name: "y"},
+											ResolvedType: &TypeErr{TypeErrUndefined},
+										},
+									},
+								},
+							},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"main": &FuncType{},
+							},
+							Errors: []CompileError{
+								&UndefinedError{Name: "y"},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedError{Name: "y"},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"main": &FuncType{},
+					},
+				},
+			},
+		},
+		{
+			"BareBlockScope",
+			[]Expr{
+				&FuncDecl{
+					Name: "main",
+					Body: []Expr{
+						&BlockExpr{
+							Body: []Expr{
+								&VariableDecl{
+									Name:  "x",
+									Value: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+								},
+							},
+						},
+						&Identifier{Name: "x"},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &FuncDecl{
+							Name: "main",
+							Body: []Expr{
+								&BlockExpr{
+									Body: []Expr{
+										&VariableDecl{
+											Name:         "x",
+											Value:        &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+											ResolvedType: &BasicType{"int"},
+										},
+									},
+								},
+								&Identifier{Name: "x"},
+							},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"main": &FuncType{},
+							},
+							Errors: []CompileError{
+								&UndefinedError{Name: "x"},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedError{Name: "x"},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"main": &FuncType{},
+					},
+				},
+			},
+		},
+		{
+			"ConditionalTypes",
+			[]Expr{
+				&FuncDecl{
+					Name: "main",
+					Body: []Expr{
+						&VariableDecl{
+							Name: "x",
+							Value: &ConditionalExpr{
+								Condition:   &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+								Consequent:  &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+								Alternative: &LiteralExpr{Typ: LiteralString, Value: "a"},
+							},
+						},
+					},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &FuncDecl{
+							Name: "main",
+							Body: []Expr{
+								&VariableDecl{
+									Name: "x",
+									Value: &ConditionalExpr{
+										Condition:   &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+										Consequent:  &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+										Alternative: &LiteralExpr{Typ: LiteralString, Value: "a"},
+									},
+									ResolvedType: &TypeErr{TypeErrIncompatible},
+								},
+							},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"main": &FuncType{},
+								"x":    &TypeErr{TypeErrIncompatible},
+							},
+							Errors: []CompileError{
+								&ConditionTypeError{Type: &BasicType{"int"}},
+								&IncompatibleTypesError{Type1: &BasicType{"int"}, Type2: &BasicType{"string"}},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&ConditionTypeError{Type: &BasicType{"int"}},
+					&IncompatibleTypesError{Type1: &BasicType{"int"}, Type2: &BasicType{"string"}},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"main": &FuncType{},
+					},
+				},
+			},
+		},
+		{
+			"IfNonBoolCondition",
+			[]Expr{
+				&IfExpr{
+					Condition: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &IfExpr{
+							Condition: &LiteralExpr{Typ: LiteralNumber, Value: "1"},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{},
+							Errors: []CompileError{
+								&ConditionTypeError{Type: &BasicType{"int"}},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&ConditionTypeError{Type: &BasicType{"int"}},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{},
+				},
+			},
+		},
+		{
+			"ExternUnknownType",
+			[]Expr{
+				&ExternDecl{
+					Name:   "foo",
+					Params: []*Param{{Name: "v", Type: "bar"}},
+				},
+			},
+			&AST{
+				Statements: []*AnnotatedExpr{
+					{
+						Expr: &ExternDecl{
+							Name:   "foo",
+							Params: []*Param{{Name: "v", Type: "bar"}},
+						},
+						Stab: &SymbolTable{
+							Entries: map[string]Type{
+								"foo": &FuncType{
+									Args: []*ArgumentType{{Name: "v", Type: &BasicType{"bar"}}},
+								},
+							},
+							Errors: []CompileError{
+								&UndefinedError{Name: "bar"},
+							},
+						},
+					},
+				},
+				Errors: []CompileError{
+					&UndefinedError{Name: "bar"},
+				},
+				Global: &SymbolTable{
+					Entries: map[string]Type{
+						"foo": &FuncType{
+							Args: []*ArgumentType{{Name: "v", Type: &BasicType{"bar"}}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			parser := NewParserMocker(c.data)
+			analyzer := NewContextAnalyser(parser)
+			// Most cases check the typing of bare expressions
+			analyzer.AllowTopLevelExpressions(true)
+
+			c.expect.Filename = parser.GetFilename()
+
+			global := NewGlobalSymbolTable()
+			analyzer.DefineInto(global)
+			global.Errors = nil
+
+			// Bring global definitions into the expected global table
+			c.expect.Global.Import(*NewGlobalSymbolTable())
+			for _, ae := range c.expect.Statements {
+				ae.Stab.Import(*NewGlobalSymbolTable())
+			}
+
+			got := analyzer.Do(global)
+			if !assert.Equal(t, c.expect, got) {
+				assert.Fail(t, "Unexpected")
+			}
+		})
+	}
+}
+
+func TestTypeEquals(t *testing.T) {
+	tInt1 := &BasicType{"int"}
+	tInt2 := &BasicType{"int"}
+	tStr := &BasicType{"string"}
+
+	tFunc1 := &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "arg1",
+				Type: tInt1,
+			},
+		},
+		Returns: []*BasicType{tStr},
+	}
+
+	tFunc2 := &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "arg1",
+				Type: tInt1,
+			},
+		},
+		Returns: []*BasicType{tStr},
+	}
+
+	tFunc3 := &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "arg1",
+				Type: tInt1,
+			},
+		},
+		Returns: []*BasicType{tInt1},
+	}
+
+	assert.True(t, tInt1.Equals(tInt2))
+	assert.True(t, tInt2.Equals(tInt1))
+	assert.False(t, tStr.Equals(tInt1))
+	assert.False(t, tInt1.Equals(tStr))
+	assert.False(t, tFunc1.Equals(tStr))
+	assert.True(t, tFunc1.Equals(tFunc2))
+	assert.True(t, tFunc2.Equals(tFunc1))
+	assert.False(t, tFunc2.Equals(tFunc3))
+	assert.False(t, tFunc1.Equals(tFunc3))
+
+	// Extra arguments or results make the signatures differ
+	tFunc4 := &FuncType{}
+	assert.False(t, tFunc4.Equals(tFunc1))
+	assert.False(t, tFunc1.Equals(tFunc4))
+
+	// The names of the parameters are not part of the type, but their types are
+	tFunc5 := &FuncType{
+		Args:    []*ArgumentType{{Name: "other", Type: tInt2}},
+		Returns: []*BasicType{tStr},
+	}
+
+	tFunc6 := &FuncType{
+		Args:    []*ArgumentType{{Name: "arg1", Type: tStr}},
+		Returns: []*BasicType{tStr},
+	}
+
+	assert.True(t, tFunc1.Equals(tFunc5))
+	assert.True(t, tFunc5.Equals(tFunc1))
+	assert.Equal(t, tFunc1.String(), tFunc5.String())
+	assert.False(t, tFunc1.Equals(tFunc6))
+	assert.False(t, tFunc6.Equals(tFunc1))
+}
+
+func TestTypeString(t *testing.T) {
+	tInt := &BasicType{"int"}
+	tFunc := &FuncType{
+		Args: []*ArgumentType{
+			{
+				Name: "arg1",
+				Type: &BasicType{"string"},
+			},
+			{
+				Name: "arg2",
+				Type: &BasicType{"int"},
+			},
+		},
+		Returns: []*BasicType{
+			{"string"},
+			{"int"},
+		},
+	}
+
+	assert.Equal(t, "int", tInt.String())
+	assert.Equal(t, "func(string, int) string, int", tFunc.String())
+}
+
+func TestStabCopy(t *testing.T) {
+	stab := &SymbolTable{
+		Entries: map[string]Type{
+			"foo": &BasicType{"int"},
+			"bar": &FuncType{
+				Args: []*ArgumentType{
+					{
+						Name: "arg1",
+						Type: &BasicType{"string"},
+					},
+				},
+				Returns: []*BasicType{
+					{"string"},
+					{"int"},
+				},
+			},
+		},
 		Errors: []CompileError{
 			UndefinedOperationError{
 				Type: &BasicType{"string"},
@@ -662,5 +1402,638 @@ func TestStabCopy(t *testing.T) {
 		},
 	}
 
-	assert.Equal(t, stab, stab.Copy())
+	assert.Equal(t, stab, stab.Copy())
+}
+
+func TestStabDump(t *testing.T) {
+	stab := NewGlobalSymbolTable()
+	stab.Add("foo", &BasicType{"int"})
+
+	dump := stab.Dump()
+	assert.Contains(t, dump, "print    func(~any)\n")
+	assert.Equal(t, "abort    func()\nassert   func(bool)\nfoo      int\nformat   func(string)\npanic    func(string)\nprint    func(~any)\nprintln  func(~any)\n", dump)
+}
+
+func TestStabSuggest(t *testing.T) {
+	stab := NewGlobalSymbolTable()
+	stab.Add("counter", &BasicType{"int"})
+
+	assert.Equal(t, "print", stab.Suggest("prnt"))
+	assert.Equal(t, "println", stab.Suggest("pritnln"))
+	assert.Equal(t, "counter", stab.Suggest("conuter"))
+	assert.Equal(t, "", stab.Suggest("somethingElse"))
+	assert.Equal(t, "", stab.Suggest("x"))
+}
+
+func TestUndefinedSuggestion(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+	}{
+		{"Typo", "func main() {\nprnt(1)\n}", "undefined: prnt (did you mean 'print'?)"},
+		{"Unrelated", "func main() {\nsomethingElse(1)\n}", "undefined: somethingElse"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			if assert.Len(t, ast.Errors, 1) {
+				assert.True(t, strings.HasSuffix(ast.Errors[0].String(), " "+c.expect), ast.Errors[0].String())
+			}
+		})
+	}
+}
+
+func TestErrorsSorted(t *testing.T) {
+	// The global definitions are analyzed before the function bodies, so the error of bar is found before the one of foo
+	src := "func main() {\nfoo()\n}\nx := bar\n"
+
+	ast, _ := analyze(src)
+	if !assert.NotEmpty(t, ast.Errors) {
+		return
+	}
+
+	assert.Equal(t, "foo", ast.Errors[0].(*UndefinedError).Name)
+	for i := 1; i < len(ast.Errors); i++ {
+		assert.LessOrEqual(t, ast.Errors[i-1].GetLocation().Start, ast.Errors[i].GetLocation().Start)
+	}
+}
+
+func TestSortErrors(t *testing.T) {
+	errs := []CompileError{
+		&UndefinedError{Name: "builtin"},
+		&UndefinedError{Name: "b2", Loc: &Location{File: "b.mq", Start: 2}},
+		&UndefinedError{Name: "a9", Loc: &Location{File: "a.mq", Start: 9}},
+		&UndefinedError{Name: "b1", Loc: &Location{File: "b.mq", Start: 1}},
+		&UndefinedError{Name: "a1", Loc: &Location{File: "a.mq", Start: 1}},
+		&InternalError{Msg: "internal"},
+	}
+
+	sortErrors(errs)
+
+	var order []string
+	for _, err := range errs {
+		switch e := err.(type) {
+		case *UndefinedError:
+			order = append(order, e.Name)
+		case *InternalError:
+			order = append(order, e.Msg)
+		}
+	}
+
+	assert.Equal(t, []string{"a1", "a9", "b1", "b2", "builtin", "internal"}, order)
+}
+
+// ModuleLoaderMocker loads modules from in-memory sources, mapped by their path
+type ModuleLoaderMocker map[string]string
+
+func (m ModuleLoaderMocker) Load(path string) (*Module, error) {
+	src, ok := m[path]
+	if !ok {
+		return nil, fmt.Errorf("no such file")
+	}
+
+	ast, _ := analyze(src)
+	return &Module{
+		Name: strings.TrimSuffix(path, ".mq"),
+		AST:  ast,
+	}, nil
+}
+
+func TestImport(t *testing.T) {
+	loader := ModuleLoaderMocker{
+		"util.mq": "export func foo() {\nprint(1)\n}\nfunc bar() {}\nx := 1",
+	}
+
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Call", "import \"util.mq\"\nfunc main() {\nutil.foo()\n}", nil},
+		{"UnqualifiedCall", "import \"util.mq\"\nfunc main() {\nfoo()\n}", []string{"undefined: foo"}},
+		{"Variable", "import \"util.mq\"\nfunc main() {\nprint(util.x)\n}", []string{"undefined: util.x"}},
+		{"Unexported", "import \"util.mq\"\nfunc main() {\nutil.bar()\n}", []string{"unexported: util.bar is not exported by its module"}},
+		{"Undefined", "import \"util.mq\"\nfunc main() {\nutil.baz()\n}", []string{"undefined: util.baz"}},
+		{"MissingFile", "import \"missing.mq\"", []string{`can't import "missing.mq": no such file`}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src, func(analyzer *ContextAnalyzer) {
+				analyzer.SetModuleLoader(loader)
+			})
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+
+	// Without a loader imports can't be resolved
+	ast, _ := analyze("import \"util.mq\"")
+	if assert.Len(t, ast.Errors, 1) {
+		assert.IsType(t, &ImportError{}, ast.Errors[0])
+	}
+}
+
+func TestUndefinedOperationString(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+	}{
+		{"Binary", `x := "foo" - "bar"`, "undefined operation: subtraction (-) is not defined for 'string'"},
+		{"Bitwise", "x := 1.5 << 2", "undefined operation: left shift (<<) is not defined for 'float'"},
+		{"Unary", "x := -true", "undefined operation: negation (-) is not defined for 'bool'"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			if assert.NotEmpty(t, ast.Errors) {
+				assert.Equal(t, c.expect, errorMessages(ast)[0])
+			}
+		})
+	}
+}
+
+func TestNamedResults(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Valid", "func answer() (result int) {\nresult := 40 + 2\nreturn\n}\nfunc main() {\nx := answer()\n}", nil},
+		{"Widened", "func ratio() (r float) {\nr := 1\n}", nil},
+		{"MinInt", "func lowest() (r int) {\nr := -2147483648\n}", nil},
+		{"IncompatibleType", "func answer() (result int) {\nresult := \"42\"\n}", []string{"incompatible types: 'int' and 'string'"}},
+		{"UnknownType", "func answer() (result number) {}", []string{"undefined: number"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+
+	_, global := analyze("func answer() (result int) {}")
+	assert.Equal(t, &FuncType{Returns: []*BasicType{{"int"}}}, global.Get("answer"))
+}
+
+func TestInferredResults(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Single", "func f() {\nreturn 1\n}\nfunc main() {\nx := f() + 1\n}", nil},
+		{"Agreeing", "func f() {\nif true {\nreturn 1\n}\nreturn 2\n}", nil},
+		{"Widened", "func f() {\nx := 5000000000\nif true {\nreturn x\n}\nreturn 1\n}", nil},
+		{"CalledBefore", "func f() {\nreturn g() * 2\n}\nfunc g() {\nreturn 1.5\n}\nfunc main() {\nx := f() + 0.5\n}", nil},
+		{"Variable", "x := \"s\"\nfunc f() {\nreturn x\n}\ny := f()", nil},
+		{"Bare", "func f() {\nreturn\n}\nfunc main() {\nx := f()\n}",
+			[]string{"void in expression: f() has no result and can't be used as a value"}},
+		{"Conflicting", "func f() {\nif true {\nreturn 1\n}\nreturn \"s\"\n}",
+			[]string{"return mismatch: returning 'string', but the function returns 'int'"}},
+		{"MissingValue", "func f() {\nif true {\nreturn 1\n}\nreturn\n}",
+			[]string{"return mismatch: returning 'void', but the function returns 'int'"}},
+		{"NamedResult", "func f() (r int) {\nreturn \"s\"\n}",
+			[]string{"return mismatch: returning 'string', but the function returns 'int'"}},
+		{"Function", "func f() {\nreturn func() {}\n}", []string{"unsupported result: a value of type 'func()' can't be returned"}},
+		{"Literal", "func main() {\nf := func() {\nreturn true\n}\nif f() {}\n}", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+
+	_, global := analyze("func f() {\nreturn 1\n}\nfunc g() {}")
+	assert.Equal(t, &FuncType{Returns: []*BasicType{{"int"}}}, global.Get("f"))
+	assert.Equal(t, &FuncType{}, global.Get("g"))
+}
+
+func TestDefer(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Call", "func main() {\ndefer print(1)\n}", nil},
+		{"NotCall", "func main() {\ndefer 1 + 2\n}", []string{"defer requires a function call"}},
+		{"UndefinedCall", "func main() {\ndefer cleanup()\n}", []string{"undefined: cleanup"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestPanic(t *testing.T) {
+	ast, global := analyze("func main() {\npanic(\"x\")\n}")
+	assert.Empty(t, ast.Errors)
+
+	expect := &FuncType{Args: []*ArgumentType{{Name: "msg", Type: &BasicType{"string"}}}}
+	assert.Equal(t, expect, global.Get("panic"))
+}
+
+func TestAssert(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Comparison", "func main() {\nassert(1 == 1)\n}", nil},
+		{"Bool", "func main() {\nok := true\nassert(ok)\n}", nil},
+		{"NotBool", "func main() {\nassert(1)\n}", []string{"non-boolean condition: 'int' used as a condition"}},
+		{"Void", "func main() {\nassert(assert(true))\n}", []string{"void in expression: assert() has no result and can't be used as a value"}},
+		{"NoArguments", "func main() {\nassert()\n}", []string{"argument mismatch: assert() takes 1 argument but 0 were given"}},
+		{"TwoArguments", "func main() {\nassert(true, false)\n}", []string{"argument mismatch: assert() takes 1 argument but 2 were given"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestChainedComparison(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Chained", "func main() {\nx := 1 == 2 == 3\n}", []string{"chained comparison: the result of a comparison is a 'bool' and can't be compared with 'int'"}},
+		{"ComparedWithBool", "func main() {\nx := 1 == 2 == true\n}", nil},
+		{"NotChained", "func main() {\nx := 1 == \"1\"\n}", []string{"incompatible types: 'int' and 'string'"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestVoidCalls(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Statement", "func f() {}\nfunc main() {\nf()\n}", nil},
+		{"Assignment", "func f() {}\nfunc main() {\nx := f()\n}", []string{"void in expression: f() has no result and can't be used as a value"}},
+		{"Argument", "func f() {}\nfunc main() {\nprintln(f())\n}", []string{"void in expression: f() has no result and can't be used as a value"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestTopLevelExpressions(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		repl   bool
+		expect []string
+	}{
+		{"Expression", "1 + 1", false, []string{"top-level expression: only declarations are allowed outside of a function"}},
+		{"Call", "func f() {}\nf()", false, []string{"top-level expression: only declarations are allowed outside of a function"}},
+		{"Declarations", "import \"a\"\nextern func puts(s string) int\nx := 1\nfunc main() {\n1 + 1\n}", false, []string{
+			"can't import \"a\": imports are not supported",
+		}},
+		{"REPL", "1 + 1", true, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src, func(analyzer *ContextAnalyzer) {
+				analyzer.AllowTopLevelExpressions(c.repl)
+			})
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestFunctionComparison(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"SameSignature", "func f() {}\nfunc g() {}\nfunc main() {\nx := f == g\nprint(x)\n}", nil},
+		{"Builtins", "func main() {\nx := print == println\nprint(x)\n}", nil},
+		{"DifferentSignature", "extern func puts(s string) int\nfunc f() {}\nfunc main() {\nx := f == puts\nprint(x)\n}",
+			[]string{"incompatible types: 'func()' and 'func(string) int'"}},
+		{"Arithmetic", "func f() {}\nfunc main() {\nx := f + f\n}",
+			[]string{"undefined operation: addition (+) is not defined for 'func()'"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestFuncLiteral(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Called", "func main() {\nf := func() {\nprint(1)\n}\nf()\n}", nil},
+		{"Results", "func main() {\nf := func() (r int) {\nr := 2\n}\nx := f()\nprint(x)\n}", nil},
+		{"TopLevel", "func g() {}\nfunc main() {\nf := func() {\ng()\n}\nf()\n}", nil},
+		{"NoCapture", "func main() {\nx := 1\nf := func() {\nprint(x)\n}\nf()\n}", []string{"undefined: x"}},
+		{"ScopedBody", "func main() {\nf := func() {\ny := 1\n}\nprint(y)\n}", []string{"undefined: y"}},
+		{"IncompatibleResult", "func main() {\nf := func() (r int) {\nr := \"s\"\n}\n}",
+			[]string{"incompatible types: 'int' and 'string'"}},
+		{"Void", "func main() {\nf := func() {}\nx := f()\n}", []string{"void in expression: f() has no result and can't be used as a value"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+
+	ast, _ := analyze("func main() {\nf := func() (r int) {}\n}")
+	decl := ast.Statements[0].Expr.(*FuncDecl).Body[0].(*VariableDecl)
+	assert.Equal(t, &FuncType{Returns: []*BasicType{{"int"}}}, decl.ResolvedType)
+}
+
+func TestFuncValueCalls(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Variable", "func main() {\nf := func() {}\nf()\n}", nil},
+		{"Literal", "func main() {\nfunc() {\nprint(1)\n}()\n}", nil},
+		{"Operand", "func two() (r int) {\nr := 2\n}\nfunc main() {\ng := two\nx := g() + 1\nprint(x)\n}", nil},
+		{"LiteralBody", "func main() {\nfunc() {\nprint(y)\n}()\n}", []string{"undefined: y"}},
+		{"VoidLiteral", "func main() {\nx := func() {}()\n}", []string{"void in expression: func() {}() has no result and can't be used as a value"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+func TestAnalyzerPasses(t *testing.T) {
+	exprs := []Expr{
+		&FuncDecl{Name: "f", Body: []Expr{}},
+		&BadExpr{},
+		&FuncDecl{Name: "main", Body: []Expr{&FuncCall{Callee: &Identifier{Name: "g"}}}},
+		&FuncDecl{Name: "g", Body: []Expr{}},
+	}
+
+	analyzer := NewContextAnalyser(NewParserMocker(exprs))
+
+	// The definitions after the bad expression are still brought in
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+	assert.NotNil(t, global.Get("f"))
+	assert.NotNil(t, global.Get("g"))
+
+	// The second pass replays the full stream
+	ast := analyzer.Do(global)
+	if assert.Len(t, ast.Statements, 3) {
+		assert.Equal(t, exprs[0], ast.Statements[0].Expr)
+		assert.Equal(t, exprs[2], ast.Statements[1].Expr)
+		assert.Equal(t, exprs[3], ast.Statements[2].Expr)
+	}
+
+	if assert.Len(t, ast.Errors, 1) {
+		assert.IsType(t, &BadExprError{}, ast.Errors[0])
+	}
+
+	// And so does any later pass
+	assert.Len(t, analyzer.Do(global).Statements, 3)
+}
+
+func TestNestedBadExprs(t *testing.T) {
+	arg := &BadExpr{Error: "expected an argument before ','"}
+	deferred := &BadExpr{Error: "invalid symbol ')'"}
+	exprs := []Expr{
+		&FuncDecl{Name: "main", Body: []Expr{
+			&FuncCall{Callee: &Identifier{Name: "undefined"}, Args: []Expr{arg, &LiteralExpr{Typ: LiteralNumber, Value: "1"}}},
+			// The operand of a deferred expression that is not a call is never analyzed
+			&DeferExpr{Call: &BinaryExpr{Operation: BinaryAddition, Op1: deferred, Op2: &LiteralExpr{Typ: LiteralNumber, Value: "1"}}},
+		}},
+	}
+
+	analyzer := NewContextAnalyser(NewParserMocker(exprs))
+
+	global := NewGlobalSymbolTable()
+	analyzer.DefineInto(global)
+
+	var bad []*BadExpr
+	for _, err := range analyzer.Do(global).Errors {
+		if e, ok := err.(*BadExprError); ok {
+			bad = append(bad, e.Expr)
+		}
+	}
+
+	// Each bad expression is reported exactly once
+	assert.ElementsMatch(t, []*BadExpr{arg, deferred}, bad)
+
+	src := "func main() {\nprint(, 1)\n}"
+	ast, _ := analyze(src)
+	if assert.Len(t, ast.Errors, 1) {
+		assert.Equal(t, "bad expression: expected an argument before ','", errorMessages(ast)[0])
+	}
+}
+
+func TestForwardReferences(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Variable", "a := b\nb := 1", nil},
+		{"Chain", "a := b + c\nb := c * 2\nc := 1.5", nil},
+		{"Function", "func main() {\nx := a + 1\nprint(x)\n}\na := b\nb := 1", nil},
+		{"Incompatible", "a := b + \"x\"\nb := 1", []string{"incompatible types: 'int' and 'string'"}},
+		{"Undefined", "a := b\nb := c", []string{"undefined: c"}},
+		{"Cycle", "a := b\nb := a", []string{"initialization cycle: the value of 'a' refers to itself"}},
+		{"SelfReference", "a := a + 1", []string{"initialization cycle: the value of 'a' refers to itself"}},
+		{"FuncLitSelfReference", "g := func() {\ng()\n}", []string{"initialization cycle: the value of 'g' refers to itself"}},
+		{"FuncLitShadowed", "g := func() {\ng := 1\nprintln(g)\n}", nil},
+		{"FuncLitShadowedResult", "g := func() (g int) {\nreturn 1\n}", nil},
+		{"FuncLitShadowedInBlock", "g := func() {\nif true {\ng := 1\n}\ng()\n}", []string{"initialization cycle: the value of 'g' refers to itself"}},
+		{"FuncLitDependency", "f := func() {\nreturn b\n}\nb := 1.5", nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+
+	_, global := analyze("a := b\nb := 1.5")
+	assert.Equal(t, &BasicType{"float"}, global.Get("a"))
+}
+
+func TestBlankIdentifier(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Discard", "func f() (r int) {\nr := 1\n}\nfunc main() {\n_ := f()\n_ := \"x\"\n}", nil},
+		{"TopLevel", "_ := 1\n_ := 2", nil},
+		{"ExternParam", "extern func puts(_ string) int", nil},
+		{"Reference", "func main() {\n_ := 1\nx := _ + 1\nprint(x)\n}", []string{
+			"blank identifier: '_' can only be declared, and can't be used as a value",
+		}},
+		{"Call", "func main() {\n_()\n}", []string{
+			"blank identifier: '_' can only be declared, and can't be used as a value",
+		}},
+		{"ErrorsInValue", "func main() {\n_ := 1 + \"x\"\n}", []string{"incompatible types: 'int' and 'string'"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, global := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+
+			// No binding is ever created for the blank identifier
+			assert.Nil(t, global.Get("_"))
+			for _, stmt := range ast.Statements {
+				assert.Nil(t, stmt.Stab.Get("_"))
+			}
+		})
+	}
+}
+
+func TestMultiVariableDecl(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Declaration", "func main() {\na, b := 1, \"x\"\nprint(a)\nprintln(b)\n}", nil},
+		{"Swap", "func main() {\na, b := 1, 2\na, b := b, a\n}", nil},
+		{"TopLevel", "a, b := c, 1\nc := b", nil},
+		{"TooFewValues", "func main() {\na, b := 1\nprint(b)\n}", []string{"assignment mismatch: 2 variables but 1 value"}},
+		{"TooManyValues", "func main() {\na, b := 1, 2, 3\n}", []string{"assignment mismatch: 2 variables but 3 values"}},
+		{"ValueErrors", "func main() {\na, b := 1 + \"x\", y\n}", []string{
+			"incompatible types: 'int' and 'string'",
+			"undefined: y",
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+
+	// Each variable takes the type of its value
+	ast, _ := analyze("func main() {\na, b := 1, \"x\"\n}")
+	decl := ast.Statements[0].Expr.(*FuncDecl).Body[0].(*MultiVariableDecl)
+	assert.Equal(t, []Type{&BasicType{"int"}, &BasicType{"string"}}, decl.ResolvedTypes)
+}
+
+func TestTypeOf(t *testing.T) {
+	src := "func main() {\nx := 1 + 2\nif true {\ny := \"a\"\nprintln(y)\n}\nz := 2 + 1.5\nw := x + \"a\"\n}"
+	ast, _ := analyze(src)
+	body := ast.Statements[0].Expr.(*FuncDecl).Body
+
+	x := body[0].(*VariableDecl)
+	assert.Equal(t, &BasicType{"int"}, ast.TypeOf(x))
+	assert.Equal(t, &BasicType{"int"}, ast.TypeOf(x.Value))
+
+	// Nested expressions are resolved within their own scope
+	call := body[1].(*IfExpr).Consequent[1].(*FuncCall)
+	assert.Equal(t, &BasicType{"string"}, ast.TypeOf(call.Args[0]))
+	assert.Equal(t, &BasicType{"void"}, ast.TypeOf(call))
+
+	z := body[2].(*VariableDecl)
+	assert.Equal(t, &BasicType{"float"}, ast.TypeOf(z.Value))
+	assert.Equal(t, &BasicType{"int"}, ast.TypeOf(z.Value.(*BinaryExpr).Op1))
+
+	// The types that couldn't be resolved, and the expressions outside the AST, have no type
+	w := body[3].(*VariableDecl)
+	assert.Nil(t, ast.TypeOf(w))
+	assert.Nil(t, ast.TypeOf(w.Value))
+	assert.Nil(t, ast.TypeOf(&Identifier{Name: "x"}))
+
+	// Looking up types doesn't report errors again
+	assert.Len(t, ast.Errors, 1)
+}
+
+func TestNotCallable(t *testing.T) {
+	cases := []struct {
+		name   string
+		src    string
+		expect []string
+	}{
+		{"Variable", "func main() {\nx := 1\nx()\n}", []string{"not callable: 'x' of type 'int' is not a function"}},
+		{"Value", "func main() {\ns := \"a\"\ny := s(1)\n}", []string{"not callable: 's' of type 'string' is not a function"}},
+		{"TopLevelVariable", "x := true\nfunc main() {\nx()\n}", []string{"not callable: 'x' of type 'bool' is not a function"}},
+		{"BadVariable", "func main() {\nx := 1 + \"a\"\nx()\n}", []string{"incompatible types: 'int' and 'string'"}},
+		{"Function", "func f() {}\nfunc main() {\nf()\n}", nil},
+		{"CallResult", "func f() {}\nfunc main() {\nf()()\n}", []string{"not callable: 'f()' of type 'void' is not a function"}},
+		{"UndefinedCallee", "func main() {\ng()(1 + \"a\")\n}", []string{"undefined: g", "incompatible types: 'int' and 'string'"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ast, _ := analyze(c.src)
+			assert.Equal(t, c.expect, errorMessages(ast))
+		})
+	}
+}
+
+// Use a package-level variable to avoid compiler optimisation
+var benchStab *SymbolTable
+
+func benchmarkSymbolTableCopy(size int, b *testing.B) {
+	b.ReportAllocs()
+
+	stab := NewGlobalSymbolTable()
+	for i := 0; i < size; i++ {
+		stab.Add(fmt.Sprintf("v%d", i), &BasicType{"int"})
+		stab.AddError(&UndefinedError{Name: fmt.Sprintf("u%d", i)})
+	}
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		benchStab = stab.Copy()
+	}
+}
+
+func BenchmarkSymbolTableCopy10(b *testing.B) {
+	benchmarkSymbolTableCopy(10, b)
+}
+
+func BenchmarkSymbolTableCopy100(b *testing.B) {
+	benchmarkSymbolTableCopy(100, b)
+}
+
+func BenchmarkSymbolTableCopy1000(b *testing.B) {
+	benchmarkSymbolTableCopy(1000, b)
 }